@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/client"
+	"github.com/enix/tsigoat/pkg/cmd"
+	"github.com/enix/tsigoat/pkg/dns/tsig"
+	"github.com/enix/tsigoat/pkg/server"
+	"github.com/enix/tsigoat/pkg/types"
+	miekgdns "github.com/miekg/dns"
+
+	"github.com/spf13/cobra"
+)
+
+// Server, transport and key flags of the commands sending updates
+type clientOptions struct {
+	file          *server.ConfigurationFile
+	server        string
+	net           *types.Enum
+	keyName       string
+	algorithm     string
+	keyFile       string
+	key           string
+	timeout       time.Duration
+	tlsCaFile     string
+	tlsCertFile   string
+	tlsKeyFile    string
+	tlsServerName string
+}
+
+// Keys given by name are looked up in the configuration file
+func newClientOptions(file *server.ConfigurationFile) *clientOptions {
+	return &clientOptions{
+		file: file,
+		net:  types.NewEnum(client.NetUdp, client.NetUdp, client.NetTcp, client.NetTls),
+	}
+}
+
+func (o *clientOptions) addFlags(command *cobra.Command) {
+	flags := command.Flags()
+	flags.StringVarP(&o.server, "server", "s", "", "Server address, with an optional port")
+	flags.VarP(o.net, "net", "N",
+		fmt.Sprintf("Transport. Valid values are: %s.", strings.Join(o.net.AllowedValues(), ", ")))
+	flags.StringVarP(&o.keyName, "key-name", "k", "", "Name of the TSIG key")
+	flags.StringVarP(&o.algorithm, "algorithm", "a", "hmac-sha256",
+		"HMAC algorithm of keys read from the server configuration file")
+	flags.StringVar(&o.keyFile, "key-file", "", "BIND key file, as written by tsig-keygen or the keygen command")
+	flags.StringVarP(&o.key, "key", "y", "", "TSIG key given as [algorithm:]name:secret")
+	flags.DurationVarP(&o.timeout, "timeout", "t", 5*time.Second, "Timeout of each update")
+	flags.StringVar(&o.tlsCaFile, "tls-ca", "", "CA certificates verifying the server, the system ones when empty")
+	flags.StringVar(&o.tlsCertFile, "tls-cert", "", "Client certificate")
+	flags.StringVar(&o.tlsKeyFile, "tls-key", "", "Private key of the client certificate")
+	flags.StringVar(&o.tlsServerName, "tls-server-name", "",
+		"Name verified in the server certificate, the server host when empty")
+
+	command.MarkFlagsMutuallyExclusive("key", "key-file")
+	command.MarkFlagsMutuallyExclusive("key", "key-name")
+	command.MarkFlagsRequiredTogether("tls-cert", "tls-key")
+}
+
+func (o *clientOptions) sendOptions() (client.SendOptions, error) {
+	var err error
+
+	options := client.SendOptions{Net: o.net.String(), Timeout: o.timeout}
+	if options.Net == client.NetTls {
+		options.Tls, err = o.tlsConfig()
+	}
+	return options, err
+}
+
+// Keys given on the command line take precedence over the server configuration file
+func (o *clientOptions) resolveKey(settings *cmd.Settings) (*client.Key, error) {
+	switch {
+	case o.key != "":
+		parts := strings.Split(o.key, ":")
+		switch len(parts) {
+		case 2:
+			return &client.Key{Name: miekgdns.Fqdn(parts[0]), Algorithm: o.algorithm, Secret: parts[1]}, nil
+		case 3:
+			return &client.Key{Name: miekgdns.Fqdn(parts[1]), Algorithm: parts[0], Secret: parts[2]}, nil
+		default:
+			return nil, fmt.Errorf("invalid key '%s', expecting [algorithm:]name:secret", o.key)
+		}
+	case o.keyFile != "":
+		data, err := os.ReadFile(o.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := tsig.ParseBindKeys(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", o.keyFile, err)
+		}
+		if o.keyName == "" && len(keys) > 1 {
+			return nil, fmt.Errorf("%s holds %d keys, select one with --key-name", o.keyFile, len(keys))
+		}
+		for _, key := range keys {
+			if o.keyName == "" || miekgdns.CanonicalName(key.Name) == miekgdns.CanonicalName(miekgdns.Fqdn(o.keyName)) {
+				return &client.Key{Name: key.Name, Algorithm: key.Algorithm, Secret: key.Secret}, nil
+			}
+		}
+		return nil, fmt.Errorf("%s has no key '%s'", o.keyFile, o.keyName)
+	case o.keyName != "":
+		config, path, err := server.LoadConfiguration(o.file, settings.Logger.Sugar())
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range config.Tsig.Keys {
+			if miekgdns.CanonicalName(miekgdns.Fqdn(key.Name)) == miekgdns.CanonicalName(miekgdns.Fqdn(o.keyName)) {
+				return &client.Key{Name: miekgdns.Fqdn(key.Name), Algorithm: o.algorithm, Secret: key.Key}, nil
+			}
+		}
+		return nil, fmt.Errorf("configuration file %s has no key '%s'", path, o.keyName)
+	default:
+		// unsigned, unless set by the script
+		return nil, nil
+	}
+}
+
+func (o *clientOptions) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{ServerName: o.tlsServerName, MinVersion: tls.VersionTLS12}
+
+	if o.tlsCaFile != "" {
+		data, err := os.ReadFile(o.tlsCaFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s: no PEM certificate found", o.tlsCaFile)
+		}
+	}
+	if o.tlsCertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(o.tlsCertFile, o.tlsKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/enix/tsigoat/pkg/cmd"
+	"github.com/enix/tsigoat/pkg/server"
+	"github.com/enix/tsigoat/pkg/types"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	configDesc = `
+Inspect the server configuration file, located like the serve command does.
+`
+	configDumpDesc = `
+Load the configuration file like the serve command does, and print it with every zone resolved to
+the handler and keys it is served with once defaults apply, and whether authentication is enabled.
+Zones discovered from backends are not listed, their rules are.
+
+TSIG secrets, admin tokens and adapter credentials are redacted unless --show-secrets is set.
+`
+	configSchemaDesc = `
+Print a JSON Schema of the configuration file, generated from the configuration types, including the
+settings of every handler adapter and the constraints checked when loading the file.
+
+Editors and CI jobs can validate YAML, JSON and TOML configuration files against it. Keys are
+lowercased as in the documentation, and references between sections, such as zones using unknown
+keys, are only checked by the config check command.
+`
+	configCheckDesc = `
+Load the configuration file like the serve command does, and report every problem found with the
+path of the faulty setting, such as unknown key references or keys set on an unsecure zone.
+
+The command exits with a non-zero status when the configuration is not valid, so it can be run
+before deploying a configuration.
+`
+)
+
+func newCmdConfig(settings *cmd.Settings) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration file",
+		Long:  configDesc,
+		Args:  cobra.NoArgs,
+	}
+
+	command.AddCommand(
+		newCmdConfigCheck(settings),
+		newCmdConfigDump(settings),
+		newCmdConfigSchema(settings),
+	)
+
+	return command
+}
+
+type configCheckOptions struct{}
+
+func newCmdConfigCheck(settings *cmd.Settings) *cobra.Command {
+	serverSettings := settings.ToServer()
+
+	options := &configCheckOptions{}
+	command := &cobra.Command{
+		Use:   "check",
+		Short: "Validate the configuration file",
+		Long:  configCheckDesc,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// problems are already reported
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			return options.run(settings, serverSettings.ConfigurationFile)
+		},
+	}
+
+	flags := command.Flags()
+	serverSettings.AddConfigurationFlags(flags)
+
+	return command
+}
+
+func (o *configCheckOptions) run(settings *cmd.Settings, file *server.ConfigurationFile) error {
+	_, path, err := server.LoadConfiguration(file, settings.Logger.Sugar())
+	if err != nil {
+		var problemsErr *server.ProblemsError
+		if !errors.As(err, &problemsErr) {
+			return err
+		}
+		printProblems(settings.Stdout, path, problemsErr.Problems)
+		return fmt.Errorf("configuration file %s is not valid, %d problem(s) found", path,
+			len(problemsErr.Problems))
+	}
+
+	fmt.Fprintf(settings.Stdout, "configuration file %s is valid\n", path)
+	return nil
+}
+
+func printProblems(out io.Writer, path string, problems []server.Problem) {
+	for _, problem := range problems {
+		if problem.File != "" {
+			fmt.Fprintln(out, problem)
+			continue
+		}
+		fmt.Fprintf(out, "%s: %s\n", path, problem)
+	}
+}
+
+type configDumpOptions struct {
+	output      *types.Enum
+	showSecrets bool
+}
+
+func newCmdConfigDump(settings *cmd.Settings) *cobra.Command {
+	serverSettings := settings.ToServer()
+
+	options := &configDumpOptions{
+		output: types.NewEnum(string(server.YamlConfiguration), string(server.YamlConfiguration),
+			string(server.JsonConfiguration), string(server.TomlConfiguration)),
+	}
+	command := &cobra.Command{
+		Use:   "dump",
+		Short: "Print the resolved configuration",
+		Long:  configDumpDesc,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			return options.run(settings, serverSettings.ConfigurationFile)
+		},
+	}
+
+	flags := command.Flags()
+	flags.VarP(options.output, "output", "o",
+		fmt.Sprintf("Output format. Valid values are: %s.", strings.Join(options.output.AllowedValues(), ", ")))
+	flags.BoolVar(&options.showSecrets, "show-secrets", false, "Print TSIG secrets and credentials instead of redacting them")
+	serverSettings.AddConfigurationFlags(flags)
+
+	return command
+}
+
+func (o *configDumpOptions) run(settings *cmd.Settings, file *server.ConfigurationFile) error {
+	config, _, err := server.LoadConfiguration(file, settings.Logger.Sugar())
+	if err != nil {
+		return err
+	}
+	dump := config.Dump(o.showSecrets)
+
+	out := settings.Stdout
+	switch server.ConfigFormat(o.output.String()) {
+	case server.YamlConfiguration:
+		encoder := yaml.NewEncoder(out)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(dump); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case server.JsonConfiguration:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(dump)
+	case server.TomlConfiguration:
+		return toml.NewEncoder(out).Encode(dump)
+	default:
+		panic("unknown output format")
+	}
+}
+
+type configSchemaOptions struct {
+	output *types.Enum
+}
+
+func newCmdConfigSchema(settings *cmd.Settings) *cobra.Command {
+	options := &configSchemaOptions{
+		output: types.NewEnum(string(server.JsonConfiguration), string(server.JsonConfiguration),
+			string(server.YamlConfiguration)),
+	}
+	command := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of the configuration file",
+		Long:  configSchemaDesc,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return options.run(settings.Stdout)
+		},
+	}
+
+	flags := command.Flags()
+	flags.VarP(options.output, "output", "o",
+		fmt.Sprintf("Output format. Valid values are: %s.", strings.Join(options.output.AllowedValues(), ", ")))
+
+	return command
+}
+
+func (o *configSchemaOptions) run(out io.Writer) error {
+	schema := server.Schema()
+
+	if server.ConfigFormat(o.output.String()) == server.YamlConfiguration {
+		encoder := yaml.NewEncoder(out)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(schema); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(schema)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/enix/tsigoat/pkg/cmd"
+	"github.com/enix/tsigoat/pkg/dns/tsig"
+	"github.com/enix/tsigoat/pkg/server"
+	"github.com/enix/tsigoat/pkg/types"
+	miekgdns "github.com/miekg/dns"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/spf13/cobra"
+)
+
+const keygenDesc = `
+Generate a TSIG secret and print it in a format ready to be used by the server or by clients.
+
+The yaml, json and toml outputs are snippets of the server configuration file. The bind output is a
+key statement for named.conf or nsupdate -k, the dnspython output a keyring for dnspython scripts,
+and the kubernetes output a Secret for the RFC2136 solver of cert-manager.
+`
+
+const (
+	keygenYaml       = "yaml"
+	keygenJson       = "json"
+	keygenToml       = "toml"
+	keygenBind       = "bind"
+	keygenDnspython  = "dnspython"
+	keygenKubernetes = "kubernetes"
+)
+
+// Name of the Secret data entry holding the key
+const keygenSecretKey = "tsig-secret-key"
+
+var notDns1123 = regexp.MustCompile(`[^a-z0-9-]+`)
+
+type keygenOptions struct {
+	algorithm  string
+	size       int
+	isDefault  bool
+	output     *types.Enum
+	secretName string
+	namespace  string
+}
+
+func newCmdKeygen(settings *cmd.Settings) *cobra.Command {
+	options := &keygenOptions{
+		output: types.NewEnum(keygenYaml, keygenYaml, keygenJson, keygenToml, keygenBind, keygenDnspython,
+			keygenKubernetes),
+	}
+	command := &cobra.Command{
+		Use:   "keygen NAME",
+		Short: "Generate a TSIG key",
+		Long:  keygenDesc,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return options.run(settings.Stdout, args[0])
+		},
+	}
+
+	flags := command.Flags()
+	flags.StringVarP(&options.algorithm, "algorithm", "a", "hmac-sha256",
+		"HMAC algorithm, one of hmac-sha1, hmac-sha224, hmac-sha256, hmac-sha384 and hmac-sha512")
+	flags.IntVarP(&options.size, "size", "b", 0, "Secret size in bytes, the digest size of the algorithm when 0")
+	flags.BoolVar(&options.isDefault, "default", false, "Mark the key as the server default key in configuration snippets")
+	flags.VarP(options.output, "output", "o",
+		fmt.Sprintf("Output format. Valid values are: %s.", strings.Join(options.output.AllowedValues(), ", ")))
+	flags.StringVar(&options.secretName, "secret-name", "",
+		"Name of the Kubernetes Secret, derived from the key name when empty")
+	flags.StringVarP(&options.namespace, "namespace", "n", "", "Namespace of the Kubernetes Secret")
+
+	return command
+}
+
+func (o *keygenOptions) run(out io.Writer, name string) error {
+	name = miekgdns.Fqdn(name)
+	if _, ok := miekgdns.IsDomainName(name); !ok || name == "." {
+		return fmt.Errorf("invalid key name '%s'", name)
+	}
+	if o.size < 0 {
+		return fmt.Errorf("invalid secret size %d", o.size)
+	}
+
+	algorithm := miekgdns.Fqdn(miekgdns.CanonicalName(o.algorithm))
+	key, err := tsig.GenerateKey(algorithm, o.size)
+	if err != nil {
+		return err
+	}
+
+	// same layout as the server configuration file
+	snippet := map[string]any{
+		"tsig": map[string]any{
+			"keys": []server.TsigKeyConfiguration{{Default: o.isDefault, Name: name, Key: key.ToBase64()}},
+		},
+	}
+
+	switch o.output.String() {
+	case keygenYaml:
+		encoder := yaml.NewEncoder(out)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(lowerKeys(snippet)); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case keygenJson:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(lowerKeys(snippet))
+	case keygenToml:
+		return toml.NewEncoder(out).Encode(lowerKeys(snippet))
+	case keygenBind:
+		_, err := fmt.Fprint(out, tsig.FormatBindKey(name, algorithm, key))
+		return err
+	case keygenDnspython:
+		_, err := fmt.Fprintf(out, "import dns.tsigkeyring\n\nkeyring = dns.tsigkeyring.from_text({\n"+
+			"    %q: (%q, %q),\n})\n", name, strings.TrimSuffix(algorithm, "."), key.ToBase64())
+		return err
+	case keygenKubernetes:
+		return o.writeSecret(out, name, algorithm, key)
+	default:
+		panic("unknown output format")
+	}
+}
+
+// The solver settings referencing the Secret are given as a comment
+func (o *keygenOptions) writeSecret(out io.Writer, name string, algorithm string, key tsig.TsigKey) error {
+	secretName := o.secretName
+	if secretName == "" {
+		secretName = strings.Trim(notDns1123.ReplaceAllString(strings.ToLower(name), "-"), "-") + "-tsig"
+	}
+
+	metadata := map[string]any{"name": secretName}
+	if o.namespace != "" {
+		metadata["namespace"] = o.namespace
+	}
+	manifest := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"type":       "Opaque",
+		"metadata":   metadata,
+		"stringData": map[string]string{keygenSecretKey: key.ToBase64()},
+	}
+
+	// cert-manager names algorithms like HMACSHA256
+	certManagerAlgorithm := strings.ToUpper(strings.ReplaceAll(strings.TrimSuffix(algorithm, "."), "-", ""))
+	fmt.Fprintf(out, "# solvers:\n#   - dns01:\n#       rfc2136:\n#         nameserver: <server address>\n"+
+		"#         tsigKeyName: %s\n#         tsigAlgorithm: %s\n#         tsigSecretSecretRef:\n"+
+		"#           name: %s\n#           key: %s\n", name, certManagerAlgorithm, secretName, keygenSecretKey)
+
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Configuration keys are case insensitive, lowercased like viper does
+func lowerKeys(value any) any {
+	data, _ := json.Marshal(value)
+	var generic any
+	json.Unmarshal(data, &generic)
+	return lowerMapKeys(generic)
+}
+
+func lowerMapKeys(value any) any {
+	switch typed := value.(type) {
+	case map[string]any:
+		lowered := make(map[string]any, len(typed))
+		for key, item := range typed {
+			lowered[strings.ToLower(key)] = lowerMapKeys(item)
+		}
+		return lowered
+	case []any:
+		for idx, item := range typed {
+			typed[idx] = lowerMapKeys(item)
+		}
+		return typed
+	default:
+		return value
+	}
+}
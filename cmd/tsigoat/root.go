@@ -29,6 +29,10 @@ func newCmdRoot(name string, settings *cmd.Settings) *cobra.Command {
 	command.AddCommand(
 		newCmdVersion(settings),
 		newCmdServe(settings),
+		newCmdKeygen(settings),
+		newCmdConfig(settings),
+		newCmdUpdate(settings),
+		newCmdSelftest(settings),
 	)
 
 	return command
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/enix/tsigoat/pkg/cmd"
+	"github.com/enix/tsigoat/pkg/selftest"
+	"github.com/enix/tsigoat/pkg/types"
+
+	"github.com/spf13/cobra"
+)
+
+const selftestDesc = `
+Run an RFC 2136 conformance suite against a running server: prerequisite response codes, CNAME
+conflicts, protection of the apex SOA and NS RRsets, TSIG failure modes and atomicity of rejected
+updates. A pass/fail report is printed.
+
+Records are created below a random label of the zone and deleted once done. The apex checks try to
+delete the apex SOA and NS RRsets, which a conforming server ignores: only run the suite against
+zones you can afford to repair, such as staging ones.
+
+The command exits with a non-zero status when a check fails.
+`
+
+type selftestOptions struct {
+	client *clientOptions
+	zone   string
+	output *types.Enum
+}
+
+func newCmdSelftest(settings *cmd.Settings) *cobra.Command {
+	serverSettings := settings.ToServer()
+
+	options := &selftestOptions{
+		client: newClientOptions(serverSettings.ConfigurationFile),
+		output: types.NewEnum(updateText, updateText, updateJson),
+	}
+	command := &cobra.Command{
+		Use:   "selftest",
+		Short: "Check the conformance of a server",
+		Long:  selftestDesc,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			return options.run(settings)
+		},
+	}
+
+	flags := command.Flags()
+	flags.StringVarP(&options.zone, "zone", "z", "", "Zone to run the suite against")
+	flags.VarP(options.output, "output", "o",
+		fmt.Sprintf("Output format. Valid values are: %s.", strings.Join(options.output.AllowedValues(), ", ")))
+	options.client.addFlags(command)
+	serverSettings.AddConfigurationFlags(flags)
+
+	command.MarkFlagRequired("server")
+	command.MarkFlagRequired("zone")
+
+	return command
+}
+
+func (o *selftestOptions) run(settings *cmd.Settings) error {
+	key, err := o.client.resolveKey(settings)
+	if err != nil {
+		return err
+	}
+	sendOptions, err := o.client.sendOptions()
+	if err != nil {
+		return err
+	}
+
+	report := selftest.Run(selftest.Target{Server: o.client.server, Zone: o.zone, Key: key, Options: sendOptions})
+	if err := o.print(settings.Stdout, report); err != nil {
+		return err
+	}
+	if !report.Passed() {
+		return fmt.Errorf("%d of %d check(s) failed", report.Count(selftest.Failed), len(report.Outcomes))
+	}
+	return nil
+}
+
+func (o *selftestOptions) print(out io.Writer, report *selftest.Report) error {
+	if o.output.String() == updateJson {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	fmt.Fprintf(out, "zone %s, records below %s\n\n", report.Zone, report.Base)
+	for _, outcome := range report.Outcomes {
+		fmt.Fprintf(out, "%-4s  %-13s  %s\n", strings.ToUpper(outcome.Status), outcome.Category, outcome.Name)
+		if outcome.Detail != "" {
+			fmt.Fprintf(out, "      %-13s  %s\n", "", outcome.Detail)
+		}
+	}
+	_, err := fmt.Fprintf(out, "\n%d passed, %d failed, %d skipped\n", report.Count(selftest.Passed),
+		report.Count(selftest.Failed), report.Count(selftest.Skipped))
+	return err
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/enix/tsigoat/internal/product"
@@ -8,7 +9,6 @@ import (
 	"github.com/enix/tsigoat/pkg/server"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 const serveDesc = `
@@ -18,9 +18,7 @@ Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu
 Excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum.
 `
 
-type serveOptions struct {
-	viper *viper.Viper
-}
+type serveOptions struct{}
 
 func newCmdServe(settings *cmd.Settings) *cobra.Command {
 	serverSettings := settings.ToServer()
@@ -43,9 +41,6 @@ func newCmdServe(settings *cmd.Settings) *cobra.Command {
 	flags := command.Flags()
 	serverSettings.AddFlags(flags)
 
-	options.viper = viper.NewWithOptions(viper.KeyDelimiter("\\"))
-	options.viper.SetEnvPrefix(product.Name)
-
 	return command
 }
 
@@ -56,38 +51,18 @@ func (o *serveOptions) run(settings *cmd.ServerSettings) error {
 
 	settings.InitRuntime()
 
-	o.viper.SetConfigType(settings.ConfigurationFile.Type.String())
-
-	configFileName := fmt.Sprintf("%s.%s", settings.ConfigurationFile.Name, settings.ConfigurationFile.Type.String())
-	logger.Debugw("configuration file search parameters",
-		"directories", settings.ConfigurationFile.SearchPaths,
-		"filename", configFileName)
-	o.viper.SetConfigName(configFileName)
-	for _, path := range settings.ConfigurationFile.SearchPaths {
-		o.viper.AddConfigPath(path)
-	}
-
-	if settings.ConfigurationFile.FullPath != "" {
-		logger.Debugw("using a configuration full path",
-			"path", settings.ConfigurationFile.FullPath)
-		o.viper.SetConfigFile(settings.ConfigurationFile.FullPath)
-	}
-
-	err := o.viper.ReadInConfig()
-	if err != nil {
-		logger.Fatalf("failed to load configuration file: %s", err)
-	}
-
-	logger.Debugw("parsing configuration file", "path", o.viper.ConfigFileUsed())
-	config := server.Configuration{}
-	if err := config.Unmarshal(o.viper); err != nil {
+	config, path, err := server.LoadConfiguration(settings.ConfigurationFile, logger)
+	var loadErr *server.LoadError
+	if errors.As(err, &loadErr) {
+		logger.Fatalf("%s", err)
+	} else if err != nil {
 		logger.Fatalf("failed to decode configuration: %s", err)
 	}
 
-	logger.Infow("successfully decoded configuration file", "path", o.viper.ConfigFileUsed())
+	logger.Infow("successfully decoded configuration file", "path", path)
 
 	server.Logger = logger // FIXME
-	server.NewServer(&config).Run()
+	server.NewServer(config).Run()
 
 	return nil
 }
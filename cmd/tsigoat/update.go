@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/client"
+	"github.com/enix/tsigoat/pkg/cmd"
+	"github.com/enix/tsigoat/pkg/types"
+	miekgdns "github.com/miekg/dns"
+
+	"github.com/spf13/cobra"
+)
+
+const updateDesc = `
+Send dynamic updates (RFC 2136) signed with a TSIG key, and print the response code and the status
+of the response signature.
+
+Operations are read from an nsupdate style SCRIPT, "-" reading it from the standard input, or given
+with the --add, --delete and --prereq flags using the same syntax as the script commands:
+
+  tsigoat update -s 127.0.0.1 -z example.org -k acme. --add "www 300 A 192.0.2.1"
+  tsigoat update -s 127.0.0.1 -z example.org -k acme. --prereq "nxrrset www A" --delete www
+
+Operations given with flags are sent first. The key is taken from -y, from a BIND key file with
+--key-file, or else looked up by its name in the server configuration file.
+
+With --dry-run, tsigoat servers evaluate the updates against the zone content and report the records
+they would add and delete, without applying them.
+
+The command exits with a non-zero status when an update fails or is not answered with NOERROR.
+`
+
+const (
+	updateText = "text"
+	updateJson = "json"
+)
+
+type updateOptions struct {
+	client        *clientOptions
+	zone          string
+	ttl           uint32
+	adds          []string
+	deletes       []string
+	prerequisites []string
+	dryRun        bool
+	output        *types.Enum
+}
+
+func newCmdUpdate(settings *cmd.Settings) *cobra.Command {
+	serverSettings := settings.ToServer()
+
+	options := &updateOptions{
+		client: newClientOptions(serverSettings.ConfigurationFile),
+		output: types.NewEnum(updateText, updateText, updateJson),
+	}
+	command := &cobra.Command{
+		Use:   "update [SCRIPT]",
+		Short: "Send signed dynamic updates",
+		Long:  updateDesc,
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			script := ""
+			if len(args) > 0 {
+				script = args[0]
+			}
+			// cobra would print errors a second time
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			return options.run(settings, script)
+		},
+	}
+
+	flags := command.Flags()
+	flags.StringVarP(&options.zone, "zone", "z", "", "Zone to update")
+	flags.Uint32Var(&options.ttl, "ttl", 3600, "TTL of added records when none is given")
+	flags.StringArrayVar(&options.adds, "add", nil, "Record to add, as \"name [ttl] [class] type data\"")
+	flags.StringArrayVar(&options.deletes, "delete", nil,
+		"Name, RRset or record to delete, as \"name [[ttl] [class] type [data]]\"")
+	flags.StringArrayVar(&options.prerequisites, "prereq", nil,
+		"Prerequisite, as \"nxdomain|yxdomain name\" or \"nxrrset|yxrrset name [class] type [data]\"")
+	flags.BoolVar(&options.dryRun, "dry-run", false, "Ask the server to report the changes without applying them")
+	flags.VarP(options.output, "output", "o",
+		fmt.Sprintf("Output format. Valid values are: %s.", strings.Join(options.output.AllowedValues(), ", ")))
+	options.client.addFlags(command)
+	serverSettings.AddConfigurationFlags(flags)
+
+	return command
+}
+
+func (o *updateOptions) run(settings *cmd.Settings, scriptPath string) error {
+	defaults := client.Request{Server: o.client.server, DryRun: o.dryRun}
+	if o.zone != "" {
+		defaults.Zone = miekgdns.Fqdn(o.zone)
+	}
+	key, err := o.client.resolveKey(settings)
+	if err != nil {
+		return err
+	}
+	defaults.Key = key
+
+	script := client.NewScript(defaults)
+	if err := script.Line(fmt.Sprintf("ttl %d", o.ttl)); err != nil {
+		return err
+	}
+	for _, prerequisite := range o.prerequisites {
+		if err := script.Line("prereq " + prerequisite); err != nil {
+			return fmt.Errorf("--prereq '%s': %w", prerequisite, err)
+		}
+	}
+	for _, record := range o.deletes {
+		if err := script.Line("delete " + record); err != nil {
+			return fmt.Errorf("--delete '%s': %w", record, err)
+		}
+	}
+	for _, record := range o.adds {
+		if err := script.Line("add " + record); err != nil {
+			return fmt.Errorf("--add '%s': %w", record, err)
+		}
+	}
+	if scriptPath != "" {
+		if err := script.Line("send"); err != nil {
+			return err
+		}
+		if err := o.parseScript(script, scriptPath); err != nil {
+			return err
+		}
+	}
+
+	requests := script.Requests()
+	if len(requests) == 0 {
+		return fmt.Errorf("no update to send, give a script or --add, --delete and --prereq flags")
+	}
+
+	sendOptions, err := o.client.sendOptions()
+	if err != nil {
+		return err
+	}
+
+	failures := 0
+	for _, request := range requests {
+		result := client.Send(request, sendOptions)
+		if !result.Succeeded() {
+			failures++
+		}
+		if err := o.print(settings.Stdout, result); err != nil {
+			return err
+		}
+	}
+	if failures > 0 {
+		return fmt.Errorf("%d of %d update(s) failed", failures, len(requests))
+	}
+	return nil
+}
+
+func (o *updateOptions) parseScript(script *client.Script, path string) error {
+	var reader io.Reader = os.Stdin
+	if path != "-" {
+		scriptFile, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer scriptFile.Close()
+		reader = scriptFile
+	}
+	if err := script.Parse(reader); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (o *updateOptions) print(out io.Writer, result *client.Result) error {
+	if o.output.String() == updateJson {
+		return json.NewEncoder(out).Encode(result)
+	}
+
+	status := result.Rcode
+	if len(result.Reasons) > 0 {
+		status = fmt.Sprintf("%s (%s)", status, strings.Join(result.Reasons, "; "))
+	}
+	if result.Error != "" {
+		status = "error: " + result.Error
+	}
+	if result.DryRun {
+		status += ", dry run"
+	} else if o.dryRun && result.Succeeded() {
+		// servers not knowing the option apply the update
+		status += ", dry run ignored by the server"
+	}
+	if _, err := fmt.Fprintf(out, "%s zone %s id %d: %s, tsig %s, %s\n", result.Server, result.Zone, result.Id,
+		status, result.Tsig, result.Rtt.Round(time.Microsecond)); err != nil {
+		return err
+	}
+	for _, change := range result.Changes {
+		if _, err := fmt.Fprintf(out, "  %s\n", change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
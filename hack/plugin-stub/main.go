@@ -0,0 +1,174 @@
+// An in-memory plugin for the plugin adapter, speaking the protocol over stdio,
+// or over a Unix socket with -socket. Zones are created empty on first use, and
+// all state is lost on exit. Requests of the method given with -stall are never
+// answered, to exercise timeouts.
+//
+// Usage in the configuration:
+//
+//	handlers:
+//	  - name: stub
+//	    adapter: plugin
+//	    plugin:
+//	      command: go
+//	      args: [run, ./hack/plugin-stub]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/enix/tsigoat/pkg/adapters/plugin"
+	"github.com/miekg/dns"
+)
+
+type rrsetKey struct {
+	name  string
+	rtype uint16
+}
+
+type zone map[rrsetKey][]string
+
+type transaction struct {
+	zone    string
+	records zone
+}
+
+var (
+	zones        = map[string]zone{}
+	transactions = map[string]*transaction{}
+	nextId       = 0
+)
+
+var (
+	socket = flag.String("socket", "", "Unix socket to listen on instead of using stdio")
+	stall  = flag.String("stall", "", "Method whose requests are never answered")
+)
+
+func main() {
+	flag.Parse()
+	log.SetOutput(os.Stderr)
+
+	if *socket == "" {
+		serve(os.Stdin, os.Stdout)
+		return
+	}
+
+	listener, err := net.Listen("unix", *socket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer listener.Close()
+
+	// one session at a time, sharing the zones
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Fatal(err)
+		}
+		serve(conn, conn)
+		conn.Close()
+	}
+}
+
+func serve(reader io.Reader, writer io.Writer) {
+	decoder := json.NewDecoder(reader)
+	encoder := json.NewEncoder(writer)
+
+	for {
+		request := &plugin.Request{}
+		if err := decoder.Decode(request); err != nil {
+			log.Printf("ending session: %s", err)
+			return
+		}
+		if request.Method == *stall {
+			log.Printf("stalling %s", request.Method)
+			continue
+		}
+
+		response, err := handle(request)
+		if err != nil {
+			response = &plugin.Response{Error: err.Error()}
+		}
+		response.Id = request.Id
+
+		if err := encoder.Encode(response); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func handle(request *plugin.Request) (*plugin.Response, error) {
+	log.Printf("%s %s %s %s", request.Method, request.Transaction, request.Name, request.Type)
+
+	if request.Method == plugin.MethodHello {
+		return &plugin.Response{Version: plugin.ProtocolVersion}, nil
+	}
+
+	if request.Method == plugin.MethodListZones {
+		return &plugin.Response{Zones: slices.Collect(maps.Keys(zones))}, nil
+	}
+
+	if request.Method == plugin.MethodBegin {
+		name := dns.CanonicalName(request.Zone)
+		if _, found := zones[name]; !found {
+			zones[name] = zone{}
+		}
+		nextId++
+		id := strconv.Itoa(nextId)
+		transactions[id] = &transaction{name, maps.Clone(zones[name])}
+		return &plugin.Response{Transaction: id}, nil
+	}
+
+	t, found := transactions[request.Transaction]
+	if !found {
+		return nil, fmt.Errorf("unknown transaction '%s'", request.Transaction)
+	}
+
+	switch request.Method {
+	case plugin.MethodGetAll:
+		var records []string
+		for key, set := range t.records {
+			if key.name == dns.CanonicalName(request.Name) {
+				records = append(records, set...)
+			}
+		}
+		return &plugin.Response{Records: records}, nil
+	case plugin.MethodGetSet:
+		key := rrsetKey{dns.CanonicalName(request.Name), dns.StringToType[request.Type]}
+		return &plugin.Response{Records: t.records[key]}, nil
+	case plugin.MethodAddSet, plugin.MethodChangeSet:
+		if len(request.Records) == 0 {
+			return nil, fmt.Errorf("empty set")
+		}
+		rr, err := dns.NewRR(request.Records[0])
+		if err != nil {
+			return nil, err
+		}
+		key := rrsetKey{dns.CanonicalName(rr.Header().Name), rr.Header().Rrtype}
+		if _, exists := t.records[key]; exists && request.Method == plugin.MethodAddSet {
+			return nil, fmt.Errorf("set exists")
+		}
+		t.records[key] = request.Records
+		return &plugin.Response{}, nil
+	case plugin.MethodDeleteSet:
+		delete(t.records, rrsetKey{dns.CanonicalName(request.Name), dns.StringToType[request.Type]})
+		return &plugin.Response{}, nil
+	case plugin.MethodCommit:
+		zones[t.zone] = t.records
+		delete(transactions, request.Transaction)
+		return &plugin.Response{}, nil
+	case plugin.MethodRollback:
+		delete(transactions, request.Transaction)
+		return &plugin.Response{}, nil
+	default:
+		return nil, fmt.Errorf("unknown method '%s'", request.Method)
+	}
+}
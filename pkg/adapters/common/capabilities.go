@@ -0,0 +1,50 @@
+package common
+
+import (
+	"slices"
+)
+
+// Features of a backend, as known from its configuration
+type Capabilities struct {
+	// Supported RR types, any type when nil
+	Types []uint16
+	// Changes are applied on commit and can be rolled back
+	Transactional bool
+	// Maximum number of records in a RRset, no limit when zero
+	MaxRRsetSize int
+	// RRset comments are kept by updates
+	Comments bool
+	// Zones may be signed by the backend
+	DNSSEC bool
+}
+
+func (c Capabilities) SupportsType(rrType uint16) bool {
+	return c.Types == nil || slices.Contains(c.Types, rrType)
+}
+
+// Returns the capabilities shared by both sides
+func (c Capabilities) Intersect(other Capabilities) Capabilities {
+	result := Capabilities{
+		Types:         c.Types,
+		Transactional: c.Transactional && other.Transactional,
+		MaxRRsetSize:  c.MaxRRsetSize,
+		Comments:      c.Comments && other.Comments,
+		DNSSEC:        c.DNSSEC && other.DNSSEC,
+	}
+
+	if c.Types == nil {
+		result.Types = other.Types
+	} else if other.Types != nil {
+		result.Types = make([]uint16, 0)
+		for _, rrType := range c.Types {
+			if slices.Contains(other.Types, rrType) {
+				result.Types = append(result.Types, rrType)
+			}
+		}
+	}
+
+	if result.MaxRRsetSize == 0 || (other.MaxRRsetSize > 0 && other.MaxRRsetSize < result.MaxRRsetSize) {
+		result.MaxRRsetSize = other.MaxRRsetSize
+	}
+	return result
+}
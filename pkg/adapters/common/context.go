@@ -0,0 +1,18 @@
+package common
+
+import "context"
+
+type contextKey int
+
+const issuerContextKey contextKey = iota
+
+// Returns a copy of the context carrying the name of the key which signed the update
+func ContextWithIssuer(ctx context.Context, issuer string) context.Context {
+	return context.WithValue(ctx, issuerContextKey, issuer)
+}
+
+// Returns the name of the key which signed the update, if it was authenticated
+func IssuerFromContext(ctx context.Context) (string, bool) {
+	issuer, ok := ctx.Value(issuerContextKey).(string)
+	return issuer, ok
+}
@@ -1,15 +1,41 @@
 package common
 
 import (
+	"context"
+	"errors"
+
 	miekgdns "github.com/miekg/dns"
 	"go.uber.org/zap"
 )
 
+var (
+	ErrRollbackNotSupported = errors.New("rollback is not supported by this adapter")
+	ErrNotAuthoritative     = errors.New("backend is not authoritative for the zone")
+)
+
+// Fields holding secrets, such as API keys, are tagged `sensitive:"true"` to be redacted from dumps
 type IAdapterConfiguration interface{}
 
+// Implemented by adapter configurations with defaults for unset settings, applied by the adapter
+// factory and by configuration dumps
+type IAdapterDefaults interface {
+	SetDefaults()
+}
+
 type IAdapter interface {
 	Name() string
-	NewTransaction(string, *zap.SugaredLogger) (IAdapterTransaction, error)
+	Capabilities() Capabilities
+	NewTransaction(context.Context, string, *zap.SugaredLogger) (IAdapterTransaction, error)
+}
+
+// Implemented by adapters able to enumerate the zones hosted by their backend
+type IZoneLister interface {
+	ListZones(context.Context) ([]string, error)
+}
+
+// Implemented by adapters referencing other handlers, called once all handlers are created
+type IAdapterLinker interface {
+	Link(func(string) (IAdapter, bool)) error
 }
 
 type IAdapterTransaction interface {
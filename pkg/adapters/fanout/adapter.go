@@ -0,0 +1,150 @@
+package fanout
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/enix/tsigoat/pkg/adapters/common"
+	"go.uber.org/zap"
+)
+
+const FanoutAdapterSlug common.AdapterSlug = "fanout"
+
+const (
+	PrimaryRole = "primary"
+	MirrorRole  = "mirror"
+)
+
+type FanoutAdapterConfiguration struct {
+	Handlers []FanoutHandlerConfiguration `validate:"gt=1,unique=Name,dive"`
+}
+
+type FanoutHandlerConfiguration struct {
+	Name string `validate:"required,printascii"`
+	Role string `validate:"required,oneof=primary mirror"`
+	// Mirrors only, a failing required mirror fails the whole update
+	Required bool
+}
+
+type fanoutChild struct {
+	name     string
+	required bool
+	adapter  common.IAdapter
+}
+
+type FanoutAdapter struct {
+	name    string
+	config  *FanoutAdapterConfiguration
+	primary *fanoutChild
+	mirrors []*fanoutChild
+	logger  *zap.SugaredLogger
+}
+
+func NewFanoutAdapter(name string, config common.IAdapterConfiguration, logger *zap.SugaredLogger) (adapter common.IAdapter, err error) {
+	var fanoutConfig *FanoutAdapterConfiguration
+
+	switch value := config.(type) {
+	case *FanoutAdapterConfiguration:
+		fanoutConfig = value
+	default:
+		panic("invalid config type for this adapter")
+	}
+
+	primaries := 0
+	for _, child := range fanoutConfig.Handlers {
+		if child.Role == PrimaryRole {
+			primaries++
+			if child.Required {
+				logger.Warnw("the required flag is meaningless on a primary handler", "name", name, "handler", child.Name)
+			}
+		}
+	}
+	if primaries != 1 {
+		return nil, fmt.Errorf("fan-out handler '%s' must have exactly one primary handler, found %d", name, primaries)
+	}
+
+	logger.Debugw("creating a fan-out adapter", "name", name, "handlers", len(fanoutConfig.Handlers))
+
+	adapter = &FanoutAdapter{
+		name:   name,
+		config: fanoutConfig,
+		logger: logger,
+	}
+	return
+}
+
+func (a *FanoutAdapter) Name() string {
+	return a.name
+}
+
+// Zones are those of the primary handler
+func (a *FanoutAdapter) ListZones(ctx context.Context) ([]string, error) {
+	if a.primary == nil {
+		panic("fan-out adapter used before being linked")
+	}
+
+	lister, ok := a.primary.adapter.(common.IZoneLister)
+	if !ok {
+		return nil, fmt.Errorf("Fanout.ListZones: primary '%s' cannot list zones", a.primary.name)
+	}
+	return lister.ListZones(ctx)
+}
+
+// Best-effort mirrors are left out, as they don't decide for the outcome of an update.
+// Commits are not atomic across handlers, being transactional here only means every handler is.
+func (a *FanoutAdapter) Capabilities() common.Capabilities {
+	if a.primary == nil {
+		panic("fan-out adapter used before being linked")
+	}
+
+	capabilities := a.primary.adapter.Capabilities()
+	for _, child := range a.mirrors {
+		if child.required {
+			capabilities = capabilities.Intersect(child.adapter.Capabilities())
+		}
+	}
+	return capabilities
+}
+
+// Children are resolved again on every call, so linking twice doesn't duplicate mirrors
+func (a *FanoutAdapter) Link(lookup func(string) (common.IAdapter, bool)) error {
+	var (
+		primary *fanoutChild
+		mirrors []*fanoutChild
+	)
+
+	for _, config := range a.config.Handlers {
+		if config.Name == a.name {
+			return fmt.Errorf("fan-out handler '%s' references itself", a.name)
+		}
+
+		adapter, found := lookup(config.Name)
+		if !found {
+			return fmt.Errorf("fan-out handler '%s' references an unknown handler '%s'", a.name, config.Name)
+		}
+
+		// keeps the handler graph free of cycles
+		if _, nested := adapter.(common.IAdapterLinker); nested {
+			return fmt.Errorf("fan-out handler '%s' references '%s', nested fan-out handlers are not supported",
+				a.name, config.Name)
+		}
+
+		child := &fanoutChild{
+			name:     config.Name,
+			required: config.Required,
+			adapter:  adapter,
+		}
+		if config.Role == PrimaryRole {
+			primary = child
+		} else {
+			mirrors = append(mirrors, child)
+		}
+
+		a.logger.Debugw("linked fan-out child handler", "name", a.name, "handler", config.Name, "role", config.Role,
+			"required", config.Required, "object", fmt.Sprintf("%p", adapter))
+	}
+
+	a.primary = primary
+	a.mirrors = mirrors
+	return nil
+}
@@ -0,0 +1,79 @@
+package fanout
+
+import (
+	"context"
+	"testing"
+
+	"github.com/enix/tsigoat/pkg/adapters/common"
+	"github.com/enix/tsigoat/pkg/adapters/memory"
+	miekgdns "github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+func newTestChildren(t *testing.T) map[string]common.IAdapter {
+	t.Helper()
+
+	children := make(map[string]common.IAdapter)
+	for _, name := range []string{"primary", "mirror"} {
+		adapter, err := memory.NewMemoryAdapter(name, &memory.MemoryAdapterConfiguration{
+			Records: []string{"example.test. 3600 IN SOA ns1.example.test. hostmaster.example.test. 1 3600 600 86400 300"},
+		}, zap.NewNop().Sugar())
+		if err != nil {
+			t.Fatalf("NewMemoryAdapter: %v", err)
+		}
+		children[name] = adapter
+	}
+	return children
+}
+
+func TestLinkTwice(t *testing.T) {
+	children := newTestChildren(t)
+	lookup := func(name string) (common.IAdapter, bool) {
+		adapter, found := children[name]
+		return adapter, found
+	}
+
+	adapter, err := NewFanoutAdapter("fanout", &FanoutAdapterConfiguration{
+		Handlers: []FanoutHandlerConfiguration{
+			{Name: "primary", Role: PrimaryRole},
+			{Name: "mirror", Role: MirrorRole, Required: true},
+		},
+	}, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewFanoutAdapter: %v", err)
+	}
+	fanout := adapter.(*FanoutAdapter)
+	for range 2 {
+		if err := fanout.Link(lookup); err != nil {
+			t.Fatalf("Link: %v", err)
+		}
+	}
+	if len(fanout.mirrors) != 1 {
+		t.Fatalf("expected a single mirror after linking twice, got %d", len(fanout.mirrors))
+	}
+
+	tx, err := fanout.NewTransaction(context.Background(), "example.test.", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	rr, _ := miekgdns.NewRR("www.example.test. 300 IN A 192.0.2.1")
+	if err := tx.AddSet([]miekgdns.RR{rr}); err != nil {
+		t.Fatalf("AddSet: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	mirrorTx, err := children["mirror"].NewTransaction(context.Background(), "example.test.", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	defer mirrorTx.Rollback()
+	set, err := mirrorTx.GetSet("www.example.test.", miekgdns.TypeA)
+	if err != nil {
+		t.Fatalf("GetSet: %v", err)
+	}
+	if len(set) != 1 {
+		t.Errorf("expected the mirror to get the record once, got %d records", len(set))
+	}
+}
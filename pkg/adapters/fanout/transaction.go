@@ -0,0 +1,165 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/enix/tsigoat/pkg/adapters/common"
+	miekgdns "github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+type mirrorTransaction struct {
+	child       *fanoutChild
+	transaction common.IAdapterTransaction
+}
+
+type FanoutAdapterTransaction struct {
+	zone    string
+	primary common.IAdapterTransaction
+	mirrors []*mirrorTransaction
+	logger  *zap.SugaredLogger
+}
+
+func (a *FanoutAdapter) NewTransaction(ctx context.Context, zone string, logger *zap.SugaredLogger) (common.IAdapterTransaction, error) {
+	if a.primary == nil {
+		panic("fan-out adapter used before being linked")
+	}
+
+	primary, err := a.primary.adapter.NewTransaction(ctx, zone, logger)
+	if err != nil {
+		return nil, fmt.Errorf("Fanout.NewTransaction: primary '%s': %w", a.primary.name, err)
+	}
+
+	t := &FanoutAdapterTransaction{
+		zone:    zone,
+		primary: primary,
+		logger:  logger,
+	}
+
+	for _, child := range a.mirrors {
+		transaction, err := child.adapter.NewTransaction(ctx, zone, logger)
+		if err != nil {
+			if child.required {
+				if rbErr := t.Rollback(); rbErr != nil {
+					logger.Warnw("failed to rollback the handlers opened before a required mirror failed", "handler", child.name,
+						"error", rbErr.Error())
+				}
+				return nil, fmt.Errorf("Fanout.NewTransaction: required mirror '%s': %w", child.name, err)
+			}
+			logger.Warnw("skipping best-effort mirror for this update", "handler", child.name, "error", err.Error())
+			continue
+		}
+		t.mirrors = append(t.mirrors, &mirrorTransaction{child, transaction})
+	}
+	return t, nil
+}
+
+func (t *FanoutAdapterTransaction) Zone() string {
+	return t.zone
+}
+
+// Reads are served by the primary only
+func (t *FanoutAdapterTransaction) GetAll(rrName string) (map[uint16][]miekgdns.RR, error) {
+	return t.primary.GetAll(rrName)
+}
+
+func (t *FanoutAdapterTransaction) GetSet(rrName string, rrType uint16) ([]miekgdns.RR, error) {
+	return t.primary.GetSet(rrName, rrType)
+}
+
+func (t *FanoutAdapterTransaction) AddSet(RRset []miekgdns.RR) error {
+	return t.apply("AddSet", func(transaction common.IAdapterTransaction) error {
+		return transaction.AddSet(RRset)
+	})
+}
+
+func (t *FanoutAdapterTransaction) ChangeSet(RRset []miekgdns.RR) error {
+	return t.apply("ChangeSet", func(transaction common.IAdapterTransaction) error {
+		return transaction.ChangeSet(RRset)
+	})
+}
+
+func (t *FanoutAdapterTransaction) DeleteSet(name string, recordType uint16) error {
+	return t.apply("DeleteSet", func(transaction common.IAdapterTransaction) error {
+		return transaction.DeleteSet(name, recordType)
+	})
+}
+
+// Writes go to the primary first, then to every mirror still part of the update.
+// A failing best-effort mirror is rolled back and left out for the rest of the update.
+func (t *FanoutAdapterTransaction) apply(operation string, fn func(common.IAdapterTransaction) error) error {
+	if err := fn(t.primary); err != nil {
+		return fmt.Errorf("Fanout.%s: primary: %w", operation, err)
+	}
+
+	// the list is rebuilt aside, so that it never holds a mirror twice nor a dropped one
+	kept := make([]*mirrorTransaction, 0, len(t.mirrors))
+	for idx, mirror := range t.mirrors {
+		if err := fn(mirror.transaction); err != nil {
+			if mirror.child.required {
+				t.mirrors = append(kept, t.mirrors[idx:]...)
+				return fmt.Errorf("Fanout.%s: required mirror '%s': %w", operation, mirror.child.name, err)
+			}
+			t.logger.Warnw("best-effort mirror failed, dropping it from this update", "handler", mirror.child.name,
+				"operation", operation, "error", err.Error())
+			if err := mirror.transaction.Rollback(); err != nil {
+				t.logger.Warnw("failed to rollback best-effort mirror", "handler", mirror.child.name, "error", err.Error())
+			}
+			continue
+		}
+		kept = append(kept, mirror)
+	}
+	t.mirrors = kept
+	return nil
+}
+
+// The primary is committed first and its outcome decides for the mirrors.
+// Required mirrors failing after that are reported, as the primary can't be reverted anymore.
+func (t *FanoutAdapterTransaction) Commit() error {
+	if err := t.primary.Commit(); err != nil {
+		for _, mirror := range t.mirrors {
+			if rbErr := mirror.transaction.Rollback(); rbErr != nil {
+				t.logger.Warnw("failed to rollback mirror after primary commit failure", "handler", mirror.child.name,
+					"error", rbErr.Error())
+			}
+		}
+		return fmt.Errorf("Fanout.Commit: primary: %w", err)
+	}
+
+	var errs []error
+	for _, mirror := range t.mirrors {
+		if err := mirror.transaction.Commit(); err != nil {
+			if mirror.child.required {
+				t.logger.Errorw("required mirror failed to commit after the primary", "handler", mirror.child.name,
+					"error", err.Error())
+				errs = append(errs, fmt.Errorf("required mirror '%s': %w", mirror.child.name, err))
+			} else {
+				t.logger.Warnw("best-effort mirror failed to commit", "handler", mirror.child.name, "error", err.Error())
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("Fanout.Commit: %w", err)
+	}
+	return nil
+}
+
+func (t *FanoutAdapterTransaction) Rollback() error {
+	var errs []error
+
+	if err := t.primary.Rollback(); err != nil {
+		errs = append(errs, fmt.Errorf("primary: %w", err))
+	}
+	for _, mirror := range t.mirrors {
+		if err := mirror.transaction.Rollback(); err != nil {
+			errs = append(errs, fmt.Errorf("mirror '%s': %w", mirror.child.name, err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("Fanout.Rollback: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package fanout
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/enix/tsigoat/pkg/adapters/common"
+	miekgdns "github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+// A transaction failing its writes when told to, counting its rollbacks
+type countingTransaction struct {
+	common.IAdapterTransaction
+	fail      bool
+	rollbacks int
+}
+
+func (t *countingTransaction) AddSet([]miekgdns.RR) error {
+	if t.fail {
+		return errors.New("write failed")
+	}
+	return nil
+}
+
+func (t *countingTransaction) Rollback() error {
+	t.rollbacks++
+	if t.rollbacks > 1 {
+		return errors.New("already rolled back")
+	}
+	return nil
+}
+
+// Mirrors dropped or failing are rolled back exactly once
+func TestApplyRequiredMirrorFailure(t *testing.T) {
+	primary := &countingTransaction{}
+	bestEffort := &countingTransaction{fail: true}
+	healthy := &countingTransaction{}
+	required := &countingTransaction{fail: true}
+	tx := &FanoutAdapterTransaction{
+		zone:    "example.test.",
+		primary: primary,
+		mirrors: []*mirrorTransaction{
+			{&fanoutChild{name: "best-effort"}, bestEffort},
+			{&fanoutChild{name: "healthy"}, healthy},
+			{&fanoutChild{name: "required", required: true}, required},
+		},
+		logger: zap.NewNop().Sugar(),
+	}
+
+	if err := tx.AddSet(nil); err == nil {
+		t.Fatal("AddSet succeeded despite a failing required mirror")
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Errorf("Rollback: %v", err)
+	}
+
+	transactions := map[string]*countingTransaction{
+		"primary":     primary,
+		"best-effort": bestEffort,
+		"healthy":     healthy,
+		"required":    required,
+	}
+	for name, transaction := range transactions {
+		if transaction.rollbacks != 1 {
+			t.Errorf("%s: rolled back %d times, expected once", name, transaction.rollbacks)
+		}
+	}
+}
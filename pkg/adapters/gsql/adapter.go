@@ -0,0 +1,126 @@
+package gsql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/adapters/common"
+	"go.uber.org/zap"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+const GenericSQLAdapterSlug common.AdapterSlug = "gsql"
+
+const (
+	SoaEditIncrement = "increment"
+	SoaEditEpoch     = "epoch"
+	SoaEditDate      = "date"
+	SoaEditNone      = "none"
+)
+
+type GenericSQLAdapterConfiguration struct {
+	Driver          string `validate:"required,oneof=mysql postgres sqlite"`
+	Dsn             string `validate:"required" sensitive:"true"`
+	Dnssec          bool
+	SoaEdit         string        `validate:"omitempty,oneof=increment epoch date none"`
+	MaxOpenConns    int           `validate:"gte=0"`
+	MaxIdleConns    int           `validate:"gte=0"`
+	ConnMaxLifetime time.Duration `validate:"gte=0"`
+}
+
+type GenericSQLAdapter struct {
+	name    string
+	config  *GenericSQLAdapterConfiguration
+	dialect dialect
+	db      *sql.DB
+	logger  *zap.SugaredLogger
+}
+
+func (c *GenericSQLAdapterConfiguration) SetDefaults() {
+	if c.SoaEdit == "" {
+		c.SoaEdit = SoaEditIncrement
+	}
+}
+
+func NewGenericSQLAdapter(name string, config common.IAdapterConfiguration, logger *zap.SugaredLogger) (adapter common.IAdapter, err error) {
+	var sqlConfig *GenericSQLAdapterConfiguration
+
+	switch value := config.(type) {
+	case *GenericSQLAdapterConfiguration:
+		sqlConfig = value
+	default:
+		panic("invalid config type for this adapter")
+	}
+
+	sqlConfig.SetDefaults()
+
+	dialect, err := newDialect(sqlConfig.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	// sql.Open does not connect, the pool is filled lazily on first use
+	db, err := sql.Open(dialect.driverName(), sqlConfig.Dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", sqlConfig.Driver, err)
+	}
+	if sqlConfig.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(sqlConfig.MaxOpenConns)
+	}
+	if sqlConfig.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(sqlConfig.MaxIdleConns)
+	}
+	if sqlConfig.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(sqlConfig.ConnMaxLifetime)
+	}
+
+	logger.Debugw("creating a generic SQL adapter", "name", name, "driver", sqlConfig.Driver,
+		"dnssec", sqlConfig.Dnssec, "soa_edit", sqlConfig.SoaEdit)
+
+	adapter = &GenericSQLAdapter{
+		name,
+		sqlConfig,
+		dialect,
+		db,
+		logger,
+	}
+	return
+}
+
+func (a *GenericSQLAdapter) Name() string {
+	return a.name
+}
+
+func (a *GenericSQLAdapter) ListZones(ctx context.Context) ([]string, error) {
+	rows, err := a.db.QueryContext(ctx, "SELECT name FROM domains")
+	if err != nil {
+		return nil, fmt.Errorf("GenericSQL.ListZones: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("GenericSQL.ListZones: %w", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GenericSQL.ListZones: %w", err)
+	}
+	return names, nil
+}
+
+// Comments are stored in a table of their own, which is not handled yet
+func (a *GenericSQLAdapter) Capabilities() common.Capabilities {
+	return common.Capabilities{
+		Transactional: true,
+		DNSSEC:        a.config.Dnssec,
+	}
+}
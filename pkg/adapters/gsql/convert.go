@@ -0,0 +1,87 @@
+package gsql
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	miekgdns "github.com/miekg/dns"
+)
+
+// The generic SQL schema stores owner names lowercased and without the trailing dot
+func nativeNameOf(name string) string {
+	name = strings.ToLower(name)
+	if name == "." {
+		return name
+	}
+	return strings.TrimSuffix(name, ".")
+}
+
+func dnsNameOf(name string) string {
+	return miekgdns.Fqdn(name)
+}
+
+func nativeTypeOf(rrType uint16) (string, error) {
+	name, found := miekgdns.TypeToString[rrType]
+	if !found {
+		return "", fmt.Errorf("resource record type not supported by the generic SQL adapter: %d", rrType)
+	}
+	return name, nil
+}
+
+func dnsTypeOf(nType string) (uint16, error) {
+	rrType, found := miekgdns.StringToType[nType]
+	if !found {
+		return 0, fmt.Errorf("resource record type not supported by the generic SQL adapter: %s", nType)
+	}
+	return rrType, nil
+}
+
+// Content is stored in presentation format, except that domain names in the
+// rdata do not carry a trailing dot. Priorities of MX and SRV records are part
+// of the content since PowerDNS 4.0, the prio column is left untouched.
+func nativeContentOf(rr miekgdns.RR) (string, error) {
+	rr = miekgdns.Copy(rr)
+
+	value := reflect.ValueOf(rr).Elem()
+	for idx := 0; idx < value.NumField(); idx++ {
+		tag := value.Type().Field(idx).Tag.Get("dns")
+		if tag != "domain-name" && tag != "cdomain-name" {
+			continue
+		}
+
+		field := value.Field(idx)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(nativeNameOf(field.String()))
+		case reflect.Slice:
+			for jdx := 0; jdx < field.Len(); jdx++ {
+				field.Index(jdx).SetString(nativeNameOf(field.Index(jdx).String()))
+			}
+		}
+	}
+
+	content, found := strings.CutPrefix(rr.String(), rr.Header().String())
+	if !found {
+		return "", fmt.Errorf("failed to extract rdata from %s record", miekgdns.TypeToString[rr.Header().Rrtype])
+	}
+	return content, nil
+}
+
+func makeDnsRR(name string, nType string, ttl uint32, content string) (miekgdns.RR, error) {
+	if _, err := dnsTypeOf(nType); err != nil {
+		return nil, err
+	}
+
+	// Relative names in the content are made absolute by using the root as origin
+	zp := miekgdns.NewZoneParser(strings.NewReader(
+		fmt.Sprintf("%s %d IN %s %s", dnsNameOf(name), ttl, nType, content)), ".", "")
+	rr, ok := zp.Next()
+	if err := zp.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse %s record content '%s': %w", nType, content, err)
+	}
+	if !ok || rr == nil {
+		return nil, fmt.Errorf("failed to parse %s record content '%s'", nType, content)
+	}
+	return rr, nil
+}
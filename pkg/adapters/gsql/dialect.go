@@ -0,0 +1,50 @@
+package gsql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type dialect string
+
+const (
+	mysqlDialect    dialect = "mysql"
+	postgresDialect dialect = "postgres"
+	sqliteDialect   dialect = "sqlite"
+)
+
+func newDialect(driver string) (dialect, error) {
+	switch dialect(driver) {
+	case mysqlDialect, postgresDialect, sqliteDialect:
+		return dialect(driver), nil
+	default:
+		return "", fmt.Errorf("unsupported SQL driver '%s'", driver)
+	}
+}
+
+// The name registered by the database/sql driver
+func (d dialect) driverName() string {
+	return string(d)
+}
+
+// Queries are written with '?' placeholders, PostgreSQL wants them numbered
+func (d dialect) rebind(query string) string {
+	if d != postgresDialect {
+		return query
+	}
+
+	var s strings.Builder
+	s.Grow(len(query) + 8)
+	position := 0
+	for idx := 0; idx < len(query); idx++ {
+		if query[idx] == '?' {
+			position++
+			s.WriteByte('$')
+			s.WriteString(strconv.Itoa(position))
+			continue
+		}
+		s.WriteByte(query[idx])
+	}
+	return s.String()
+}
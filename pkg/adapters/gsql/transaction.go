@@ -0,0 +1,403 @@
+package gsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/adapters/common"
+	miekgdns "github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+type GenericSQLAdapterTransaction struct {
+	ctx        context.Context
+	zone       string
+	domainId   int64
+	nsec3      *miekgdns.NSEC3PARAM
+	tx         *sql.Tx
+	adapter    *GenericSQLAdapter
+	logger     *zap.SugaredLogger
+	dirty      bool
+	soaChanged bool
+}
+
+func (a *GenericSQLAdapter) NewTransaction(ctx context.Context, zone string, logger *zap.SugaredLogger) (common.IAdapterTransaction, error) {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("GenericSQL.NewTransaction: %w", err)
+	}
+
+	t := &GenericSQLAdapterTransaction{
+		ctx:     ctx,
+		zone:    zone,
+		tx:      tx,
+		adapter: a,
+		logger:  logger,
+	}
+
+	if err := t.init(); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			logger.Errorw("failed to rollback database transaction", "error", rbErr.Error())
+		}
+		return nil, fmt.Errorf("GenericSQL.NewTransaction: %w", err)
+	}
+	return t, nil
+}
+
+func (t *GenericSQLAdapterTransaction) init() error {
+	row := t.tx.QueryRowContext(t.ctx, t.rebind("SELECT id FROM domains WHERE name = ?"), nativeNameOf(t.zone))
+	if err := row.Scan(&t.domainId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("zone '%s' not found in the domains table", t.zone)
+		}
+		return fmt.Errorf("failed to get domain: %w", err)
+	}
+	t.logger.Debugw("found zone in the domains table", "zone", t.zone, "domain_id", t.domainId)
+
+	if !t.adapter.config.Dnssec {
+		return nil
+	}
+
+	var content string
+	row = t.tx.QueryRowContext(t.ctx, t.rebind("SELECT content FROM domainmetadata WHERE domain_id = ? AND kind = 'NSEC3PARAM'"),
+		t.domainId)
+	if err := row.Scan(&content); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			t.logger.Debugw("zone uses NSEC ordering", "zone", t.zone)
+			return nil
+		}
+		return fmt.Errorf("failed to get NSEC3PARAM metadata: %w", err)
+	}
+
+	rr, err := makeDnsRR(t.zone, "NSEC3PARAM", 0, content)
+	if err != nil {
+		return fmt.Errorf("invalid NSEC3PARAM metadata: %w", err)
+	}
+	t.nsec3 = rr.(*miekgdns.NSEC3PARAM)
+	t.logger.Debugw("zone uses NSEC3 ordering", "zone", t.zone, "iterations", t.nsec3.Iterations)
+	return nil
+}
+
+func (t *GenericSQLAdapterTransaction) rebind(query string) string {
+	return t.adapter.dialect.rebind(query)
+}
+
+func (t *GenericSQLAdapterTransaction) Zone() string {
+	return t.zone
+}
+
+func (t *GenericSQLAdapterTransaction) query(query string, args ...any) (rrs []miekgdns.RR, retErr error) {
+	rows, err := t.tx.QueryContext(t.ctx, t.rebind(query), args...)
+	if err != nil {
+		retErr = err
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			name    string
+			nType   string
+			content string
+			ttl     uint32
+		)
+		if err := rows.Scan(&name, &nType, &content, &ttl); err != nil {
+			retErr = err
+			return
+		}
+
+		rr, err := makeDnsRR(name, nType, ttl, content)
+		if err != nil {
+			retErr = err
+			return
+		}
+		rrs = append(rrs, rr)
+	}
+	retErr = rows.Err()
+	return
+}
+
+func (t *GenericSQLAdapterTransaction) GetAll(rrName string) (RRsets map[uint16][]miekgdns.RR, retErr error) {
+	t.logger.Debugw("querying database for all records with name", "name", rrName)
+	RRsets = make(map[uint16][]miekgdns.RR)
+
+	rrs, err := t.query("SELECT name, type, content, ttl FROM records "+
+		"WHERE domain_id = ? AND name = ? AND type IS NOT NULL AND type <> '' AND disabled = ?",
+		t.domainId, nativeNameOf(rrName), false)
+	if err != nil {
+		retErr = fmt.Errorf("GenericSQL.GetAll: %w", err)
+		return
+	}
+
+	for _, rr := range rrs {
+		rrType := rr.Header().Rrtype
+		RRsets[rrType] = append(RRsets[rrType], rr)
+	}
+
+	t.logger.Debugw("sorted records by type", "name", rrName, "count", len(rrs), "types", len(RRsets))
+	return
+}
+
+func (t *GenericSQLAdapterTransaction) GetSet(rrName string, rrType uint16) (RRset []miekgdns.RR, retErr error) {
+	t.logger.Debugw("querying database for records of name and type", "name", rrName, "type", miekgdns.TypeToString[rrType])
+
+	nType, err := nativeTypeOf(rrType)
+	if err != nil {
+		retErr = fmt.Errorf("GenericSQL.GetSet: %w", err)
+		return
+	}
+
+	RRset, err = t.query("SELECT name, type, content, ttl FROM records "+
+		"WHERE domain_id = ? AND name = ? AND type = ? AND disabled = ?",
+		t.domainId, nativeNameOf(rrName), nType, false)
+	if err != nil {
+		retErr = fmt.Errorf("GenericSQL.GetSet: %w", err)
+		return
+	}
+
+	t.logger.Debugw("got records from the database", "name", rrName, "type", miekgdns.TypeToString[rrType], "count", len(RRset))
+	return
+}
+
+func (t *GenericSQLAdapterTransaction) AddSet(RRset []miekgdns.RR) error {
+	t.logger.Debugw("inserting a new RRset in the database", "size", len(RRset))
+
+	if err := t.insertSet(RRset); err != nil {
+		return fmt.Errorf("GenericSQL.AddSet: %w", err)
+	}
+	return nil
+}
+
+func (t *GenericSQLAdapterTransaction) ChangeSet(RRset []miekgdns.RR) error {
+	t.logger.Debugw("replacing a RRset in the database", "size", len(RRset))
+
+	if !miekgdns.IsRRset(RRset) {
+		return fmt.Errorf("GenericSQL.ChangeSet: invalid set")
+	}
+
+	// Disabled records are not visible to the update logic, they are left untouched
+	if err := t.deleteSet(RRset[0].Header().Name, RRset[0].Header().Rrtype); err != nil {
+		return fmt.Errorf("GenericSQL.ChangeSet: %w", err)
+	}
+	if err := t.insertSet(RRset); err != nil {
+		return fmt.Errorf("GenericSQL.ChangeSet: %w", err)
+	}
+	return nil
+}
+
+func (t *GenericSQLAdapterTransaction) DeleteSet(name string, recordType uint16) error {
+	t.logger.Debugw("deleting a RRset from the database", "name", name, "type", miekgdns.TypeToString[recordType])
+
+	if err := t.deleteSet(name, recordType); err != nil {
+		return fmt.Errorf("GenericSQL.DeleteSet: %w", err)
+	}
+	return nil
+}
+
+func (t *GenericSQLAdapterTransaction) insertSet(RRset []miekgdns.RR) error {
+	// It does check for len(RRset)
+	if !miekgdns.IsRRset(RRset) {
+		return fmt.Errorf("invalid set")
+	}
+
+	header := RRset[0].Header()
+	if header.Class != miekgdns.ClassINET {
+		return fmt.Errorf("the generic SQL schema only supports the INET class")
+	}
+
+	nType, err := nativeTypeOf(header.Rrtype)
+	if err != nil {
+		return err
+	}
+
+	auth, delegated, err := t.authOf(header.Name, header.Rrtype)
+	if err != nil {
+		return err
+	}
+	ordername := t.ordernameOf(header.Name, delegated)
+
+	for _, rr := range RRset {
+		content, err := nativeContentOf(rr)
+		if err != nil {
+			return err
+		}
+
+		_, err = t.tx.ExecContext(t.ctx, t.rebind("INSERT INTO records "+
+			"(domain_id, name, type, content, ttl, prio, disabled, ordername, auth) "+
+			"VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?)"),
+			t.domainId, nativeNameOf(header.Name), nType, content, header.Ttl, false, ordername, auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	t.touch(header.Rrtype)
+	return nil
+}
+
+func (t *GenericSQLAdapterTransaction) deleteSet(name string, rrType uint16) error {
+	nType, err := nativeTypeOf(rrType)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.tx.ExecContext(t.ctx, t.rebind("DELETE FROM records WHERE domain_id = ? AND name = ? AND type = ? AND disabled = ?"),
+		t.domainId, nativeNameOf(name), nType, false)
+	if err != nil {
+		return err
+	}
+
+	t.touch(rrType)
+	return nil
+}
+
+func (t *GenericSQLAdapterTransaction) touch(rrType uint16) {
+	t.dirty = true
+	if rrType == miekgdns.TypeSOA {
+		t.soaChanged = true
+	}
+}
+
+// Mirrors what PowerDNS rectification does for a single name: records at a
+// delegation point (but DS) and below it are not authoritative, and names
+// below a delegation point have no ordername.
+func (t *GenericSQLAdapterTransaction) authOf(name string, rrType uint16) (auth bool, delegated bool, err error) {
+	zone := nativeNameOf(t.zone)
+	name = nativeNameOf(name)
+	if name == zone {
+		return true, false, nil
+	}
+
+	hasNS := func(name string) (bool, error) {
+		var count int
+		row := t.tx.QueryRowContext(t.ctx, t.rebind("SELECT COUNT(*) FROM records WHERE domain_id = ? AND name = ? AND type = 'NS'"),
+			t.domainId, name)
+		if err := row.Scan(&count); err != nil {
+			return false, err
+		}
+		return count > 0, nil
+	}
+
+	// Walk up the tree, from the parent of the owner name to the child of the apex
+	labels := miekgdns.SplitDomainName(name)
+	zoneLabels := miekgdns.CountLabel(miekgdns.Fqdn(zone))
+	for idx := 1; idx < len(labels)-zoneLabels; idx++ {
+		found, err := hasNS(strings.Join(labels[idx:], "."))
+		if err != nil {
+			return false, false, err
+		}
+		if found {
+			return false, true, nil
+		}
+	}
+
+	// The owner name itself may be a delegation point
+	if rrType == miekgdns.TypeNS {
+		return false, false, nil
+	}
+	found, err := hasNS(name)
+	if err != nil {
+		return false, false, err
+	}
+	if found {
+		return rrType == miekgdns.TypeDS, false, nil
+	}
+	return true, false, nil
+}
+
+func (t *GenericSQLAdapterTransaction) ordernameOf(name string, delegated bool) sql.NullString {
+	if !t.adapter.config.Dnssec || delegated {
+		return sql.NullString{}
+	}
+
+	name = strings.ToLower(miekgdns.Fqdn(name))
+
+	if t.nsec3 != nil {
+		hashed := miekgdns.HashName(name, t.nsec3.Hash, t.nsec3.Iterations, t.nsec3.Salt)
+		return sql.NullString{String: strings.ToLower(hashed), Valid: true}
+	}
+
+	// NSEC ordering uses the labels relative to the apex, in reverse order
+	relative := strings.TrimSuffix(strings.TrimSuffix(name, strings.ToLower(miekgdns.Fqdn(t.zone))), ".")
+	labels := miekgdns.SplitDomainName(relative)
+	slices.Reverse(labels)
+	return sql.NullString{String: strings.Join(labels, " "), Valid: true}
+}
+
+func (t *GenericSQLAdapterTransaction) bumpSerial() error {
+	var (
+		id      int64
+		content string
+	)
+	row := t.tx.QueryRowContext(t.ctx, t.rebind("SELECT id, content FROM records WHERE domain_id = ? AND type = 'SOA'"),
+		t.domainId)
+	if err := row.Scan(&id, &content); err != nil {
+		return fmt.Errorf("failed to get SOA record: %w", err)
+	}
+
+	// The stored format is:
+	//   primary hostmaster serial refresh retry expire minimum
+	fields := strings.Fields(content)
+	if len(fields) != 7 {
+		return fmt.Errorf("invalid SOA format: %s", content)
+	}
+	parsed, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return fmt.Errorf("fail to convert SOA serial to integer: %w", err)
+	}
+
+	serial := uint32(parsed)
+	next := nextSerial(serial, t.adapter.config.SoaEdit, time.Now().UTC())
+	fields[2] = strconv.FormatUint(uint64(next), 10)
+
+	_, err = t.tx.ExecContext(t.ctx, t.rebind("UPDATE records SET content = ? WHERE id = ?"), strings.Join(fields, " "), id)
+	if err != nil {
+		return fmt.Errorf("failed to update SOA record: %w", err)
+	}
+
+	t.logger.Debugw("bumped zone serial", "zone", t.zone, "from", serial, "to", next)
+	return nil
+}
+
+func nextSerial(serial uint32, policy string, now time.Time) uint32 {
+	var floor uint32
+
+	switch policy {
+	case SoaEditEpoch:
+		floor = uint32(now.Unix())
+	case SoaEditDate:
+		floor = uint32(now.Year()*1000000 + int(now.Month())*10000 + now.Day()*100)
+	}
+
+	// Serial arithmetic from RFC 1982
+	if floor != 0 && int32(floor-serial) > 0 {
+		return floor
+	}
+	return serial + 1
+}
+
+func (t *GenericSQLAdapterTransaction) Commit() error {
+	if t.dirty && !t.soaChanged && t.adapter.config.SoaEdit != SoaEditNone {
+		if err := t.bumpSerial(); err != nil {
+			return fmt.Errorf("GenericSQL.Commit: %w", err)
+		}
+	}
+
+	if err := t.tx.Commit(); err != nil {
+		return fmt.Errorf("GenericSQL.Commit: %w", err)
+	}
+	return nil
+}
+
+func (t *GenericSQLAdapterTransaction) Rollback() error {
+	if err := t.tx.Rollback(); err != nil {
+		return fmt.Errorf("GenericSQL.Rollback: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package gsql
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	miekgdns "github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+// The parts of the PowerDNS SQLite schema used by the adapter
+const testSchema = `
+CREATE TABLE domains (
+	id INTEGER PRIMARY KEY,
+	name VARCHAR(255) NOT NULL COLLATE NOCASE,
+	type VARCHAR(8) NOT NULL
+);
+CREATE TABLE records (
+	id INTEGER PRIMARY KEY,
+	domain_id INTEGER DEFAULT NULL,
+	name VARCHAR(255) DEFAULT NULL,
+	type VARCHAR(10) DEFAULT NULL,
+	content VARCHAR(65535) DEFAULT NULL,
+	ttl INTEGER DEFAULT NULL,
+	prio INTEGER DEFAULT NULL,
+	disabled BOOLEAN DEFAULT 0,
+	ordername VARCHAR(255),
+	auth BOOL DEFAULT 1
+);
+CREATE TABLE domainmetadata (
+	id INTEGER PRIMARY KEY,
+	domain_id INT NOT NULL,
+	kind VARCHAR(32) COLLATE NOCASE,
+	content TEXT
+);
+INSERT INTO domains (id, name, type) VALUES (1, 'example.test', 'NATIVE');
+INSERT INTO records (domain_id, name, type, content, ttl, auth) VALUES
+	(1, 'example.test', 'SOA', 'ns1.example.test hostmaster.example.test 1 3600 600 86400 300', 3600, 1),
+	(1, 'example.test', 'NS', 'ns1.example.test', 3600, 1),
+	(1, 'sub.example.test', 'NS', 'ns1.sub.example.test', 3600, 0);
+INSERT INTO records (domain_id, name, type, content, ttl, disabled) VALUES
+	(1, 'old.example.test', 'A', '192.0.2.99', 300, 1);
+`
+
+type testRecord struct {
+	content   string
+	ordername sql.NullString
+	auth      bool
+}
+
+func newTestAdapter(t *testing.T, soaEdit string) *GenericSQLAdapter {
+	t.Helper()
+
+	config := &GenericSQLAdapterConfiguration{
+		Driver:  "sqlite",
+		Dsn:     filepath.Join(t.TempDir(), "pdns.db"),
+		Dnssec:  true,
+		SoaEdit: soaEdit,
+	}
+	adapter, err := NewGenericSQLAdapter("test", config, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewGenericSQLAdapter: %v", err)
+	}
+	sqlAdapter := adapter.(*GenericSQLAdapter)
+	t.Cleanup(func() { sqlAdapter.db.Close() })
+
+	if _, err := sqlAdapter.db.Exec(testSchema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	return sqlAdapter
+}
+
+func newTestTransaction(t *testing.T, adapter *GenericSQLAdapter) *GenericSQLAdapterTransaction {
+	t.Helper()
+
+	tx, err := adapter.NewTransaction(context.Background(), "example.test.", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	return tx.(*GenericSQLAdapterTransaction)
+}
+
+func mustRR(t *testing.T, value string) miekgdns.RR {
+	t.Helper()
+
+	rr, err := miekgdns.NewRR(value)
+	if err != nil {
+		t.Fatalf("invalid record %q: %v", value, err)
+	}
+	return rr
+}
+
+func recordsOf(t *testing.T, adapter *GenericSQLAdapter, name string, nType string) []testRecord {
+	t.Helper()
+
+	rows, err := adapter.db.Query("SELECT content, ordername, auth FROM records WHERE name = ? AND type = ? ORDER BY id",
+		name, nType)
+	if err != nil {
+		t.Fatalf("failed to query records: %v", err)
+	}
+	defer rows.Close()
+
+	var records []testRecord
+	for rows.Next() {
+		var record testRecord
+		if err := rows.Scan(&record.content, &record.ordername, &record.auth); err != nil {
+			t.Fatalf("failed to scan record: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func serialOf(t *testing.T, adapter *GenericSQLAdapter) string {
+	t.Helper()
+
+	records := recordsOf(t, adapter, "example.test", "SOA")
+	if len(records) != 1 {
+		t.Fatalf("expected a single SOA record, got %d", len(records))
+	}
+	rr, err := makeDnsRR("example.test", "SOA", 0, records[0].content)
+	if err != nil {
+		t.Fatalf("invalid SOA record: %v", err)
+	}
+	return rr.(*miekgdns.SOA).String()
+}
+
+func TestTransactionCommit(t *testing.T) {
+	adapter := newTestAdapter(t, SoaEditIncrement)
+	tx := newTestTransaction(t, adapter)
+
+	if err := tx.AddSet([]miekgdns.RR{
+		mustRR(t, "www.example.test. 300 IN A 192.0.2.1"),
+		mustRR(t, "www.example.test. 300 IN A 192.0.2.2"),
+	}); err != nil {
+		t.Fatalf("AddSet: %v", err)
+	}
+	if err := tx.AddSet([]miekgdns.RR{mustRR(t, "mail.example.test. 300 IN MX 10 mx.example.test.")}); err != nil {
+		t.Fatalf("AddSet: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	records := recordsOf(t, adapter, "www.example.test", "A")
+	if len(records) != 2 {
+		t.Fatalf("expected 2 committed records, got %d", len(records))
+	}
+	for _, record := range records {
+		if !record.auth || record.ordername != (sql.NullString{String: "www", Valid: true}) {
+			t.Errorf("unexpected auth %t and ordername %v", record.auth, record.ordername)
+		}
+	}
+
+	// domain names in the content are stored without the trailing dot
+	if records := recordsOf(t, adapter, "mail.example.test", "MX"); len(records) != 1 || records[0].content != "10 mx.example.test" {
+		t.Errorf("unexpected MX records %v", records)
+	}
+
+	expected := mustRR(t, "example.test. 0 IN SOA ns1.example.test. hostmaster.example.test. 2 3600 600 86400 300")
+	if serial := serialOf(t, adapter); serial != expected.String() {
+		t.Errorf("serial not bumped on commit, got %s", serial)
+	}
+
+	tx = newTestTransaction(t, adapter)
+	defer tx.Rollback()
+	set, err := tx.GetSet("WWW.example.test.", miekgdns.TypeA)
+	if err != nil {
+		t.Fatalf("GetSet: %v", err)
+	}
+	if len(set) != 2 {
+		t.Errorf("expected 2 records from GetSet, got %d", len(set))
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	adapter := newTestAdapter(t, SoaEditIncrement)
+	before := serialOf(t, adapter)
+
+	tx := newTestTransaction(t, adapter)
+	if err := tx.AddSet([]miekgdns.RR{mustRR(t, "www.example.test. 300 IN A 192.0.2.1")}); err != nil {
+		t.Fatalf("AddSet: %v", err)
+	}
+	if err := tx.DeleteSet("example.test.", miekgdns.TypeNS); err != nil {
+		t.Fatalf("DeleteSet: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	if records := recordsOf(t, adapter, "www.example.test", "A"); len(records) != 0 {
+		t.Errorf("records left after rollback: %v", records)
+	}
+	if records := recordsOf(t, adapter, "example.test", "NS"); len(records) != 1 {
+		t.Errorf("deletion not rolled back, got %d NS records", len(records))
+	}
+	if after := serialOf(t, adapter); after != before {
+		t.Errorf("serial changed by a rolled back transaction: %s", after)
+	}
+}
+
+func TestTransactionDelegation(t *testing.T) {
+	adapter := newTestAdapter(t, SoaEditNone)
+	tx := newTestTransaction(t, adapter)
+
+	sets := [][]miekgdns.RR{
+		{mustRR(t, "host.sub.example.test. 300 IN A 192.0.2.1")},
+		{mustRR(t, "sub.example.test. 300 IN DS 12345 13 2 "+
+			"2BB183AF5F22588179A53B0A98631FAD1A292118E7C2B6F1F5E4D3C2B1A09F8E")},
+		{mustRR(t, "other.example.test. 300 IN NS ns.other.example.test.")},
+	}
+	for _, set := range sets {
+		if err := tx.AddSet(set); err != nil {
+			t.Fatalf("AddSet: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		nType     string
+		auth      bool
+		ordername sql.NullString
+	}{
+		{"host.sub.example.test", "A", false, sql.NullString{}},
+		{"sub.example.test", "DS", true, sql.NullString{String: "sub", Valid: true}},
+		{"other.example.test", "NS", false, sql.NullString{String: "other", Valid: true}},
+	}
+	for _, test := range tests {
+		records := recordsOf(t, adapter, test.name, test.nType)
+		if len(records) != 1 {
+			t.Errorf("%s/%s: expected a single record, got %d", test.name, test.nType, len(records))
+			continue
+		}
+		if records[0].auth != test.auth || records[0].ordername != test.ordername {
+			t.Errorf("%s/%s: got auth %t and ordername %v, expected %t and %v", test.name, test.nType,
+				records[0].auth, records[0].ordername, test.auth, test.ordername)
+		}
+	}
+
+	expected := mustRR(t, "example.test. 0 IN SOA ns1.example.test. hostmaster.example.test. 1 3600 600 86400 300")
+	if serial := serialOf(t, adapter); serial != expected.String() {
+		t.Errorf("serial changed with the none SOA edit policy: %s", serial)
+	}
+}
+
+func TestChangeSetKeepsDisabledRecords(t *testing.T) {
+	adapter := newTestAdapter(t, SoaEditIncrement)
+	tx := newTestTransaction(t, adapter)
+
+	if err := tx.ChangeSet([]miekgdns.RR{mustRR(t, "old.example.test. 300 IN A 192.0.2.1")}); err != nil {
+		t.Fatalf("ChangeSet: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	records := recordsOf(t, adapter, "old.example.test", "A")
+	if len(records) != 2 || records[0].content != "192.0.2.99" || records[1].content != "192.0.2.1" {
+		t.Errorf("unexpected records %v", records)
+	}
+}
+
+func TestNextSerial(t *testing.T) {
+	now := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		serial uint32
+		policy string
+		next   uint32
+	}{
+		{1, SoaEditIncrement, 2},
+		{0xffffffff, SoaEditIncrement, 0},
+		{1, SoaEditEpoch, uint32(now.Unix())},
+		{uint32(now.Unix()) + 10, SoaEditEpoch, uint32(now.Unix()) + 11},
+		{2024010101, SoaEditDate, 2024030500},
+		{2024030507, SoaEditDate, 2024030508},
+	}
+	for _, test := range tests {
+		if next := nextSerial(test.serial, test.policy, now); next != test.next {
+			t.Errorf("nextSerial(%d, %s): got %d, expected %d", test.serial, test.policy, next, test.next)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/enix/tsigoat/pkg/adapters/common"
+	miekgdns "github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+const MemoryAdapterSlug common.AdapterSlug = "memory"
+
+// Zones are kept in memory and lost on restart, meant for tests and local experiments
+type MemoryAdapterConfiguration struct {
+	// Initial records in presentation format, a zone being created for each SOA record
+	Records []string `validate:"dive,required"`
+}
+
+// RRsets by canonical name and type
+type memoryZone map[string]map[uint16][]miekgdns.RR
+
+type MemoryAdapter struct {
+	name   string
+	config *MemoryAdapterConfiguration
+	// held by each operation on the zones, never across a transaction
+	lock  sync.Mutex
+	zones map[string]memoryZone
+	// bumped by every commit of a zone
+	versions map[string]uint64
+	logger   *zap.SugaredLogger
+}
+
+func NewMemoryAdapter(name string, config common.IAdapterConfiguration, logger *zap.SugaredLogger) (adapter common.IAdapter, err error) {
+	var memoryConfig *MemoryAdapterConfiguration
+
+	switch value := config.(type) {
+	case *MemoryAdapterConfiguration:
+		memoryConfig = value
+	default:
+		panic("invalid config type for this adapter")
+	}
+
+	records := make([]miekgdns.RR, 0, len(memoryConfig.Records))
+	zones := make(map[string]memoryZone)
+	for idx, value := range memoryConfig.Records {
+		rr, err := miekgdns.NewRR(value)
+		if err != nil || rr == nil {
+			return nil, fmt.Errorf("memory handler '%s': invalid record %d: %v", name, idx, err)
+		}
+		rr.Header().Name = miekgdns.CanonicalName(rr.Header().Name)
+		if rr.Header().Rrtype == miekgdns.TypeSOA {
+			zones[rr.Header().Name] = make(memoryZone)
+		}
+		records = append(records, rr)
+	}
+
+	for _, rr := range records {
+		zone, found := zoneOf(zones, rr.Header().Name)
+		if !found {
+			return nil, fmt.Errorf("memory handler '%s': record %s is not in a zone with a SOA record", name,
+				rr.Header().Name)
+		}
+		zone.add(rr)
+	}
+
+	logger.Debugw("creating a memory adapter", "name", name, "zones", len(zones), "records", len(records))
+
+	adapter = &MemoryAdapter{
+		name:     name,
+		config:   memoryConfig,
+		zones:    zones,
+		versions: make(map[string]uint64),
+		logger:   logger,
+	}
+	return
+}
+
+func (a *MemoryAdapter) Name() string {
+	return a.name
+}
+
+func (a *MemoryAdapter) Capabilities() common.Capabilities {
+	return common.Capabilities{Transactional: true}
+}
+
+func (a *MemoryAdapter) ListZones(ctx context.Context) ([]string, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	zones := make([]string, 0, len(a.zones))
+	for name := range a.zones {
+		zones = append(zones, name)
+	}
+	slices.Sort(zones)
+	return zones, nil
+}
+
+// The closest enclosing zone of a name
+func zoneOf(zones map[string]memoryZone, name string) (memoryZone, bool) {
+	for _, offset := range miekgdns.Split(name) {
+		if zone, found := zones[name[offset:]]; found {
+			return zone, true
+		}
+	}
+	zone, found := zones["."]
+	return zone, found
+}
+
+func (z memoryZone) add(rr miekgdns.RR) {
+	name := miekgdns.CanonicalName(rr.Header().Name)
+	if z[name] == nil {
+		z[name] = make(map[uint16][]miekgdns.RR)
+	}
+	z[name][rr.Header().Rrtype] = append(z[name][rr.Header().Rrtype], rr)
+}
+
+func (z memoryZone) clone() memoryZone {
+	clone := make(memoryZone, len(z))
+	for name, sets := range z {
+		clone[name] = make(map[uint16][]miekgdns.RR, len(sets))
+		for rrType, set := range sets {
+			clone[name][rrType] = copySet(set)
+		}
+	}
+	return clone
+}
+
+func copySet(set []miekgdns.RR) []miekgdns.RR {
+	copied := make([]miekgdns.RR, 0, len(set))
+	for _, rr := range set {
+		copied = append(copied, miekgdns.Copy(rr))
+	}
+	return copied
+}
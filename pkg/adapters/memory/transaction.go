@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/enix/tsigoat/pkg/adapters/common"
+	miekgdns "github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+// Changes are made to a snapshot of the zone, swapped in on commit. A commit fails when another
+// transaction committed to the zone since the snapshot was taken, its changes would be lost otherwise.
+type MemoryAdapterTransaction struct {
+	adapter *MemoryAdapter
+	zone    string
+	sets    memoryZone
+	version uint64
+	done    bool
+	logger  *zap.SugaredLogger
+}
+
+func (a *MemoryAdapter) NewTransaction(ctx context.Context, zone string, logger *zap.SugaredLogger) (common.IAdapterTransaction, error) {
+	zone = miekgdns.CanonicalName(zone)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	sets, found := a.zones[zone]
+	if !found {
+		return nil, fmt.Errorf("Memory.NewTransaction: zone %s: %w", zone, common.ErrNotAuthoritative)
+	}
+
+	return &MemoryAdapterTransaction{
+		adapter: a,
+		zone:    zone,
+		sets:    sets.clone(),
+		version: a.versions[zone],
+		logger:  logger,
+	}, nil
+}
+
+func (t *MemoryAdapterTransaction) Zone() string {
+	return t.zone
+}
+
+func (t *MemoryAdapterTransaction) GetAll(rrName string) (map[uint16][]miekgdns.RR, error) {
+	sets := make(map[uint16][]miekgdns.RR)
+	for rrType, set := range t.sets[miekgdns.CanonicalName(rrName)] {
+		sets[rrType] = copySet(set)
+	}
+	return sets, nil
+}
+
+func (t *MemoryAdapterTransaction) GetSet(rrName string, rrType uint16) ([]miekgdns.RR, error) {
+	return copySet(t.sets[miekgdns.CanonicalName(rrName)][rrType]), nil
+}
+
+func (t *MemoryAdapterTransaction) AddSet(RRset []miekgdns.RR) error {
+	for _, rr := range copySet(RRset) {
+		t.sets.add(rr)
+	}
+	return nil
+}
+
+func (t *MemoryAdapterTransaction) ChangeSet(RRset []miekgdns.RR) error {
+	if len(RRset) == 0 {
+		return fmt.Errorf("Memory.ChangeSet: empty RRset")
+	}
+	header := RRset[0].Header()
+	if err := t.DeleteSet(header.Name, header.Rrtype); err != nil {
+		return err
+	}
+	return t.AddSet(RRset)
+}
+
+func (t *MemoryAdapterTransaction) DeleteSet(name string, recordType uint16) error {
+	name = miekgdns.CanonicalName(name)
+	delete(t.sets[name], recordType)
+	if len(t.sets[name]) == 0 {
+		delete(t.sets, name)
+	}
+	return nil
+}
+
+func (t *MemoryAdapterTransaction) Commit() error {
+	if t.done {
+		return fmt.Errorf("Memory.Commit: transaction already ended")
+	}
+	t.done = true
+
+	t.adapter.lock.Lock()
+	defer t.adapter.lock.Unlock()
+
+	if t.adapter.versions[t.zone] != t.version {
+		return fmt.Errorf("Memory.Commit: zone %s changed since the transaction started", t.zone)
+	}
+	t.adapter.zones[t.zone] = t.sets
+	t.adapter.versions[t.zone]++
+	return nil
+}
+
+// The snapshot is dropped, nothing was shared with the adapter
+func (t *MemoryAdapterTransaction) Rollback() error {
+	t.done = true
+	return nil
+}
@@ -0,0 +1,151 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	miekgdns "github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+func newTestAdapter(t *testing.T) *MemoryAdapter {
+	t.Helper()
+
+	adapter, err := NewMemoryAdapter("test", &MemoryAdapterConfiguration{
+		Records: []string{"example.test. 3600 IN SOA ns1.example.test. hostmaster.example.test. 1 3600 600 86400 300"},
+	}, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewMemoryAdapter: %v", err)
+	}
+	return adapter.(*MemoryAdapter)
+}
+
+func newTestTransaction(t *testing.T, adapter *MemoryAdapter) *MemoryAdapterTransaction {
+	t.Helper()
+
+	tx, err := adapter.NewTransaction(context.Background(), "example.test.", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	return tx.(*MemoryAdapterTransaction)
+}
+
+func mustRR(t *testing.T, value string) miekgdns.RR {
+	t.Helper()
+
+	rr, err := miekgdns.NewRR(value)
+	if err != nil {
+		t.Fatalf("invalid record %q: %v", value, err)
+	}
+	return rr
+}
+
+func countOf(t *testing.T, adapter *MemoryAdapter, name string, rrType uint16) int {
+	t.Helper()
+
+	tx := newTestTransaction(t, adapter)
+	defer tx.Rollback()
+	set, _ := tx.GetSet(name, rrType)
+	return len(set)
+}
+
+// A transaction never ended doesn't block the next ones
+func TestAbandonedTransaction(t *testing.T) {
+	adapter := newTestAdapter(t)
+	newTestTransaction(t, adapter)
+
+	done := make(chan struct{})
+	go func() {
+		tx := newTestTransaction(t, adapter)
+		tx.AddSet([]miekgdns.RR{mustRR(t, "www.example.test. 300 IN A 192.0.2.1")})
+		if err := tx.Commit(); err != nil {
+			t.Errorf("Commit: %v", err)
+		}
+		adapter.ListZones(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked by an abandoned transaction")
+	}
+}
+
+func TestRollback(t *testing.T) {
+	adapter := newTestAdapter(t)
+
+	tx := newTestTransaction(t, adapter)
+	tx.AddSet([]miekgdns.RR{mustRR(t, "www.example.test. 300 IN A 192.0.2.1")})
+	tx.DeleteSet("example.test.", miekgdns.TypeSOA)
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Error("committed a rolled back transaction")
+	}
+
+	if count := countOf(t, adapter, "www.example.test.", miekgdns.TypeA); count != 0 {
+		t.Errorf("rolled back records were applied: %d", count)
+	}
+	if count := countOf(t, adapter, "example.test.", miekgdns.TypeSOA); count != 1 {
+		t.Errorf("rolled back deletion was applied")
+	}
+}
+
+// The first commit wins, the second would drop its changes otherwise
+func TestConcurrentCommits(t *testing.T) {
+	adapter := newTestAdapter(t)
+
+	first := newTestTransaction(t, adapter)
+	second := newTestTransaction(t, adapter)
+	first.AddSet([]miekgdns.RR{mustRR(t, "first.example.test. 300 IN A 192.0.2.1")})
+	second.AddSet([]miekgdns.RR{mustRR(t, "second.example.test. 300 IN A 192.0.2.2")})
+
+	if err := first.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if err := second.Commit(); err == nil {
+		t.Error("committed over changes made since the transaction started")
+	}
+	if countOf(t, adapter, "first.example.test.", miekgdns.TypeA) != 1 ||
+		countOf(t, adapter, "second.example.test.", miekgdns.TypeA) != 0 {
+		t.Error("unexpected zone content after concurrent commits")
+	}
+
+	// read-only transactions never conflict
+	third := newTestTransaction(t, adapter)
+	fourth := newTestTransaction(t, adapter)
+	third.Rollback()
+	fourth.AddSet([]miekgdns.RR{mustRR(t, "fourth.example.test. 300 IN A 192.0.2.4")})
+	if err := fourth.Commit(); err != nil {
+		t.Errorf("Commit: %v", err)
+	}
+}
+
+func TestParallelTransactions(t *testing.T) {
+	adapter := newTestAdapter(t)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				tx, err := adapter.NewTransaction(context.Background(), "example.test.", zap.NewNop().Sugar())
+				if err != nil {
+					t.Errorf("NewTransaction: %v", err)
+					return
+				}
+				tx.ChangeSet([]miekgdns.RR{mustRR(t, "www.example.test. 300 IN A 192.0.2.1")})
+				tx.Commit()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if count := countOf(t, adapter, "www.example.test.", miekgdns.TypeA); count != 1 {
+		t.Errorf("expected a single record, got %d", count)
+	}
+}
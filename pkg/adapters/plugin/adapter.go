@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/adapters/common"
+	miekgdns "github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+const PluginAdapterSlug common.AdapterSlug = "plugin"
+
+const defaultTimeout = 10 * time.Second
+
+type PluginAdapterConfiguration struct {
+	Command string        `validate:"required_without=Socket,excluded_with=Socket"`
+	Args    []string      `validate:"excluded_with=Socket"`
+	Env     []string      `validate:"excluded_with=Socket,dive,contains==" sensitive:"true"`
+	Socket  string        `validate:"required_without=Command,excluded_with=Command"`
+	Timeout time.Duration `validate:"gte=0"`
+	// Declared by the plugin author, any type is sent to the plugin when empty
+	Types        []string `validate:"dive,required"`
+	MaxRRsetSize int      `validate:"gte=0"`
+	types        []uint16
+}
+
+type PluginAdapter struct {
+	name    string
+	config  *PluginAdapterConfiguration
+	lock    sync.Mutex
+	session *session
+	logger  *zap.SugaredLogger
+}
+
+func (c *PluginAdapterConfiguration) SetDefaults() {
+	if c.Timeout == 0 {
+		c.Timeout = defaultTimeout
+	}
+}
+
+func NewPluginAdapter(name string, config common.IAdapterConfiguration, logger *zap.SugaredLogger) (adapter common.IAdapter, err error) {
+	var pluginConfig *PluginAdapterConfiguration
+
+	switch value := config.(type) {
+	case *PluginAdapterConfiguration:
+		pluginConfig = value
+	default:
+		panic("invalid config type for this adapter")
+	}
+
+	pluginConfig.SetDefaults()
+
+	for _, typeName := range pluginConfig.Types {
+		rrType, found := miekgdns.StringToType[strings.ToUpper(typeName)]
+		if !found {
+			return nil, fmt.Errorf("plugin handler '%s': unknown RR type '%s'", name, typeName)
+		}
+		pluginConfig.types = append(pluginConfig.types, rrType)
+	}
+
+	logger.Debugw("creating a plugin adapter", "name", name, "command", pluginConfig.Command,
+		"socket", pluginConfig.Socket)
+
+	adapter = &PluginAdapter{
+		name:   name,
+		config: pluginConfig,
+		logger: logger,
+	}
+	return
+}
+
+func (a *PluginAdapter) Name() string {
+	return a.name
+}
+
+// Plugins are expected to apply changes on commit only, as the protocol allows for rollbacks
+func (a *PluginAdapter) Capabilities() common.Capabilities {
+	return common.Capabilities{
+		Types:         a.config.types,
+		Transactional: true,
+		MaxRRsetSize:  a.config.MaxRRsetSize,
+	}
+}
+
+func (a *PluginAdapter) ListZones(ctx context.Context) ([]string, error) {
+	session, err := a.getSession()
+	if err != nil {
+		return nil, fmt.Errorf("Plugin.ListZones: %w", err)
+	}
+
+	response, err := session.call(ctx, &Request{Method: MethodListZones})
+	if err != nil {
+		return nil, fmt.Errorf("Plugin.ListZones: %w", err)
+	}
+	return response.Zones, nil
+}
+
+// Returns the live session, the plugin is (re)started or (re)connected when needed
+func (a *PluginAdapter) getSession() (*session, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.session != nil && a.session.alive() {
+		return a.session, nil
+	}
+
+	a.logger.Infow("starting plugin session", "name", a.name, "command", a.config.Command, "socket", a.config.Socket)
+	session, err := startSession(a.config, a.logger.With("handler", a.name))
+	if err != nil {
+		return nil, fmt.Errorf("plugin '%s': %w", a.name, err)
+	}
+	a.session = session
+	return session, nil
+}
@@ -0,0 +1,224 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	miekgdns "github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+// The stub plugin of hack/plugin-stub, built once for all tests
+var stubPath string
+
+func TestMain(m *testing.M) {
+	os.Exit(func() int {
+		dir, err := os.MkdirTemp("", "plugin-stub")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+
+		stubPath = filepath.Join(dir, "plugin-stub")
+		build := exec.Command("go", "build", "-o", stubPath, "../../../hack/plugin-stub")
+		if output, err := build.CombinedOutput(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to build the stub plugin: %s\n%s", err, output)
+			return 1
+		}
+		return m.Run()
+	}())
+}
+
+func newTestAdapter(t *testing.T, config *PluginAdapterConfiguration) *PluginAdapter {
+	t.Helper()
+
+	adapter, err := NewPluginAdapter("stub", config, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewPluginAdapter: %v", err)
+	}
+	pluginAdapter := adapter.(*PluginAdapter)
+	t.Cleanup(func() {
+		if pluginAdapter.session != nil {
+			pluginAdapter.session.close(errSessionClosed)
+		}
+	})
+	return pluginAdapter
+}
+
+// Starts the stub plugin listening on a Unix socket, returning the socket path once it accepts connections
+func startSocketStub(t *testing.T, args ...string) string {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "stub.sock")
+	cmd := exec.Command(stubPath, append([]string{"-socket", socket}, args...)...)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start the stub plugin: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	for range 100 {
+		if _, err := os.Stat(socket); err == nil {
+			return socket
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("the stub plugin did not create its socket")
+	return ""
+}
+
+func mustRR(t *testing.T, value string) miekgdns.RR {
+	t.Helper()
+
+	rr, err := miekgdns.NewRR(value)
+	if err != nil {
+		t.Fatalf("invalid record %q: %v", value, err)
+	}
+	return rr
+}
+
+// Runs a committed update, then a rolled back one failing on a plugin error
+func testProtocol(t *testing.T, adapter *PluginAdapter) {
+	ctx := context.Background()
+	logger := zap.NewNop().Sugar()
+
+	tx, err := adapter.NewTransaction(ctx, "example.test.", logger)
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	set := []miekgdns.RR{
+		mustRR(t, "www.example.test. 300 IN A 192.0.2.1"),
+		mustRR(t, "www.example.test. 300 IN A 192.0.2.2"),
+	}
+	if err := tx.AddSet(set); err != nil {
+		t.Fatalf("AddSet: %v", err)
+	}
+	if err := tx.AddSet([]miekgdns.RR{mustRR(t, "www.example.test. 300 IN TXT \"hello world\"")}); err != nil {
+		t.Fatalf("AddSet: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	tx, err = adapter.NewTransaction(ctx, "example.test.", logger)
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	sets, err := tx.GetAll("WWW.example.test.")
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(sets[miekgdns.TypeA]) != 2 || len(sets[miekgdns.TypeTXT]) != 1 {
+		t.Errorf("unexpected RRsets after commit: %v", sets)
+	} else if txt := sets[miekgdns.TypeTXT][0].(*miekgdns.TXT).Txt; len(txt) != 1 || txt[0] != "hello world" {
+		t.Errorf("TXT record not preserved: %v", txt)
+	}
+
+	// the stub refuses to add a RRset that exists
+	err = tx.AddSet(set)
+	if err == nil || !strings.Contains(err.Error(), "plugin error: set exists") {
+		t.Errorf("expected a plugin error, got %v", err)
+	}
+	if err := tx.DeleteSet("www.example.test.", miekgdns.TypeA); err != nil {
+		t.Fatalf("DeleteSet: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	zones, err := adapter.ListZones(ctx)
+	if err != nil {
+		t.Fatalf("ListZones: %v", err)
+	}
+	if len(zones) != 1 || zones[0] != "example.test." {
+		t.Errorf("unexpected zones %v", zones)
+	}
+
+	tx, err = adapter.NewTransaction(ctx, "example.test.", logger)
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	defer tx.Rollback()
+	if set, err := tx.GetSet("www.example.test.", miekgdns.TypeA); err != nil || len(set) != 2 {
+		t.Errorf("rolled back deletion was applied: %v, %v", set, err)
+	}
+
+	// transactions are known to the plugin by their identifier only
+	_, err = adapter.session.call(ctx, &Request{Method: MethodGetSet, Transaction: "unknown", Name: "www.example.test.",
+		Type: "A"})
+	if err == nil || !strings.Contains(err.Error(), "unknown transaction") {
+		t.Errorf("expected an unknown transaction error, got %v", err)
+	}
+}
+
+func TestStdio(t *testing.T) {
+	testProtocol(t, newTestAdapter(t, &PluginAdapterConfiguration{Command: stubPath, Timeout: 5 * time.Second}))
+}
+
+func TestSocket(t *testing.T) {
+	socket := startSocketStub(t)
+	testProtocol(t, newTestAdapter(t, &PluginAdapterConfiguration{Socket: socket, Timeout: 5 * time.Second}))
+}
+
+func TestTimeout(t *testing.T) {
+	for _, transport := range []string{"stdio", "socket"} {
+		t.Run(transport, func(t *testing.T) {
+			config := &PluginAdapterConfiguration{Timeout: 200 * time.Millisecond}
+			if transport == "socket" {
+				config.Socket = startSocketStub(t, "-stall", MethodGetSet)
+			} else {
+				config.Command = stubPath
+				config.Args = []string{"-stall", MethodGetSet}
+			}
+			adapter := newTestAdapter(t, config)
+
+			tx, err := adapter.NewTransaction(context.Background(), "example.test.", zap.NewNop().Sugar())
+			if err != nil {
+				t.Fatalf("NewTransaction: %v", err)
+			}
+			_, err = tx.GetSet("www.example.test.", miekgdns.TypeA)
+			if err == nil || !strings.Contains(err.Error(), "did not answer GetSet within 200ms") {
+				t.Fatalf("expected a timeout, got %v", err)
+			}
+
+			// the session outlives a timed out request
+			if err := tx.Rollback(); err != nil {
+				t.Errorf("Rollback after a timeout: %v", err)
+			}
+		})
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	adapter := newTestAdapter(t, &PluginAdapterConfiguration{Command: stubPath, Args: []string{"-stall", MethodCommit},
+		Timeout: 5 * time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	tx, err := adapter.NewTransaction(ctx, "example.test.", zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	if err := tx.Commit(); err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("expected the update deadline to be exceeded, got %v", err)
+	}
+}
+
+func TestPluginExit(t *testing.T) {
+	adapter := newTestAdapter(t, &PluginAdapterConfiguration{Command: stubPath, Args: []string{"-socket"},
+		Timeout: 5 * time.Second})
+
+	_, err := adapter.NewTransaction(context.Background(), "example.test.", zap.NewNop().Sugar())
+	if err == nil || !strings.Contains(err.Error(), "plugin handshake") {
+		t.Errorf("expected a handshake failure, got %v", err)
+	}
+}
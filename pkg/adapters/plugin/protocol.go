@@ -0,0 +1,47 @@
+package plugin
+
+// The plugin protocol exchanges one JSON object per line, over the plugin
+// standard input and output or over a Unix socket. Requests carry an
+// identifier echoed by the response, so a plugin may answer out of order.
+//
+// A session starts with a Hello request. Every update then opens a
+// transaction with Begin, and ends it with either Commit or Rollback.
+// Records are written in presentation format, as in a zone file, with
+// fully qualified owner names.
+//
+// ListZones is optional, it is sent outside of any transaction.
+
+const ProtocolVersion = 1
+
+const (
+	MethodHello     = "Hello"
+	MethodBegin     = "Begin"
+	MethodGetAll    = "GetAll"
+	MethodGetSet    = "GetSet"
+	MethodAddSet    = "AddSet"
+	MethodChangeSet = "ChangeSet"
+	MethodDeleteSet = "DeleteSet"
+	MethodCommit    = "Commit"
+	MethodRollback  = "Rollback"
+	MethodListZones = "ListZones"
+)
+
+type Request struct {
+	Id          uint64   `json:"id"`
+	Method      string   `json:"method"`
+	Version     int      `json:"version,omitempty"`
+	Transaction string   `json:"transaction,omitempty"`
+	Zone        string   `json:"zone,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	Records     []string `json:"records,omitempty"`
+}
+
+type Response struct {
+	Id          uint64   `json:"id"`
+	Error       string   `json:"error,omitempty"`
+	Version     int      `json:"version,omitempty"`
+	Transaction string   `json:"transaction,omitempty"`
+	Records     []string `json:"records,omitempty"`
+	Zones       []string `json:"zones,omitempty"`
+}
@@ -0,0 +1,206 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var errSessionClosed = errors.New("plugin session closed")
+
+// A session is a live connection to a plugin, shared by all transactions of an adapter
+type session struct {
+	writeLock sync.Mutex
+	encoder   *json.Encoder
+	closer    io.Closer
+	cmd       *exec.Cmd
+
+	lock    sync.Mutex
+	nextId  uint64
+	pending map[uint64]chan *Response
+	err     error
+	done    chan struct{}
+
+	timeout time.Duration
+	logger  *zap.SugaredLogger
+}
+
+func startSession(config *PluginAdapterConfiguration, logger *zap.SugaredLogger) (*session, error) {
+	var (
+		reader io.Reader
+		writer io.Writer
+		closer io.Closer
+		cmd    *exec.Cmd
+	)
+
+	if config.Socket != "" {
+		conn, err := net.Dial("unix", config.Socket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to plugin socket: %w", err)
+		}
+		reader, writer, closer = conn, conn, conn
+	} else {
+		cmd = exec.Command(config.Command, config.Args...)
+		cmd.Env = append(os.Environ(), config.Env...)
+
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		stderr, err := cmd.StderrPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start plugin: %w", err)
+		}
+
+		go func() {
+			scanner := bufio.NewScanner(stderr)
+			for scanner.Scan() {
+				logger.Infow("plugin output", "command", config.Command, "line", scanner.Text())
+			}
+		}()
+
+		reader, writer, closer = stdout, stdin, stdin
+	}
+
+	s := &session{
+		encoder: json.NewEncoder(writer),
+		closer:  closer,
+		cmd:     cmd,
+		pending: make(map[uint64]chan *Response),
+		done:    make(chan struct{}),
+		timeout: config.Timeout,
+		logger:  logger,
+	}
+	go s.receive(reader)
+
+	response, err := s.call(context.Background(), &Request{Method: MethodHello, Version: ProtocolVersion})
+	if err != nil {
+		s.close(err)
+		return nil, fmt.Errorf("plugin handshake: %w", err)
+	}
+	if response.Version != ProtocolVersion {
+		err = fmt.Errorf("unsupported plugin protocol version %d", response.Version)
+		s.close(err)
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *session) receive(reader io.Reader) {
+	decoder := json.NewDecoder(reader)
+	for {
+		response := &Response{}
+		if err := decoder.Decode(response); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errSessionClosed
+			}
+			s.close(err)
+			return
+		}
+
+		s.lock.Lock()
+		channel, found := s.pending[response.Id]
+		delete(s.pending, response.Id)
+		s.lock.Unlock()
+
+		if !found {
+			s.logger.Warnw("dropping plugin response to an unknown request", "id", response.Id)
+			continue
+		}
+		channel <- response
+	}
+}
+
+func (s *session) call(ctx context.Context, request *Request) (*Response, error) {
+	channel := make(chan *Response, 1)
+
+	s.lock.Lock()
+	if s.err != nil {
+		s.lock.Unlock()
+		return nil, s.err
+	}
+	s.nextId++
+	request.Id = s.nextId
+	s.pending[request.Id] = channel
+	s.lock.Unlock()
+
+	s.writeLock.Lock()
+	err := s.encoder.Encode(request)
+	s.writeLock.Unlock()
+	if err != nil {
+		s.close(err)
+		return nil, err
+	}
+
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	forget := func() {
+		s.lock.Lock()
+		delete(s.pending, request.Id)
+		s.lock.Unlock()
+	}
+
+	select {
+	case response := <-channel:
+		if response.Error != "" {
+			return response, fmt.Errorf("plugin error: %s", response.Error)
+		}
+		return response, nil
+	case <-s.done:
+		return nil, s.err
+	case <-ctx.Done():
+		forget()
+		return nil, fmt.Errorf("plugin did not answer %s: %w", request.Method, ctx.Err())
+	case <-timer.C:
+		forget()
+		return nil, fmt.Errorf("plugin did not answer %s within %s", request.Method, s.timeout)
+	}
+}
+
+func (s *session) alive() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err == nil
+}
+
+// Terminates the session, pending and further calls fail with the given error
+func (s *session) close(err error) {
+	s.lock.Lock()
+	if s.err != nil {
+		s.lock.Unlock()
+		return
+	}
+	s.err = err
+	close(s.done)
+	s.lock.Unlock()
+
+	s.logger.Warnw("plugin session terminated", "error", err.Error())
+
+	s.closer.Close()
+	if s.cmd != nil {
+		// the plugin is expected to exit when its standard input is closed
+		go func() {
+			if err := s.cmd.Wait(); err != nil {
+				s.logger.Warnw("plugin exited", "error", err.Error())
+			}
+		}()
+	}
+}
@@ -0,0 +1,173 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/enix/tsigoat/pkg/adapters/common"
+	miekgdns "github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+type PluginAdapterTransaction struct {
+	ctx     context.Context
+	zone    string
+	id      string
+	session *session
+	logger  *zap.SugaredLogger
+}
+
+func (a *PluginAdapter) NewTransaction(ctx context.Context, zone string, logger *zap.SugaredLogger) (common.IAdapterTransaction, error) {
+	session, err := a.getSession()
+	if err != nil {
+		return nil, fmt.Errorf("Plugin.NewTransaction: %w", err)
+	}
+
+	response, err := session.call(ctx, &Request{Method: MethodBegin, Zone: zone})
+	if err != nil {
+		return nil, fmt.Errorf("Plugin.NewTransaction: %w", err)
+	}
+
+	logger.Debugw("plugin opened a transaction", "zone", zone, "transaction", response.Transaction)
+	return &PluginAdapterTransaction{
+		ctx,
+		zone,
+		response.Transaction,
+		session,
+		logger,
+	}, nil
+}
+
+func (t *PluginAdapterTransaction) call(request *Request) (*Response, error) {
+	request.Transaction = t.id
+	return t.session.call(t.ctx, request)
+}
+
+func (t *PluginAdapterTransaction) Zone() string {
+	return t.zone
+}
+
+func (t *PluginAdapterTransaction) GetAll(rrName string) (RRsets map[uint16][]miekgdns.RR, retErr error) {
+	t.logger.Debugw("querying plugin for all records with name", "name", rrName)
+
+	response, err := t.call(&Request{Method: MethodGetAll, Name: rrName})
+	if err != nil {
+		retErr = fmt.Errorf("Plugin.GetAll: %w", err)
+		return
+	}
+
+	rrs, err := parseRecords(response.Records)
+	if err != nil {
+		retErr = fmt.Errorf("Plugin.GetAll: %w", err)
+		return
+	}
+
+	RRsets = make(map[uint16][]miekgdns.RR)
+	for _, rr := range rrs {
+		if !sameName(rr.Header().Name, rrName) {
+			retErr = fmt.Errorf("Plugin.GetAll: unexpected record name '%s'", rr.Header().Name)
+			return
+		}
+		rrType := rr.Header().Rrtype
+		RRsets[rrType] = append(RRsets[rrType], rr)
+	}
+	return
+}
+
+func (t *PluginAdapterTransaction) GetSet(rrName string, rrType uint16) (RRset []miekgdns.RR, retErr error) {
+	t.logger.Debugw("querying plugin for records of name and type", "name", rrName, "type", miekgdns.TypeToString[rrType])
+
+	response, err := t.call(&Request{Method: MethodGetSet, Name: rrName, Type: miekgdns.TypeToString[rrType]})
+	if err != nil {
+		retErr = fmt.Errorf("Plugin.GetSet: %w", err)
+		return
+	}
+
+	RRset, err = parseRecords(response.Records)
+	if err != nil {
+		retErr = fmt.Errorf("Plugin.GetSet: %w", err)
+		return
+	}
+
+	for _, rr := range RRset {
+		if !sameName(rr.Header().Name, rrName) || rr.Header().Rrtype != rrType {
+			retErr = fmt.Errorf("Plugin.GetSet: unexpected record '%s'", rr.String())
+			return
+		}
+	}
+	return
+}
+
+func (t *PluginAdapterTransaction) AddSet(RRset []miekgdns.RR) error {
+	t.logger.Debugw("asking plugin to add a new RRset", "size", len(RRset))
+
+	if !miekgdns.IsRRset(RRset) {
+		return fmt.Errorf("Plugin.AddSet: invalid set")
+	}
+	if _, err := t.call(&Request{Method: MethodAddSet, Records: formatRecords(RRset)}); err != nil {
+		return fmt.Errorf("Plugin.AddSet: %w", err)
+	}
+	return nil
+}
+
+func (t *PluginAdapterTransaction) ChangeSet(RRset []miekgdns.RR) error {
+	t.logger.Debugw("asking plugin to change a RRset", "size", len(RRset))
+
+	if !miekgdns.IsRRset(RRset) {
+		return fmt.Errorf("Plugin.ChangeSet: invalid set")
+	}
+	if _, err := t.call(&Request{Method: MethodChangeSet, Records: formatRecords(RRset)}); err != nil {
+		return fmt.Errorf("Plugin.ChangeSet: %w", err)
+	}
+	return nil
+}
+
+func (t *PluginAdapterTransaction) DeleteSet(name string, recordType uint16) error {
+	t.logger.Debugw("asking plugin to delete a RRset", "name", name, "type", miekgdns.TypeToString[recordType])
+
+	if _, err := t.call(&Request{Method: MethodDeleteSet, Name: name, Type: miekgdns.TypeToString[recordType]}); err != nil {
+		return fmt.Errorf("Plugin.DeleteSet: %w", err)
+	}
+	return nil
+}
+
+func (t *PluginAdapterTransaction) Commit() error {
+	if _, err := t.call(&Request{Method: MethodCommit}); err != nil {
+		return fmt.Errorf("Plugin.Commit: %w", err)
+	}
+	return nil
+}
+
+func (t *PluginAdapterTransaction) Rollback() error {
+	if _, err := t.call(&Request{Method: MethodRollback}); err != nil {
+		return fmt.Errorf("Plugin.Rollback: %w", err)
+	}
+	return nil
+}
+
+func sameName(a string, b string) bool {
+	return miekgdns.CanonicalName(a) == miekgdns.CanonicalName(b)
+}
+
+func formatRecords(rrs []miekgdns.RR) []string {
+	records := make([]string, 0, len(rrs))
+	for _, rr := range rrs {
+		records = append(records, rr.String())
+	}
+	return records
+}
+
+func parseRecords(records []string) ([]miekgdns.RR, error) {
+	rrs := make([]miekgdns.RR, 0, len(records))
+	for _, record := range records {
+		rr, err := miekgdns.NewRR(record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid record '%s': %w", record, err)
+		}
+		if rr == nil {
+			return nil, fmt.Errorf("empty record")
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs, nil
+}
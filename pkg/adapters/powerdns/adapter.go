@@ -1,23 +1,61 @@
 package powerdns
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
 	"github.com/enix/tsigoat/pkg/adapters/common"
+	"github.com/joeig/go-powerdns/v3"
 	"go.uber.org/zap"
 )
 
 const PowerDNSAdapterSlug common.AdapterSlug = "powerdns"
 
 type PowerDNSAdapterConfiguration struct {
-	Url        string `validate:"required,http_url"`
-	VHost      string `validate:"hostname"`
-	Key        string `validate:"base64"`
-	decodedKey string
+	Url                string        `validate:"required,http_url"`
+	VHost              string        `validate:"hostname"`
+	Key                string        `validate:"base64" sensitive:"true"`
+	Timeout            time.Duration `validate:"gte=0"` // per API call, retries included
+	Retries            int           `validate:"gte=0"`
+	RetryBackoff       time.Duration `validate:"gte=0"`
+	CaFile             string        `validate:"omitempty,file"`
+	CertFile           string        `validate:"required_with=KeyFile,omitempty,file"`
+	KeyFile            string        `validate:"required_with=CertFile,omitempty,file"`
+	InsecureSkipVerify bool
+	// Refuse updates to zones PowerDNS is not a primary for
+	CheckKind bool
+	// Ask PowerDNS to notify the secondaries of primary zones after a change
+	Notify bool
+	// Rectify DNSSEC zones after a change, unless PowerDNS does it already (API-RECTIFY)
+	Rectify bool
+	// Stamp updated RRsets with a comment naming the requester and the time of the update, such as
+	// "updated by tsig:dhcp.example. at 2024-05-01T12:00:00Z". The requester is written like in zone
+	// rules and audit records, prefixed with its kind: tsig, sig0, cert or ip.
+	AuditComments bool
+	AuditAccount  string
+	decodedKey    string
 }
 
 type PowerDNSAdapter struct {
-	name   string
-	config *PowerDNSAdapterConfiguration
-	logger *zap.SugaredLogger
+	name       string
+	config     *PowerDNSAdapterConfiguration
+	client     *powerdns.Client
+	httpClient *http.Client
+	logger     *zap.SugaredLogger
+}
+
+func (c *PowerDNSAdapterConfiguration) SetDefaults() {
+	if c.Timeout == 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.RetryBackoff == 0 {
+		c.RetryBackoff = defaultRetryBackoff
+	}
+	if c.AuditAccount == "" {
+		c.AuditAccount = defaultAuditAccount
+	}
 }
 
 func NewPowerDNSAdapter(name string, config common.IAdapterConfiguration, logger *zap.SugaredLogger) (adapter common.IAdapter, err error) {
@@ -38,11 +76,25 @@ func NewPowerDNSAdapter(name string, config common.IAdapterConfiguration, logger
 	// }
 	// pdnsConfig.decodedKey = string(key)
 
-	logger.Debugw("creating a PowerDNS adapter", "name", name, "url", pdnsConfig.Url, "vhost", pdnsConfig.VHost)
+	pdnsConfig.SetDefaults()
+
+	logger.Debugw("creating a PowerDNS adapter", "name", name, "url", pdnsConfig.Url, "vhost", pdnsConfig.VHost,
+		"timeout", pdnsConfig.Timeout, "retries", pdnsConfig.Retries, "check_kind", pdnsConfig.CheckKind,
+		"notify", pdnsConfig.Notify, "rectify", pdnsConfig.Rectify, "audit_comments", pdnsConfig.AuditComments)
+
+	// One pooled HTTP client shared by all transactions
+	httpClient, err := newHTTPClient(pdnsConfig, logger)
+	if err != nil {
+		return nil, fmt.Errorf("PowerDNS adapter '%s': %w", name, err)
+	}
 
 	adapter = &PowerDNSAdapter{
 		name,
 		pdnsConfig,
+		powerdns.New(pdnsConfig.Url, pdnsConfig.VHost,
+			powerdns.WithAPIKey(pdnsConfig.decodedKey),
+			powerdns.WithHTTPClient(httpClient)),
+		httpClient,
 		logger,
 	}
 	return
@@ -51,3 +103,42 @@ func NewPowerDNSAdapter(name string, config common.IAdapterConfiguration, logger
 func (a *PowerDNSAdapter) Name() string {
 	return a.name
 }
+
+// Zones PowerDNS is not a primary for are left out when checking the zone kind
+func (a *PowerDNSAdapter) ListZones(ctx context.Context) ([]string, error) {
+	zones, err := a.client.Zones.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("PowerDNS.ListZones: %w", err)
+	}
+
+	names := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		if zone.Name == nil {
+			continue
+		}
+		if a.config.CheckKind {
+			switch kindOf(&zone) {
+			case powerdns.NativeZoneKind, powerdns.MasterZoneKind, powerdns.ProducerZoneKind:
+			default:
+				continue
+			}
+		}
+		names = append(names, *zone.Name)
+	}
+	return names, nil
+}
+
+// Changes are applied by the API one RRset at a time
+func (a *PowerDNSAdapter) Capabilities() common.Capabilities {
+	types := make([]uint16, 0, len(typePairs))
+	for _, pair := range typePairs {
+		types = append(types, pair.dnsType)
+	}
+
+	return common.Capabilities{
+		Types:         types,
+		Transactional: false,
+		Comments:      true,
+		DNSSEC:        true,
+	}
+}
@@ -0,0 +1,121 @@
+package powerdns
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultTimeout      = 5 * time.Second
+	defaultRetryBackoff = 200 * time.Millisecond
+)
+
+func newHTTPClient(config *PowerDNSAdapterConfiguration, logger *zap.SugaredLogger) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	if config.CaFile != "" {
+		pem, err := os.ReadFile(config.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA bundle '%s'", config.CaFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if config.InsecureSkipVerify {
+		logger.Warnw("TLS certificate verification of the PowerDNS API is disabled", "url", config.Url)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{
+		Timeout: config.Timeout,
+		Transport: &retryTransport{
+			next:    transport,
+			retries: config.Retries,
+			backoff: config.RetryBackoff,
+			logger:  logger,
+		},
+	}, nil
+}
+
+// Retries requests of idempotent methods failing at the connection level or with a server error.
+// Other requests, such as RRset patches or rectify and notify calls, are only retried when the
+// connection could not be established, as they may have been applied before failing otherwise.
+type retryTransport struct {
+	next    http.RoundTripper
+	retries int
+	backoff time.Duration
+	logger  *zap.SugaredLogger
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, errors.New("cannot retry request with a non-rewindable body")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= t.retries || !retryable(req, resp, err) {
+			return resp, err
+		}
+
+		if err != nil {
+			t.logger.Debugw("PowerDNS API request failed, retrying", "method", req.Method, "attempt", attempt+1,
+				"error", err.Error())
+		} else {
+			t.logger.Debugw("PowerDNS API returned a server error, retrying", "method", req.Method, "attempt", attempt+1,
+				"status", resp.StatusCode)
+			resp.Body.Close()
+		}
+
+		// exponential backoff, cut short by the request deadline
+		timer := time.NewTimer(t.backoff << attempt)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return err != nil || resp.StatusCode >= 500
+	}
+
+	// nothing was sent when dialing failed
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,84 @@
+package powerdns
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestRetryClient(retries int) *http.Client {
+	return &http.Client{Transport: &retryTransport{
+		next:    http.DefaultTransport,
+		retries: retries,
+		backoff: time.Millisecond,
+		logger:  zap.NewNop().Sugar(),
+	}}
+}
+
+func TestRetryServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		method string
+		calls  int32
+	}{
+		{http.MethodGet, 3},
+		{http.MethodPatch, 1},
+		{http.MethodPut, 1},
+		{http.MethodPost, 1},
+	}
+	for _, test := range tests {
+		calls.Store(0)
+		request, _ := http.NewRequest(test.method, server.URL, strings.NewReader("{}"))
+		response, err := newTestRetryClient(2).Do(request)
+		if err != nil {
+			t.Fatalf("%s: %v", test.method, err)
+		}
+		response.Body.Close()
+		if calls.Load() != test.calls {
+			t.Errorf("%s: got %d calls, expected %d", test.method, calls.Load(), test.calls)
+		}
+	}
+}
+
+func TestRetryDialErrors(t *testing.T) {
+	// a port nothing listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + listener.Addr().String()
+	listener.Close()
+
+	var attempts atomic.Int32
+	client := newTestRetryClient(2)
+	client.Transport.(*retryTransport).next = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		attempts.Add(1)
+		return http.DefaultTransport.RoundTrip(r)
+	})
+
+	request, _ := http.NewRequest(http.MethodPatch, url, strings.NewReader("{}"))
+	if _, err := client.Do(request); err == nil {
+		t.Fatal("expected a connection error")
+	}
+	if attempts.Load() != 3 {
+		t.Errorf("got %d attempts, expected 3", attempts.Load())
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
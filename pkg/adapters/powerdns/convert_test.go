@@ -0,0 +1,165 @@
+package powerdns
+
+import (
+	"testing"
+
+	"github.com/joeig/go-powerdns/v3"
+	miekgdns "github.com/miekg/dns"
+)
+
+const testDigest = "2BB183AF5F22588179A53B0A98631FAD1A292118E7C2B6F1F5E4D3C2B1A09F8E"
+
+const testPublicKey = "mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ=="
+
+// Presentation format of a record, and its content as stored by PowerDNS
+var conversionTests = []struct {
+	record  string
+	content string
+}{
+	{"A 192.0.2.1", "192.0.2.1"},
+	{"AAAA 2001:db8::1", "2001:db8::1"},
+	{`CAA 0 issue "letsencrypt.org; validationmethods=dns-01"`, `0 issue "letsencrypt.org; validationmethods=dns-01"`},
+	{"CDNSKEY 257 3 13 " + testPublicKey, "257 3 13 " + testPublicKey},
+	{"CDS 12345 13 2 " + testDigest, "12345 13 2 " + testDigest},
+	{"CERT PGP 0 0 AQIDBA==", "PGP 0 0 AQIDBA=="},
+	{"CNAME target.example.test.", "target.example.test."},
+	{"DHCID AAIBY2/AuCccgoJbsaxcQc9TUapptP69lOjxfNuVAA2kjEA=", "AAIBY2/AuCccgoJbsaxcQc9TUapptP69lOjxfNuVAA2kjEA="},
+	{"DLV 12345 13 2 " + testDigest, "12345 13 2 " + testDigest},
+	{"DNAME target.example.test.", "target.example.test."},
+	{"DNSKEY 257 3 13 " + testPublicKey, "257 3 13 " + testPublicKey},
+	{"DS 12345 13 2 " + testDigest, "12345 13 2 " + testDigest},
+	{"EUI48 00-00-5e-00-53-2a", "00-00-5e-00-53-2a"},
+	{"EUI64 00-00-5e-ef-10-00-00-2a", "00-00-5e-ef-10-00-00-2a"},
+	{`HINFO "Generic PC" "Linux"`, `"Generic PC" "Linux"`},
+	{"HTTPS 1 . alpn=h3,h2 ipv4hint=192.0.2.1,192.0.2.2 ech=AEj+DQBE", "1 . alpn=h3,h2 ipv4hint=192.0.2.1,192.0.2.2 ech=AEj+DQBE"},
+	{"HTTPS 0 svc.example.test.", "0 svc.example.test."},
+	{"IPSECKEY 10 1 2 192.0.2.38 AQNRU3mG7TVTO2BkR47usntb102uFJtugbo6BSGvgqt4AQ==",
+		"10 1 2 192.0.2.38 AQNRU3mG7TVTO2BkR47usntb102uFJtugbo6BSGvgqt4AQ=="},
+	{"KEY 256 3 13 " + testPublicKey, "256 3 13 " + testPublicKey},
+	{"KX 10 kx.example.test.", "10 kx.example.test."},
+	{"LOC 52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000m 10m", "52 22 23.000 N 04 53 32.000 E -2m 0.00m 10000m 10m"},
+	{"MX 10 mail.example.test.", "10 mail.example.test."},
+	{`NAPTR 100 10 "S" "SIP+D2U" "!^.*$!sip:info@example.test!" _sip._udp.example.test.`,
+		`100 10 "S" "SIP+D2U" "!^.*$!sip:info@example.test!" _sip._udp.example.test.`},
+	{"NS ns1.example.test.", "ns1.example.test."},
+	{"NSEC3 1 0 10 AABBCCDD 2VPTU5TIMAMQTTGL4LUU9KG21E0AOR3S A RRSIG", "1 0 10 AABBCCDD 2VPTU5TIMAMQTTGL4LUU9KG21E0AOR3S A RRSIG"},
+	{"NSEC3PARAM 1 0 10 AABBCCDD", "1 0 10 AABBCCDD"},
+	{"NSEC next.example.test. A MX RRSIG NSEC", "next.example.test. A MX RRSIG NSEC"},
+	{"OPENPGPKEY AQIDBA==", "AQIDBA=="},
+	{"PTR host.example.test.", "host.example.test."},
+	{"RP admin.example.test. txt.example.test.", "admin.example.test. txt.example.test."},
+	{"RRSIG A 13 3 300 20250101000000 20240101000000 12345 example.test. AQIDBA==",
+		"A 13 3 300 20250101000000 20240101000000 12345 example.test. AQIDBA=="},
+	{"SIG A 13 3 300 20250101000000 20240101000000 12345 example.test. AQIDBA==",
+		"A 13 3 300 20250101000000 20240101000000 12345 example.test. AQIDBA=="},
+	{"SMIMEA 3 0 1 " + testDigest, "3 0 1 " + testDigest},
+	{"SOA ns1.example.test. hostmaster.example.test. 2024010101 3600 600 86400 300",
+		"ns1.example.test. hostmaster.example.test. 2024010101 3600 600 86400 300"},
+	{`SPF "v=spf1 -all"`, `"v=spf1 -all"`},
+	{"SRV 10 60 5060 sip.example.test.", "10 60 5060 sip.example.test."},
+	{"SSHFP 4 2 " + testDigest, "4 2 " + testDigest},
+	{"SVCB 1 svc.example.test. port=8443 mandatory=alpn alpn=h2,h3 no-default-alpn",
+		"1 svc.example.test. port=8443 mandatory=alpn alpn=h2,h3 no-default-alpn"},
+	{`SVCB 1 svc.example.test. alpn="h2,with space"`, `1 svc.example.test. alpn="h2,with\ space"`},
+	{"TLSA 3 1 1 " + testDigest, "3 1 1 " + testDigest},
+	{`TXT "hello world" "with \"quotes\""`, `"hello world" "with \"quotes\""`},
+	{`URI 10 1 "https://www.example.test/"`, `10 1 "https://www.example.test/"`},
+}
+
+// Meta types have no presentation format, they are never stored in a zone
+var metaTypes = []uint16{miekgdns.TypeTKEY, miekgdns.TypeTSIG}
+
+func TestConversionRoundTrip(t *testing.T) {
+	for _, test := range conversionTests {
+		rr, err := miekgdns.NewRR("www.example.test. 300 IN " + test.record)
+		if err != nil {
+			t.Fatalf("%s: invalid record: %v", test.record, err)
+		}
+
+		content, err := NativeContentOf(rr)
+		if err != nil {
+			t.Errorf("%s: NativeContentOf: %v", test.record, err)
+			continue
+		}
+		if content != test.content {
+			t.Errorf("%s: got content %q, expected %q", test.record, content, test.content)
+		}
+
+		nType, err := NativeTypeOf(rr)
+		if err != nil {
+			t.Errorf("%s: NativeTypeOf: %v", test.record, err)
+			continue
+		}
+		back, err := MakeDnsRR("www.example.test.", nType, 300, powerdns.Record{Content: &content})
+		if err != nil {
+			t.Errorf("%s: MakeDnsRR: %v", test.record, err)
+			continue
+		}
+		if !miekgdns.IsDuplicate(rr, back) {
+			t.Errorf("%s: round trip gave %s", test.record, back)
+		}
+	}
+}
+
+func TestConversionCoversTypePairs(t *testing.T) {
+	tested := make(map[uint16]bool)
+	for _, test := range conversionTests {
+		rr, err := miekgdns.NewRR("www.example.test. 300 IN " + test.record)
+		if err != nil {
+			t.Fatalf("%s: invalid record: %v", test.record, err)
+		}
+		tested[rr.Header().Rrtype] = true
+	}
+	for _, rrType := range metaTypes {
+		tested[rrType] = true
+	}
+
+	for _, pair := range typePairs {
+		if !tested[pair.dnsType] {
+			t.Errorf("no conversion test for type %s", pair.nativeType)
+		}
+	}
+}
+
+func TestConversionRefusesMetaTypes(t *testing.T) {
+	header := miekgdns.RR_Header{Name: "www.example.test.", Class: miekgdns.ClassINET, Ttl: 300}
+
+	tkey := &miekgdns.TKEY{Hdr: header, Algorithm: miekgdns.HmacSHA256, Key: "0102", KeySize: 2}
+	tkey.Hdr.Rrtype = miekgdns.TypeTKEY
+	tsig := &miekgdns.TSIG{Hdr: header, Algorithm: miekgdns.HmacSHA256, MAC: "0102", MACSize: 2}
+	tsig.Hdr.Rrtype = miekgdns.TypeTSIG
+
+	for _, rr := range []miekgdns.RR{tkey, tsig} {
+		if content, err := NativeContentOf(rr); err == nil {
+			t.Errorf("%s: got content %q, expected an error", miekgdns.TypeToString[rr.Header().Rrtype], content)
+		}
+	}
+}
+
+// PowerDNS writes SvcParams values unquoted, and accepts quoted ones
+func TestSvcbContentFromPowerDNS(t *testing.T) {
+	tests := []struct {
+		nType   powerdns.RRType
+		content string
+		record  string
+	}{
+		{RRTypeHTTPS, "1 . alpn=h3,h2 port=443", "HTTPS 1 . alpn=h3,h2 port=443"},
+		{RRTypeHTTPS, `1 . alpn="h3,h2"`, "HTTPS 1 . alpn=h3,h2"},
+		{RRTypeSVCB, "2 svc.example.test. ipv6hint=2001:db8::1,2001:db8::2", "SVCB 2 svc.example.test. ipv6hint=2001:db8::1,2001:db8::2"},
+	}
+	for _, test := range tests {
+		content := test.content
+		rr, err := MakeDnsRR("www.example.test.", test.nType, 300, powerdns.Record{Content: &content})
+		if err != nil {
+			t.Errorf("%s: MakeDnsRR: %v", test.content, err)
+			continue
+		}
+		expected, err := miekgdns.NewRR("www.example.test. 300 IN " + test.record)
+		if err != nil {
+			t.Fatalf("%s: invalid record: %v", test.record, err)
+		}
+		if !miekgdns.IsDuplicate(rr, expected) {
+			t.Errorf("%s: got %s, expected %s", test.content, rr, expected)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package powerdns
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/joeig/go-powerdns/v3"
+	miekgdns "github.com/miekg/dns"
+)
+
+const defaultAuditAccount = "tsigoat"
+
+type rrsetKey struct {
+	name  string
+	nType powerdns.RRType
+}
+
+func rrsetKeyOf(name string, nType powerdns.RRType) rrsetKey {
+	return rrsetKey{miekgdns.CanonicalName(name), nType}
+}
+
+// PowerDNS specific state of a RRset, not represented in the DNS records.
+// Disabled records are hidden from the update logic and are kept as they are by writes.
+type rrsetMetadata struct {
+	ttl      uint32
+	disabled []string
+	comments []powerdns.Comment
+}
+
+func metadataOf(set powerdns.RRset) *rrsetMetadata {
+	meta := &rrsetMetadata{
+		comments: set.Comments,
+	}
+	if set.TTL != nil {
+		meta.ttl = *set.TTL
+	}
+	for _, record := range set.Records {
+		if isSet(record.Disabled) && record.Content != nil {
+			meta.disabled = append(meta.disabled, *record.Content)
+		}
+	}
+	return meta
+}
+
+// Builds the replacement of a RRset, enabled records being the given content
+func (m *rrsetMetadata) replacement(name string, nType powerdns.RRType, ttl uint32, content []string) powerdns.RRset {
+	set := powerdns.RRset{
+		Name:       powerdns.String(miekgdns.Fqdn(name)),
+		Type:       powerdns.RRTypePtr(nType),
+		TTL:        powerdns.Uint32(ttl),
+		ChangeType: powerdns.ChangeTypePtr(powerdns.ChangeTypeReplace),
+		Records:    make([]powerdns.Record, 0, len(content)+len(m.disabled)),
+		Comments:   m.comments,
+	}
+
+	enabled := make(map[string]bool, len(content))
+	for _, c := range content {
+		enabled[c] = true
+		set.Records = append(set.Records, powerdns.Record{
+			Content:  powerdns.String(c),
+			Disabled: powerdns.Bool(false),
+			SetPTR:   powerdns.Bool(false),
+		})
+	}
+	// A record explicitly added by the update gets enabled
+	for _, c := range m.disabled {
+		if enabled[c] {
+			continue
+		}
+		set.Records = append(set.Records, powerdns.Record{
+			Content:  powerdns.String(c),
+			Disabled: powerdns.Bool(true),
+			SetPTR:   powerdns.Bool(false),
+		})
+	}
+	return set
+}
+
+// Replaces the comment previously stamped by the given account, other comments are left untouched
+func (m *rrsetMetadata) stamp(account string, issuer string, now time.Time) {
+	if issuer == "" {
+		issuer = "<unauthenticated>"
+	}
+	comment := powerdns.Comment{
+		Content:    powerdns.String(fmt.Sprintf("updated by %s at %s", issuer, now.UTC().Format(time.RFC3339))),
+		Account:    powerdns.String(account),
+		ModifiedAt: powerdns.Uint64(uint64(now.Unix())),
+	}
+
+	comments := make([]powerdns.Comment, 0, len(m.comments)+1)
+	for _, c := range m.comments {
+		if c.Account != nil && *c.Account == account {
+			continue
+		}
+		comments = append(comments, c)
+	}
+	m.comments = append(comments, comment)
+}
@@ -3,6 +3,9 @@ package powerdns
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/enix/tsigoat/pkg/adapters/common"
 	"github.com/joeig/go-powerdns/v3"
@@ -11,29 +14,59 @@ import (
 )
 
 type PowerDNSAdapterTransaction struct {
-	zone   string
-	client *powerdns.Client
-	logger *zap.SugaredLogger
+	ctx     context.Context
+	zone    string
+	adapter *PowerDNSAdapter
+	client  *powerdns.Client
+	logger  *zap.SugaredLogger
+	// set when the zone properties were fetched
+	info  *powerdns.Zone
+	dirty bool
+	// PowerDNS specific state of the RRsets seen by the transaction
+	metadata map[rrsetKey]*rrsetMetadata
 }
 
-func (a PowerDNSAdapter) NewTransaction(zone string, logger *zap.SugaredLogger) (common.IAdapterTransaction, error) {
-	return &PowerDNSAdapterTransaction{
-		zone,
-		powerdns.New(a.config.Url, a.config.VHost, powerdns.WithAPIKey(a.config.decodedKey)),
-		logger,
-	}, nil
+func (a *PowerDNSAdapter) NewTransaction(ctx context.Context, zone string, logger *zap.SugaredLogger) (common.IAdapterTransaction, error) {
+	t := &PowerDNSAdapterTransaction{
+		ctx:      ctx,
+		zone:     zone,
+		adapter:  a,
+		client:   a.client,
+		logger:   logger,
+		metadata: make(map[rrsetKey]*rrsetMetadata),
+	}
+
+	if a.config.CheckKind || a.config.Notify || a.config.Rectify {
+		info, err := t.client.Zones.Get(ctx, zone)
+		if err != nil {
+			return nil, fmt.Errorf("PowerDNS.NewTransaction: failed to get zone: %w", err)
+		}
+		t.info = info
+		logger.Debugw("got zone properties from the API", "zone", zone, "kind", kindOf(info), "dnssec", isSet(info.DNSsec),
+			"api_rectify", isSet(info.APIRectify))
+
+		if a.config.CheckKind {
+			switch kindOf(info) {
+			case powerdns.NativeZoneKind, powerdns.MasterZoneKind, powerdns.ProducerZoneKind:
+			default:
+				return nil, fmt.Errorf("PowerDNS.NewTransaction: zone of kind '%s': %w", kindOf(info),
+					common.ErrNotAuthoritative)
+			}
+		}
+	}
+
+	return t, nil
 }
 
-func (t PowerDNSAdapterTransaction) Zone() string {
+func (t *PowerDNSAdapterTransaction) Zone() string {
 	return t.zone
 }
 
-func (t PowerDNSAdapterTransaction) GetAll(rrName string) (RRsets map[uint16][]miekgdns.RR, retErr error) {
+func (t *PowerDNSAdapterTransaction) GetAll(rrName string) (RRsets map[uint16][]miekgdns.RR, retErr error) {
 	t.logger.Debugw("querying API for all records with name", "name", rrName)
-	ctx := context.Background()
 	RRsets = make(map[uint16][]miekgdns.RR)
 
-	resp, err := t.client.Records.Get(ctx, t.zone, rrName, nil)
+	resp, err := t.client.Records.Get(t.ctx, t.zone, rrName, nil)
 	if err != nil {
 		retErr = fmt.Errorf("PowerDNS.GetName: %w", err) // FIXME + logger
 		return
@@ -48,6 +81,7 @@ func (t PowerDNSAdapterTransaction) GetAll(rrName string) (RRsets map[uint16][]m
 			continue
 		}
 
+		t.metadata[rrsetKeyOf(*set.Name, *set.Type)] = metadataOf(set)
 		dnsSet, err := DnsRRsetOf(t.zone, set)
 		if err != nil {
 			retErr = fmt.Errorf("PowerDNS.GetName: %w", err) // FIXME + logger
@@ -65,9 +99,8 @@ func (t PowerDNSAdapterTransaction) GetAll(rrName string) (RRsets map[uint16][]m
 	return
 }
 
-func (t PowerDNSAdapterTransaction) GetSet(rrName string, rrType uint16) (RRset []miekgdns.RR, retErr error) {
+func (t *PowerDNSAdapterTransaction) GetSet(rrName string, rrType uint16) (RRset []miekgdns.RR, retErr error) {
 	t.logger.Debugw("querying API for records of name and type", "name", rrName, "type", miekgdns.TypeToString[rrType])
-	ctx := context.Background()
 
 	nType, err := ToNativeType(rrType)
 	if err != nil {
@@ -75,7 +108,7 @@ func (t PowerDNSAdapterTransaction) GetSet(rrName string, rrType uint16) (RRset
 		return
 	}
 
-	resp, err := t.client.Records.Get(ctx, t.zone, rrName, &nType)
+	resp, err := t.client.Records.Get(t.ctx, t.zone, rrName, &nType)
 	if err != nil {
 		retErr = fmt.Errorf("PowerDNS.GetSet: %w", err) // FIXME + logger
 		return
@@ -84,12 +117,14 @@ func (t PowerDNSAdapterTransaction) GetSet(rrName string, rrType uint16) (RRset
 	t.logger.Debugw("got records from the API", "name", rrName, "type", miekgdns.TypeToString[rrType], "count", len(resp))
 
 	bugged := false
+	t.metadata[rrsetKeyOf(rrName, nType)] = &rrsetMetadata{}
 	for _, set := range resp {
 		if rrName != *set.Name || nType != *set.Type {
 			bugged = true
 			continue
 		}
 
+		t.metadata[rrsetKeyOf(rrName, nType)] = metadataOf(set)
 		dnsSet, err := DnsRRsetOf(t.zone, set)
 		if err != nil {
 			retErr = fmt.Errorf("PowerDNS.GetSet: %w", err) // FIXME + logger
@@ -104,64 +139,188 @@ func (t PowerDNSAdapterTransaction) GetSet(rrName string, rrType uint16) (RRset
 	return
 }
 
-func (t PowerDNSAdapterTransaction) AddSet(RRset []miekgdns.RR) error {
+func (t *PowerDNSAdapterTransaction) AddSet(RRset []miekgdns.RR) error {
 	t.logger.Debugw("querying API to add a new RRset", "size", len(RRset))
 
 	var err error
-	ctx := context.Background()
 
 	name, pType, ttl, content, err := NativeRRsetOf(RRset)
 	if err != nil {
 		return fmt.Errorf("PowerDNS.AddSet: NativeRRset: %w", err) // FIXME + logger
 	}
 
-	err = t.client.Records.Add(ctx, t.zone, name, pType, ttl, content)
+	err = t.replace(name, pType, ttl, content)
 	if err != nil {
 		return fmt.Errorf("PowerDNS.AddSet: %w", err) // FIXME + logger
 	}
+	t.dirty = true
 	return nil
 }
 
-func (t PowerDNSAdapterTransaction) ChangeSet(RRset []miekgdns.RR) error {
+func (t *PowerDNSAdapterTransaction) ChangeSet(RRset []miekgdns.RR) error {
 	t.logger.Debugw("querying API to change a RRset", "size", len(RRset))
 
 	var err error
-	ctx := context.Background()
 
 	name, pType, ttl, content, err := NativeRRsetOf(RRset)
 	if err != nil {
 		return fmt.Errorf("PowerDNS.ChangeSet: NativeRRset: %w", err) // FIXME + logger
 	}
 
-	err = t.client.Records.Change(ctx, t.zone, name, pType, ttl, content)
+	err = t.replace(name, pType, ttl, content)
 	if err != nil {
 		return fmt.Errorf("PowerDNS.ChangeSet: %w", err) // FIXME + logger
 	}
+	t.dirty = true
 	return nil
 }
 
-func (t PowerDNSAdapterTransaction) DeleteSet(name string, recordType uint16) error {
+func (t *PowerDNSAdapterTransaction) DeleteSet(name string, recordType uint16) error {
 	t.logger.Debugw("querying API to delete a RRset", "name", name, "type", miekgdns.TypeToString[recordType])
 
 	var err error
-	ctx := context.Background()
 
 	pType, err := ToNativeType(recordType)
 	if err != nil {
 		return err // FIXME + logger
 	}
 
-	err = t.client.Records.Delete(ctx, t.zone, name, pType)
+	err = t.replace(name, pType, 0, nil)
 	if err != nil {
 		return fmt.Errorf("PowerDNS.DeleteSet: %w", err) // FIXME + logger
 	}
+	t.dirty = true
 	return nil
 }
 
-func (t PowerDNSAdapterTransaction) Commit() error {
-	return fmt.Errorf("!!! NOT IMPLEMENTED !!!")
+// Returns the metadata of a RRset, from the API if the transaction did not read it yet
+func (t *PowerDNSAdapterTransaction) metadataFor(name string, nType powerdns.RRType) (*rrsetMetadata, error) {
+	key := rrsetKeyOf(name, nType)
+	if meta, found := t.metadata[key]; found {
+		return meta, nil
+	}
+
+	t.logger.Debugw("querying API for RRset metadata", "name", name, "type", nType)
+	resp, err := t.client.Records.Get(t.ctx, t.zone, name, &nType)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &rrsetMetadata{}
+	for _, set := range resp {
+		if rrsetKeyOf(*set.Name, *set.Type) == key {
+			meta = metadataOf(set)
+		}
+	}
+	t.metadata[key] = meta
+	return meta, nil
+}
+
+// Replaces the enabled records of a RRset, disabled records and comments are carried over.
+// The RRset is deleted when nothing is left of it.
+func (t *PowerDNSAdapterTransaction) replace(name string, nType powerdns.RRType, ttl uint32, content []string) error {
+	meta, err := t.metadataFor(name, nType)
+	if err != nil {
+		return fmt.Errorf("failed to get RRset metadata: %w", err)
+	}
+
+	if len(content) == 0 && len(meta.disabled) == 0 {
+		if err := t.client.Records.Delete(t.ctx, t.zone, name, nType); err != nil {
+			return err
+		}
+		t.metadata[rrsetKeyOf(name, nType)] = &rrsetMetadata{}
+		return nil
+	}
+
+	if len(content) == 0 {
+		t.logger.Debugw("keeping disabled records of deleted RRset", "name", name, "type", nType,
+			"count", len(meta.disabled))
+		ttl = meta.ttl
+	}
+
+	updated := *meta
+	if t.adapter.config.AuditComments {
+		issuer, _ := common.IssuerFromContext(t.ctx)
+		updated.stamp(t.adapter.config.AuditAccount, issuer, time.Now())
+	}
+
+	set := updated.replacement(name, nType, ttl, content)
+	if err := t.client.Records.Patch(t.ctx, t.zone, &powerdns.RRsets{Sets: []powerdns.RRset{set}}); err != nil {
+		return err
+	}
+	t.metadata[rrsetKeyOf(name, nType)] = metadataOf(set)
+	return nil
+}
+
+// Changes are applied by the API as soon as they are sent, only post-commit actions are left.
+// Those are not reported as errors, since the zone content has been changed already.
+func (t *PowerDNSAdapterTransaction) Commit() error {
+	if !t.dirty || t.info == nil {
+		return nil
+	}
+
+	if t.adapter.config.Rectify {
+		if isSet(t.info.DNSsec) && !isSet(t.info.APIRectify) {
+			t.logger.Debugw("rectifying zone", "zone", t.zone)
+			if err := t.rectify(); err != nil {
+				t.logger.Errorw("failed to rectify DNSSEC zone after update", "zone", t.zone, "error", err.Error())
+			}
+		} else {
+			t.logger.Debugw("zone does not need rectification", "zone", t.zone)
+		}
+	}
+
+	if t.adapter.config.Notify {
+		switch kindOf(t.info) {
+		case powerdns.MasterZoneKind, powerdns.ProducerZoneKind:
+			t.logger.Debugw("asking PowerDNS to notify secondaries", "zone", t.zone)
+			if _, err := t.client.Zones.Notify(t.ctx, t.zone); err != nil {
+				t.logger.Errorw("failed to notify secondaries after update", "zone", t.zone, "error", err.Error())
+			}
+		default:
+			t.logger.Debugw("zone kind does not notify secondaries", "zone", t.zone, "kind", kindOf(t.info))
+		}
+	}
+
+	return nil
+}
+
+// Not provided by the client library
+func (t *PowerDNSAdapterTransaction) rectify() error {
+	zoneId := miekgdns.Fqdn(t.zone)
+	if t.info.ID != nil {
+		zoneId = *t.info.ID
+	}
+
+	// relative to the configured URL, which may have a base path when behind a reverse proxy
+	base, err := url.Parse(t.adapter.config.Url)
+	if err != nil {
+		return err
+	}
+	segments := []string{"api", "v1", "servers", t.client.VHost, "zones", zoneId, "rectify"}
+	for idx, segment := range segments {
+		segments[idx] = url.PathEscape(segment)
+	}
+	endpoint := base.JoinPath(segments...)
+
+	req, err := http.NewRequestWithContext(t.ctx, http.MethodPut, endpoint.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-API-Key", t.adapter.config.decodedKey)
+
+	resp, err := t.adapter.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected API response: %s", resp.Status)
+	}
+	return nil
 }
 
-func (t PowerDNSAdapterTransaction) Rollback() error {
-	return fmt.Errorf("!!! NOT IMPLEMENTED !!!")
+func (t *PowerDNSAdapterTransaction) Rollback() error {
+	return fmt.Errorf("PowerDNS.Rollback: %w", common.ErrRollbackNotSupported)
 }
@@ -0,0 +1,56 @@
+package powerdns
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joeig/go-powerdns/v3"
+	"go.uber.org/zap"
+)
+
+func TestRectifyURL(t *testing.T) {
+	tests := []struct {
+		base   string
+		zoneId string
+		path   string
+	}{
+		{"", "example.test.", "/api/v1/servers/localhost/zones/example.test./rectify"},
+		{"/pdns", "example.test.", "/pdns/api/v1/servers/localhost/zones/example.test./rectify"},
+		{"/pdns/", "0/24.2.0.192.in-addr.arpa.", "/pdns/api/v1/servers/localhost/zones/0%2F24.2.0.192.in-addr.arpa./rectify"},
+		{"", "0=2F24.2.0.192.in-addr.arpa.", "/api/v1/servers/localhost/zones/0=2F24.2.0.192.in-addr.arpa./rectify"},
+		{"", "odd?name.", "/api/v1/servers/localhost/zones/odd%3Fname./rectify"},
+	}
+
+	var path, key string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, key = r.URL.EscapedPath(), r.Header.Get("X-API-Key")
+	}))
+	defer server.Close()
+
+	for _, test := range tests {
+		adapter, err := NewPowerDNSAdapter("test", &PowerDNSAdapterConfiguration{Url: server.URL + test.base, Key: "secret"},
+			zap.NewNop().Sugar())
+		if err != nil {
+			t.Fatalf("NewPowerDNSAdapter: %v", err)
+		}
+		pdnsAdapter := adapter.(*PowerDNSAdapter)
+		transaction := &PowerDNSAdapterTransaction{
+			ctx:     context.Background(),
+			zone:    "example.test.",
+			adapter: pdnsAdapter,
+			client:  pdnsAdapter.client,
+			logger:  zap.NewNop().Sugar(),
+			info:    &powerdns.Zone{ID: &test.zoneId},
+		}
+
+		if err := transaction.rectify(); err != nil {
+			t.Errorf("%s%s: rectify: %v", test.base, test.zoneId, err)
+			continue
+		}
+		if path != test.path || key != "secret" {
+			t.Errorf("%s%s: got path %s and key %q, expected path %s", test.base, test.zoneId, path, key, test.path)
+		}
+	}
+}
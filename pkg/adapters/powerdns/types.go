@@ -7,6 +7,12 @@ import (
 	miekgdns "github.com/miekg/dns"
 )
 
+// Not defined by the PowerDNS client library
+const (
+	RRTypeSVCB  powerdns.RRType = "SVCB"
+	RRTypeHTTPS powerdns.RRType = "HTTPS"
+)
+
 type rrTypePair struct {
 	dnsType    uint16
 	nativeType powerdns.RRType
@@ -31,6 +37,7 @@ var (
 		{miekgdns.TypeEUI48, powerdns.RRTypeEUI48},
 		{miekgdns.TypeEUI64, powerdns.RRTypeEUI64},
 		{miekgdns.TypeHINFO, powerdns.RRTypeHINFO},
+		{miekgdns.TypeHTTPS, RRTypeHTTPS},
 		{miekgdns.TypeIPSECKEY, powerdns.RRTypeIPSECKEY},
 		{miekgdns.TypeKEY, powerdns.RRTypeKEY},
 		{miekgdns.TypeKX, powerdns.RRTypeKX},
@@ -51,6 +58,7 @@ var (
 		{miekgdns.TypeSPF, powerdns.RRTypeSPF},
 		{miekgdns.TypeSRV, powerdns.RRTypeSRV},
 		{miekgdns.TypeSSHFP, powerdns.RRTypeSSHFP},
+		{miekgdns.TypeSVCB, RRTypeSVCB},
 		{miekgdns.TypeTKEY, powerdns.RRTypeTKEY},
 		{miekgdns.TypeTLSA, powerdns.RRTypeTLSA},
 		{miekgdns.TypeTSIG, powerdns.RRTypeTSIG},
@@ -101,6 +109,17 @@ func DnsNameOf(rr powerdns.RRset) string {
 	return *rr.Name
 }
 
+func kindOf(zone *powerdns.Zone) powerdns.ZoneKind {
+	if zone.Kind == nil {
+		return ""
+	}
+	return *zone.Kind
+}
+
+func isSet(value *bool) bool {
+	return value != nil && *value
+}
+
 // FIXME missing checks
 func IsRRset(set powerdns.RRset) bool {
 	if len(set.Records) == 0 {
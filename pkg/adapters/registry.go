@@ -3,8 +3,13 @@ package adapters
 import (
 	"fmt"
 	"reflect"
+	"slices"
 
 	"github.com/enix/tsigoat/pkg/adapters/common"
+	"github.com/enix/tsigoat/pkg/adapters/fanout"
+	"github.com/enix/tsigoat/pkg/adapters/gsql"
+	"github.com/enix/tsigoat/pkg/adapters/memory"
+	"github.com/enix/tsigoat/pkg/adapters/plugin"
 	"github.com/enix/tsigoat/pkg/adapters/powerdns"
 	"go.uber.org/zap"
 )
@@ -18,6 +23,26 @@ func init() {
 		reflect.TypeFor[powerdns.PowerDNSAdapterConfiguration](),
 		reflect.TypeFor[powerdns.PowerDNSAdapter](),
 		powerdns.NewPowerDNSAdapter)
+	registerAdapter(
+		gsql.GenericSQLAdapterSlug,
+		reflect.TypeFor[gsql.GenericSQLAdapterConfiguration](),
+		reflect.TypeFor[gsql.GenericSQLAdapter](),
+		gsql.NewGenericSQLAdapter)
+	registerAdapter(
+		fanout.FanoutAdapterSlug,
+		reflect.TypeFor[fanout.FanoutAdapterConfiguration](),
+		reflect.TypeFor[fanout.FanoutAdapter](),
+		fanout.NewFanoutAdapter)
+	registerAdapter(
+		plugin.PluginAdapterSlug,
+		reflect.TypeFor[plugin.PluginAdapterConfiguration](),
+		reflect.TypeFor[plugin.PluginAdapter](),
+		plugin.NewPluginAdapter)
+	registerAdapter(
+		memory.MemoryAdapterSlug,
+		reflect.TypeFor[memory.MemoryAdapterConfiguration](),
+		reflect.TypeFor[memory.MemoryAdapter](),
+		memory.NewMemoryAdapter)
 }
 
 func registerAdapter(slug common.AdapterSlug, configType reflect.Type, concreteType reflect.Type,
@@ -74,6 +99,25 @@ func IsSlug(slug common.AdapterSlug) (valid bool) {
 	return
 }
 
+// Registered adapter slugs, sorted
+func Slugs() []string {
+	slugs := make([]string, 0, len(adapters))
+	for slug := range adapters {
+		slugs = append(slugs, string(slug))
+	}
+	slices.Sort(slugs)
+	return slugs
+}
+
+// Settings type of every registered adapter, by slug
+func ConfigTypes() map[common.AdapterSlug]reflect.Type {
+	types := make(map[common.AdapterSlug]reflect.Type, len(adapters))
+	for slug, info := range adapters {
+		types[slug] = info.ConfigType
+	}
+	return types
+}
+
 func NewAdapterConfiguration(slug common.AdapterSlug) (config common.IAdapterConfiguration, err error) {
 	info, err := adapterInfoBySlug(slug)
 	if err != nil {
@@ -94,7 +138,7 @@ func NewAdapter(name string, configuration common.IAdapterConfiguration, logger
 
 	adapter, err = info.Factory(name, configuration, logger)
 	if err != nil {
-		panic("FIXME message")
+		return nil, fmt.Errorf("failed to create %s adapter: %w", info.Slug, err)
 	}
 	return
 }
@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/dns/update"
+	miekgdns "github.com/miekg/dns"
+)
+
+const (
+	EventApplied  = "applied"
+	EventRejected = "rejected"
+	EventDryRun   = "dryrun"
+)
+
+// One record per update received, whether it was applied or not
+type Record struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Client string    `json:"client"`
+	// Name of the TSIG key signing the request, even when the signature is invalid
+	Key string `json:"key,omitempty"`
+	// Identity the update was authorized for
+	Identity      string   `json:"identity,omitempty"`
+	Zone          string   `json:"zone"`
+	Rcode         string   `json:"rcode"`
+	Reason        string   `json:"reason,omitempty"`
+	Prerequisites []string `json:"prerequisites,omitempty"`
+	Updates       []string `json:"updates,omitempty"`
+	// Contents of the changed RRsets, for applied updates and dry runs
+	RRsets []RRset `json:"rrsets,omitempty"`
+}
+
+// Contents of an RRset before and after an update, empty when absent
+type RRset struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+}
+
+func NewRRset(change update.RRsetChange) RRset {
+	return RRset{
+		Name:   change.Name,
+		Type:   miekgdns.TypeToString[change.Type],
+		Before: Strings(change.Before),
+		After:  Strings(change.After),
+	}
+}
+
+// Records in presentation format
+func Strings(rrs []miekgdns.RR) []string {
+	result := make([]string, 0, len(rrs))
+	for _, rr := range rrs {
+		result = append(result, rr.String())
+	}
+	return result
+}
+
+// Destination of the audit records. Sinks are safe for concurrent use.
+type Sink interface {
+	fmt.Stringer
+	Write(record *Record) error
+	Close() error
+}
@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Records appended to a file as JSON lines. The file is opened in append mode,
+// so it can be rotated by copying and truncating it.
+type FileSink struct {
+	path string
+	lock sync.Mutex
+	file *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	return &FileSink{path: path, file: file}, nil
+}
+
+func (s *FileSink) String() string {
+	return fmt.Sprintf("file %s", s.path)
+}
+
+func (s *FileSink) Write(record *Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// a single write per record, so lines are never interleaved
+	_, err = s.file.Write(line)
+	return err
+}
+
+func (s *FileSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.file.Close()
+}
@@ -0,0 +1,47 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+)
+
+// Records sent as JSON messages to syslog, with the auth private facility.
+// Rejected updates are logged with the warning severity, others with the info one.
+type SyslogSink struct {
+	address string
+	writer  *syslog.Writer
+}
+
+// The local syslog daemon is used when the address is empty
+func NewSyslogSink(network string, address string, tag string) (*SyslogSink, error) {
+	writer, err := syslog.Dial(network, address, syslog.LOG_AUTHPRIV|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &SyslogSink{address: address, writer: writer}, nil
+}
+
+func (s *SyslogSink) String() string {
+	if s.address == "" {
+		return "syslog"
+	}
+	return fmt.Sprintf("syslog %s", s.address)
+}
+
+func (s *SyslogSink) Write(record *Record) error {
+	message, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if record.Event == EventRejected {
+		return s.writer.Warning(string(message))
+	}
+	return s.writer.Info(string(message))
+}
+
+func (s *SyslogSink) Close() error {
+	return s.writer.Close()
+}
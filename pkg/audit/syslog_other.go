@@ -0,0 +1,26 @@
+//go:build windows || plan9
+
+package audit
+
+import (
+	"fmt"
+	"runtime"
+)
+
+type SyslogSink struct{}
+
+func NewSyslogSink(network string, address string, tag string) (*SyslogSink, error) {
+	return nil, fmt.Errorf("syslog is not supported on %s", runtime.GOOS)
+}
+
+func (s *SyslogSink) String() string {
+	return "syslog"
+}
+
+func (s *SyslogSink) Write(record *Record) error {
+	return fmt.Errorf("syslog is not supported on %s", runtime.GOOS)
+}
+
+func (s *SyslogSink) Close() error {
+	return nil
+}
@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultWebhookTimeout = 10 * time.Second
+	webhookQueueSize      = 1024
+)
+
+// Records posted one by one as JSON to an HTTP endpoint, in the background so updates are not
+// slowed down. Delivery failures are logged, records being dropped when the queue is full.
+type WebhookSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	logger  *zap.SugaredLogger
+	lock    sync.Mutex
+	closed  bool
+	queue   chan []byte
+	done    chan struct{}
+}
+
+func NewWebhookSink(url string, headers map[string]string, timeout time.Duration, logger *zap.SugaredLogger) *WebhookSink {
+	if timeout == 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	sink := &WebhookSink{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: timeout},
+		logger:  logger,
+		queue:   make(chan []byte, webhookQueueSize),
+		done:    make(chan struct{}),
+	}
+	go sink.deliver()
+	return sink
+}
+
+func (s *WebhookSink) String() string {
+	return fmt.Sprintf("webhook %s", s.url)
+}
+
+func (s *WebhookSink) Write(record *Record) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("sink closed, record dropped")
+	}
+	select {
+	case s.queue <- body:
+		return nil
+	default:
+		return fmt.Errorf("delivery queue is full, record dropped")
+	}
+}
+
+// Waits for the queued records to be delivered, as long as the timeout of a single delivery
+func (s *WebhookSink) Close() error {
+	s.lock.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.lock.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-time.After(s.client.Timeout):
+		return fmt.Errorf("%d record(s) not delivered", len(s.queue))
+	}
+}
+
+func (s *WebhookSink) deliver() {
+	defer close(s.done)
+
+	for body := range s.queue {
+		if err := s.post(body); err != nil {
+			s.logger.Errorw("failed to deliver audit record", "sink", s.String(), "error", err.Error())
+		}
+	}
+}
+
+func (s *WebhookSink) post(body []byte) error {
+	request, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range s.headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package audit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Records written while or after the sink closes are refused instead of panicking
+func TestWebhookWriteAfterClose(t *testing.T) {
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer endpoint.Close()
+	sink := NewWebhookSink(endpoint.URL, nil, time.Second, zap.NewNop().Sugar())
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				sink.Write(&Record{})
+			}
+		}()
+	}
+	if err := sink.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	wg.Wait()
+
+	if err := sink.Write(&Record{}); err == nil {
+		t.Error("record accepted by a closed sink")
+	}
+	if err := sink.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
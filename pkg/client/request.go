@@ -0,0 +1,95 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/enix/tsigoat/pkg/dns/update"
+	miekgdns "github.com/miekg/dns"
+)
+
+// EDNS buffer size advertised in requests, avoiding IP fragmentation
+const ednsBufferSize = 1232
+
+type operationKind int
+
+const (
+	operationAdd operationKind = iota
+	operationDeleteName
+	operationDeleteRRset
+	operationDeleteRR
+	prerequisiteNameUsed
+	prerequisiteNameNotUsed
+	prerequisiteRRsetUsed
+	prerequisiteRRsetNotUsed
+	prerequisiteRRUsed
+)
+
+type operation struct {
+	kind operationKind
+	rr   miekgdns.RR
+}
+
+// TSIG key used to sign a request
+type Key struct {
+	Name      string
+	Algorithm string
+	Secret    string
+}
+
+// An update message, with the server it is sent to
+type Request struct {
+	Server string
+	Zone   string
+	Key    *Key
+	// Asks the server to evaluate the update and report its changes without applying them
+	DryRun     bool
+	operations []operation
+}
+
+func (r *Request) IsEmpty() bool {
+	return len(r.operations) == 0
+}
+
+func (r *Request) add(kind operationKind, rr miekgdns.RR) {
+	r.operations = append(r.operations, operation{kind, rr})
+}
+
+// Builds the update message, signing is left to the sender
+func (r *Request) Message() (*miekgdns.Msg, error) {
+	if r.Zone == "" {
+		return nil, fmt.Errorf("no zone set")
+	}
+
+	msg := new(miekgdns.Msg)
+	msg.SetUpdate(miekgdns.Fqdn(r.Zone))
+	// lets servers explain rejections with extended DNS errors
+	msg.SetEdns0(ednsBufferSize, false)
+	if r.DryRun {
+		opt := msg.IsEdns0()
+		opt.Option = append(opt.Option, &miekgdns.EDNS0_LOCAL{Code: update.DryRunOption})
+	}
+	for _, op := range r.operations {
+		rrs := []miekgdns.RR{op.rr}
+		switch op.kind {
+		case operationAdd:
+			msg.Insert(rrs)
+		case operationDeleteName:
+			msg.RemoveName(rrs)
+		case operationDeleteRRset:
+			msg.RemoveRRset(rrs)
+		case operationDeleteRR:
+			msg.Remove(rrs)
+		case prerequisiteNameUsed:
+			msg.NameUsed(rrs)
+		case prerequisiteNameNotUsed:
+			msg.NameNotUsed(rrs)
+		case prerequisiteRRsetUsed:
+			msg.RRsetUsed(rrs)
+		case prerequisiteRRsetNotUsed:
+			msg.RRsetNotUsed(rrs)
+		case prerequisiteRRUsed:
+			msg.Used(rrs)
+		}
+	}
+	return msg, nil
+}
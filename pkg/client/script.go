@@ -0,0 +1,264 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	miekgdns "github.com/miekg/dns"
+)
+
+const defaultTTL = 3600
+
+// Builds requests from nsupdate style commands:
+//
+//	server <host> [port]
+//	zone <name>
+//	key [algorithm:]<name> <secret>
+//	ttl <seconds>
+//	[update] add <name> [ttl] [class] <type> <data>
+//	[update] del[ete] <name> [[ttl] [class] <type> [data]]
+//	prereq nxdomain|yxdomain <name>
+//	prereq nxrrset|yxrrset <name> [class] <type> [data]
+//	send
+//
+// Lines starting with ';' or '#' are comments. Pending changes are sent at the end of the script.
+type Script struct {
+	defaults Request
+	ttl      uint32
+	current  *Request
+	requests []*Request
+}
+
+// Server, zone and key of the defaults apply until changed by the script
+func NewScript(defaults Request) *Script {
+	script := &Script{defaults: defaults, ttl: defaultTTL}
+	script.current = script.next()
+	return script
+}
+
+func (s *Script) next() *Request {
+	request := s.defaults
+	request.operations = nil
+	return &request
+}
+
+func (s *Script) Parse(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	for number := 1; scanner.Scan(); number++ {
+		if err := s.Line(scanner.Text()); err != nil {
+			return fmt.Errorf("line %d: %w", number, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *Script) Line(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	fields := strings.Fields(line)
+	command, args := strings.ToLower(fields[0]), fields[1:]
+
+	switch command {
+	case "server":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("usage: server <host> [port]")
+		}
+		s.defaults.Server = args[0]
+		if len(args) == 2 {
+			s.defaults.Server = net.JoinHostPort(strings.Trim(args[0], "[]"), args[1])
+		}
+		s.current.Server = s.defaults.Server
+	case "zone":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: zone <name>")
+		}
+		s.defaults.Zone = miekgdns.Fqdn(args[0])
+		s.current.Zone = s.defaults.Zone
+	case "key":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: key [algorithm:]<name> <secret>")
+		}
+		key := &Key{Name: miekgdns.Fqdn(args[0]), Algorithm: miekgdns.HmacSHA256, Secret: args[1]}
+		if algorithm, name, found := strings.Cut(args[0], ":"); found {
+			key.Algorithm, key.Name = miekgdns.Fqdn(strings.ToLower(algorithm)), miekgdns.Fqdn(name)
+		}
+		s.defaults.Key = key
+		s.current.Key = key
+	case "ttl":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: ttl <seconds>")
+		}
+		ttl, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid TTL '%s'", args[0])
+		}
+		s.ttl = uint32(ttl)
+	case "update":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: update add|delete ...")
+		}
+		return s.update(strings.ToLower(args[0]), args[1:])
+	case "add", "del", "delete":
+		return s.update(command, args)
+	case "prereq":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: prereq nxdomain|yxdomain|nxrrset|yxrrset ...")
+		}
+		return s.prerequisite(strings.ToLower(args[0]), args[1:])
+	case "send":
+		s.flush()
+	default:
+		return fmt.Errorf("unknown command '%s'", fields[0])
+	}
+	return nil
+}
+
+// Returns the requests of the script, including pending changes
+func (s *Script) Requests() []*Request {
+	s.flush()
+	return s.requests
+}
+
+func (s *Script) flush() {
+	if !s.current.IsEmpty() {
+		s.requests = append(s.requests, s.current)
+	}
+	s.current = s.next()
+}
+
+func (s *Script) update(action string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing record name")
+	}
+
+	switch action {
+	case "add":
+		rr, err := s.record(args, true)
+		if err != nil {
+			return err
+		}
+		s.current.add(operationAdd, rr)
+	case "del", "delete":
+		name := miekgdns.Fqdn(args[0])
+		rrType, hasData, err := recordType(args[1:])
+		if err != nil {
+			return err
+		}
+		switch {
+		case rrType == 0:
+			s.current.add(operationDeleteName, &miekgdns.ANY{Hdr: miekgdns.RR_Header{Name: name}})
+		case !hasData:
+			s.current.add(operationDeleteRRset, &miekgdns.ANY{Hdr: miekgdns.RR_Header{Name: name, Rrtype: rrType}})
+		default:
+			rr, err := s.record(args, false)
+			if err != nil {
+				return err
+			}
+			s.current.add(operationDeleteRR, rr)
+		}
+	default:
+		return fmt.Errorf("unknown update action '%s'", action)
+	}
+	return nil
+}
+
+func (s *Script) prerequisite(condition string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing record name")
+	}
+	name := miekgdns.Fqdn(args[0])
+
+	switch condition {
+	case "nxdomain", "yxdomain":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: prereq %s <name>", condition)
+		}
+		kind := prerequisiteNameUsed
+		if condition == "nxdomain" {
+			kind = prerequisiteNameNotUsed
+		}
+		s.current.add(kind, &miekgdns.ANY{Hdr: miekgdns.RR_Header{Name: name}})
+	case "nxrrset", "yxrrset":
+		rrType, hasData, err := recordType(args[1:])
+		if err != nil {
+			return err
+		}
+		if rrType == 0 {
+			return fmt.Errorf("usage: prereq %s <name> [class] <type> [data]", condition)
+		}
+		switch {
+		case condition == "nxrrset" && hasData:
+			return fmt.Errorf("nxrrset prerequisites take no data")
+		case condition == "nxrrset":
+			s.current.add(prerequisiteRRsetNotUsed, &miekgdns.ANY{Hdr: miekgdns.RR_Header{Name: name, Rrtype: rrType}})
+		case hasData:
+			// value dependent, the record TTL is ignored
+			rr, err := s.record(args, false)
+			if err != nil {
+				return err
+			}
+			s.current.add(prerequisiteRRUsed, rr)
+		default:
+			s.current.add(prerequisiteRRsetUsed, &miekgdns.ANY{Hdr: miekgdns.RR_Header{Name: name, Rrtype: rrType}})
+		}
+	default:
+		return fmt.Errorf("unknown prerequisite '%s'", condition)
+	}
+	return nil
+}
+
+// Parses "<name> [ttl] [class] <type> <data>", with the script TTL when none is given
+func (s *Script) record(args []string, withTTL bool) (miekgdns.RR, error) {
+	fields := append([]string{miekgdns.Fqdn(args[0])}, args[1:]...)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("missing record type")
+	}
+	// the parser accepts records without data, which are only meant for deletions
+	if _, hasData, err := recordType(args[1:]); err != nil {
+		return nil, err
+	} else if !hasData {
+		return nil, fmt.Errorf("missing record data")
+	}
+	if _, err := strconv.ParseUint(fields[1], 10, 32); err != nil {
+		ttl := s.ttl
+		if !withTTL {
+			ttl = 0
+		}
+		fields = append([]string{fields[0], strconv.FormatUint(uint64(ttl), 10)}, fields[1:]...)
+	}
+
+	rr, err := miekgdns.NewRR(strings.Join(fields, " "))
+	if err != nil {
+		return nil, fmt.Errorf("invalid record: %w", err)
+	}
+	return rr, nil
+}
+
+// Returns the type of "[ttl] [class] <type> [data]", and whether data follows, zero when empty
+func recordType(args []string) (uint16, bool, error) {
+	if len(args) > 0 {
+		if _, err := strconv.ParseUint(args[0], 10, 32); err == nil {
+			args = args[1:]
+		}
+	}
+	if len(args) > 0 {
+		if _, found := miekgdns.StringToClass[strings.ToUpper(args[0])]; found {
+			args = args[1:]
+		}
+	}
+	if len(args) == 0 {
+		return 0, false, nil
+	}
+
+	rrType, found := miekgdns.StringToType[strings.ToUpper(args[0])]
+	if !found {
+		return 0, false, fmt.Errorf("unknown record type '%s'", args[0])
+	}
+	return rrType, len(args) > 1, nil
+}
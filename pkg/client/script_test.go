@@ -0,0 +1,202 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	miekgdns "github.com/miekg/dns"
+)
+
+func parseScript(t *testing.T, text string) []*Request {
+	t.Helper()
+
+	script := NewScript(Request{Server: "127.0.0.1:53", Zone: "example.test."})
+	if err := script.Parse(strings.NewReader(text)); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return script.Requests()
+}
+
+func TestScriptSettings(t *testing.T) {
+	tests := []struct {
+		line   string
+		server string
+		key    *Key
+	}{
+		{"server ns1.example.test", "ns1.example.test", nil},
+		{"server ns1.example.test 5353", "ns1.example.test:5353", nil},
+		{"server [2001:db8::53] 53", "[2001:db8::53]:53", nil},
+		{"key ops.example c2VjcmV0", "127.0.0.1:53", &Key{"ops.example.", miekgdns.HmacSHA256, "c2VjcmV0"}},
+		{"key HMAC-SHA512:ops.example. c2VjcmV0", "127.0.0.1:53", &Key{"ops.example.", miekgdns.HmacSHA512, "c2VjcmV0"}},
+	}
+	for _, test := range tests {
+		requests := parseScript(t, test.line+"\nadd www 300 A 192.0.2.1\n")
+		if len(requests) != 1 {
+			t.Fatalf("%s: expected a single request, got %d", test.line, len(requests))
+		}
+		request := requests[0]
+		if request.Server != test.server {
+			t.Errorf("%s: got server %s, expected %s", test.line, request.Server, test.server)
+		}
+		if (request.Key == nil) != (test.key == nil) || (test.key != nil && *request.Key != *test.key) {
+			t.Errorf("%s: got key %+v, expected %+v", test.line, request.Key, test.key)
+		}
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	lines := []string{
+		"server",
+		"server a b c",
+		"zone",
+		"key ops.example",
+		"ttl",
+		"ttl soon",
+		"ttl -1",
+		"update",
+		"update replace www A 192.0.2.1",
+		"add",
+		"add www",
+		"add www 300 A",
+		"add www 300 A not-an-address",
+		"delete",
+		"delete www BOGUS",
+		"prereq",
+		"prereq nxdomain",
+		"prereq nxdomain www A",
+		"prereq nxrrset www",
+		"prereq nxrrset www A 192.0.2.1",
+		"prereq exists www",
+		"bogus www",
+	}
+	for _, line := range lines {
+		script := NewScript(Request{Zone: "example.test."})
+		if err := script.Line(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+
+	// errors are reported with their line number
+	script := NewScript(Request{Zone: "example.test."})
+	err := script.Parse(strings.NewReader("; comment\n\nttl soon\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("expected an error on line 3, got %v", err)
+	}
+}
+
+// Changes are split into requests by send, and sent at the end otherwise
+func TestScriptSend(t *testing.T) {
+	tests := []struct {
+		script string
+		counts []int
+	}{
+		{"add www 300 A 192.0.2.1\nadd www 300 A 192.0.2.2\n", []int{2}},
+		{"add www 300 A 192.0.2.1\nsend\nadd www 300 A 192.0.2.2\n", []int{1, 1}},
+		{"add www 300 A 192.0.2.1\nsend\nadd www 300 A 192.0.2.2\nsend\n", []int{1, 1}},
+		{"send\nadd www 300 A 192.0.2.1\nsend\nsend\n", []int{1}},
+		{"; nothing\n", nil},
+	}
+	for _, test := range tests {
+		requests := parseScript(t, test.script)
+		var counts []int
+		for _, request := range requests {
+			counts = append(counts, len(request.operations))
+		}
+		if len(counts) != len(test.counts) {
+			t.Errorf("%q: got requests of %v operations, expected %v", test.script, counts, test.counts)
+			continue
+		}
+		for idx := range counts {
+			if counts[idx] != test.counts[idx] {
+				t.Errorf("%q: got requests of %v operations, expected %v", test.script, counts, test.counts)
+				break
+			}
+		}
+	}
+
+	// settings changed after a send apply to the next requests only
+	requests := parseScript(t, "add www 300 A 192.0.2.1\nsend\nzone other.test\nserver ns1.other.test\nadd www 300 A 192.0.2.2\n")
+	if len(requests) != 2 || requests[0].Zone != "example.test." || requests[0].Server != "127.0.0.1:53" ||
+		requests[1].Zone != "other.test." || requests[1].Server != "ns1.other.test" {
+		t.Errorf("unexpected zones and servers of requests %+v", requests)
+	}
+}
+
+// Records of the built message follow the class and TTL conventions of RFC 2136
+func TestScriptMessage(t *testing.T) {
+	requests := parseScript(t, `ttl 600
+prereq yxdomain www.example.test
+prereq nxdomain new.example.test
+prereq yxrrset www.example.test A
+prereq nxrrset www.example.test AAAA
+prereq yxrrset www.example.test IN A 192.0.2.1
+update add new.example.test A 192.0.2.3
+add new.example.test 60 IN TXT "text"
+delete old.example.test
+del www.example.test A
+delete www.example.test 300 IN A 192.0.2.2
+`)
+	if len(requests) != 1 {
+		t.Fatalf("expected a single request, got %d", len(requests))
+	}
+	msg, err := requests[0].Message()
+	if err != nil {
+		t.Fatalf("Message: %v", err)
+	}
+
+	if msg.Opcode != miekgdns.OpcodeUpdate || len(msg.Question) != 1 || msg.Question[0].Name != "example.test." ||
+		msg.Question[0].Qtype != miekgdns.TypeSOA {
+		t.Errorf("unexpected zone section %v", msg.Question)
+	}
+	if msg.IsEdns0() == nil {
+		t.Error("no EDNS0 record")
+	}
+
+	type header struct {
+		name   string
+		rrType uint16
+		class  uint16
+		ttl    uint32
+	}
+	sections := []struct {
+		name     string
+		records  []miekgdns.RR
+		expected []header
+	}{
+		{"prerequisite", msg.Answer, []header{
+			{"www.example.test.", miekgdns.TypeANY, miekgdns.ClassANY, 0},
+			{"new.example.test.", miekgdns.TypeANY, miekgdns.ClassNONE, 0},
+			{"www.example.test.", miekgdns.TypeA, miekgdns.ClassANY, 0},
+			{"www.example.test.", miekgdns.TypeAAAA, miekgdns.ClassNONE, 0},
+			{"www.example.test.", miekgdns.TypeA, miekgdns.ClassINET, 0},
+		}},
+		{"update", msg.Ns, []header{
+			{"new.example.test.", miekgdns.TypeA, miekgdns.ClassINET, 600},
+			{"new.example.test.", miekgdns.TypeTXT, miekgdns.ClassINET, 60},
+			{"old.example.test.", miekgdns.TypeANY, miekgdns.ClassANY, 0},
+			{"www.example.test.", miekgdns.TypeA, miekgdns.ClassANY, 0},
+			{"www.example.test.", miekgdns.TypeA, miekgdns.ClassNONE, 0},
+		}},
+	}
+	for _, section := range sections {
+		if len(section.records) != len(section.expected) {
+			t.Errorf("%s section: got %v", section.name, section.records)
+			continue
+		}
+		for idx, expected := range section.expected {
+			rr := section.records[idx].Header()
+			got := header{rr.Name, rr.Rrtype, rr.Class, rr.Ttl}
+			if got != expected {
+				t.Errorf("%s section, record %d: got %+v, expected %+v", section.name, idx, got, expected)
+			}
+		}
+	}
+
+	// the RR deletion and the value dependent prerequisite keep their data
+	if a, ok := msg.Ns[4].(*miekgdns.A); !ok || a.A.String() != "192.0.2.2" {
+		t.Errorf("unexpected deleted record %v", msg.Ns[4])
+	}
+	if a, ok := msg.Answer[4].(*miekgdns.A); !ok || a.A.String() != "192.0.2.1" {
+		t.Errorf("unexpected prerequisite record %v", msg.Answer[4])
+	}
+}
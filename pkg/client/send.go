@@ -0,0 +1,187 @@
+package client
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/dns/update"
+	miekgdns "github.com/miekg/dns"
+)
+
+const (
+	NetUdp = "udp"
+	NetTcp = "tcp"
+	NetTls = "tls"
+)
+
+// Status of the TSIG record of a response
+const (
+	TsigNone       = "none"
+	TsigVerified   = "verified"
+	TsigUnsigned   = "unsigned"
+	TsigInvalid    = "invalid"
+	TsigNoResponse = "no response"
+)
+
+type SendOptions struct {
+	Net     string
+	Tls     *tls.Config
+	Timeout time.Duration
+}
+
+// Outcome of a request, Error being set when no usable response was received
+type Result struct {
+	Server string `json:"server"`
+	Zone   string `json:"zone"`
+	Id     uint16 `json:"id"`
+	Rcode  string `json:"rcode,omitempty"`
+	// Extended DNS errors of the response (RFC 8914), explaining the response code
+	Reasons []string `json:"reasons,omitempty"`
+	// Set when the server evaluated the update without applying it, with the changes it would have made
+	DryRun  bool          `json:"dryrun,omitempty"`
+	Changes []string      `json:"changes,omitempty"`
+	Tsig    string        `json:"tsig"`
+	Rtt     time.Duration `json:"rtt"`
+	Error   string        `json:"error,omitempty"`
+}
+
+func (r *Result) Succeeded() bool {
+	return r.Error == "" && r.Rcode == miekgdns.RcodeToString[miekgdns.RcodeSuccess]
+}
+
+// Sends a request and waits for its response, the port defaults to 53 or 853 over TLS
+func Send(request *Request, options SendOptions) *Result {
+	msg, err := request.Message()
+	if err != nil {
+		return &Result{Server: request.Server, Zone: miekgdns.Fqdn(request.Zone), Tsig: TsigNone, Error: err.Error()}
+	}
+	return SendMessage(msg, request.Server, request.Key, options)
+}
+
+// Sends a prepared message, signed with the key unless it already carries a TSIG record
+func SendMessage(msg *miekgdns.Msg, server string, key *Key, options SendOptions) *Result {
+	result := &Result{Server: server, Id: msg.Id, Tsig: TsigNone}
+	if len(msg.Question) > 0 {
+		result.Zone = msg.Question[0].Name
+	}
+
+	server, err := serverAddress(server, options.Net)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Server = server
+
+	client := &miekgdns.Client{Net: options.Net, Timeout: options.Timeout}
+	if options.Net == NetTls {
+		client.Net, client.TLSConfig = "tcp-tls", options.Tls
+	}
+	if key != nil {
+		if _, err := base64.StdEncoding.DecodeString(key.Secret); err != nil {
+			result.Error = fmt.Sprintf("key '%s' secret decoding: %s", key.Name, err)
+			return result
+		}
+		name := miekgdns.Fqdn(miekgdns.CanonicalName(key.Name))
+		client.TsigSecret = map[string]string{name: key.Secret}
+		if msg.IsTsig() == nil {
+			msg.SetTsig(name, miekgdns.Fqdn(miekgdns.CanonicalName(key.Algorithm)), 300, time.Now().Unix())
+		}
+	}
+
+	response, rtt, err := client.Exchange(msg, server)
+	result.Rtt = rtt
+	if response == nil {
+		result.Tsig = TsigNoResponse
+		result.Error = err.Error()
+		return result
+	}
+	result.Rcode = miekgdns.RcodeToString[response.Rcode]
+	result.Reasons = extendedErrors(response)
+	result.DryRun, result.Changes = dryRunChanges(response)
+	result.Tsig = tsigStatus(key, response, err)
+	if err != nil && !isTsigError(err) {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func tsigStatus(key *Key, response *miekgdns.Msg, err error) string {
+	tsig := response.IsTsig()
+	switch {
+	case tsig == nil && key == nil:
+		return TsigNone
+	case tsig == nil:
+		return TsigUnsigned
+	case tsig.Error != miekgdns.RcodeSuccess:
+		// the server rejected the signature of the request
+		return miekgdns.RcodeToString[int(tsig.Error)]
+	case isTsigError(err):
+		return fmt.Sprintf("%s (%s)", TsigInvalid, err)
+	default:
+		return TsigVerified
+	}
+}
+
+func extendedErrors(response *miekgdns.Msg) []string {
+	var reasons []string
+
+	opt := response.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, option := range opt.Option {
+		ede, ok := option.(*miekgdns.EDNS0_EDE)
+		if !ok {
+			continue
+		}
+		reason, found := miekgdns.ExtendedErrorCodeToString[ede.InfoCode]
+		if !found {
+			reason = fmt.Sprintf("extended error %d", ede.InfoCode)
+		}
+		if ede.ExtraText != "" {
+			reason = fmt.Sprintf("%s: %s", reason, ede.ExtraText)
+		}
+		reasons = append(reasons, reason)
+	}
+	return reasons
+}
+
+func dryRunChanges(response *miekgdns.Msg) (bool, []string) {
+	opt := response.IsEdns0()
+	if opt == nil {
+		return false, nil
+	}
+	for _, option := range opt.Option {
+		if local, ok := option.(*miekgdns.EDNS0_LOCAL); ok && local.Code == update.DryRunOption {
+			if len(local.Data) == 0 {
+				return true, nil
+			}
+			return true, strings.Split(string(local.Data), "\n")
+		}
+	}
+	return false, nil
+}
+
+func isTsigError(err error) bool {
+	return errors.Is(err, miekgdns.ErrSig) || errors.Is(err, miekgdns.ErrTime) ||
+		errors.Is(err, miekgdns.ErrSecret) || errors.Is(err, miekgdns.ErrKeyAlg)
+}
+
+func serverAddress(server string, network string) (string, error) {
+	if server == "" {
+		return "", fmt.Errorf("no server set")
+	}
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server, nil
+	}
+	port := "53"
+	if network == NetTls {
+		port = "853"
+	}
+	return net.JoinHostPort(server, port), nil
+}
@@ -77,6 +77,11 @@ func (s *ServerSettings) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&s.UseAutoMemLimit, "auto-gomemlimit", true,
 		"Automatically set GOMEMLIMIT to match Linux cgroups memory limit")
 
+	s.AddConfigurationFlags(fs)
+}
+
+// Flags locating the configuration file, for commands reading it without running the server
+func (s *ServerSettings) AddConfigurationFlags(fs *pflag.FlagSet) {
 	fs.VarP(&s.ConfigurationFile.Type, "config-format", "e",
 		fmt.Sprintf("Decoder for the configuration file. Also sets the file extension for -p. Valid values are: %s.",
 			strings.Join(s.ConfigurationFile.Type.AllowedValues(), ", ")))
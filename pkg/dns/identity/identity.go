@@ -0,0 +1,82 @@
+package identity
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+type Kind string
+
+const (
+	KindTsig        Kind = "tsig"
+	KindSig0        Kind = "sig0"
+	KindCertificate Kind = "cert"
+	KindAddress     Kind = "ip"
+)
+
+// A requester identity, verified by the server before being handed to the authorization code
+type Identity struct {
+	Kind Kind
+	// Key name for TSIG and SIG(0), subject common name for certificates, address otherwise
+	Name string
+	// Signature algorithm for TSIG and SIG(0)
+	Algorithm string
+	// Certificate subject common name and DNS names, lowercased
+	Names []string
+	// Certificate issuers from the verified chain, by subject common name
+	Issuers []string
+	Address netip.Addr
+}
+
+func NewTsigIdentity(name string, algorithm string) Identity {
+	return Identity{Kind: KindTsig, Name: name, Algorithm: algorithm}
+}
+
+func NewSig0Identity(name string, algorithm string) Identity {
+	return Identity{Kind: KindSig0, Name: name, Algorithm: algorithm}
+}
+
+func NewAddressIdentity(address netip.Addr) Identity {
+	return Identity{Kind: KindAddress, Name: address.String(), Address: address.Unmap()}
+}
+
+// Returns the identity of a verified client certificate, if any
+func NewCertificateIdentity(state *tls.ConnectionState) (Identity, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return Identity{}, false
+	}
+
+	certificate := state.PeerCertificates[0]
+	identity := Identity{Kind: KindCertificate, Name: certificate.Subject.CommonName}
+
+	if certificate.Subject.CommonName != "" {
+		identity.Names = append(identity.Names, strings.ToLower(certificate.Subject.CommonName))
+	}
+	for _, name := range certificate.DNSNames {
+		name = strings.ToLower(name)
+		if !slices.Contains(identity.Names, name) {
+			identity.Names = append(identity.Names, name)
+		}
+	}
+
+	for _, chain := range state.VerifiedChains {
+		for _, issuer := range chain[1:] {
+			if !slices.Contains(identity.Issuers, issuer.Subject.CommonName) {
+				identity.Issuers = append(identity.Issuers, issuer.Subject.CommonName)
+			}
+		}
+	}
+	return identity, true
+}
+
+// Proves the requester holds a secret, as opposed to the source address
+func (i Identity) IsCryptographic() bool {
+	return i.Kind != KindAddress
+}
+
+func (i Identity) String() string {
+	return fmt.Sprintf("%s:%s", i.Kind, i.Name)
+}
@@ -0,0 +1,153 @@
+package identity
+
+import (
+	"fmt"
+	"net/netip"
+	"path"
+	"slices"
+	"strings"
+
+	miekgdns "github.com/miekg/dns"
+)
+
+// A rule of a zone, telling which identities may update it
+type Matcher interface {
+	Kind() Kind
+	Match(Identity) bool
+	String() string
+}
+
+// Parses rules such as:
+//
+//	tsig:<key name>
+//	sig0:<key name>
+//	cert:<name glob>[@<issuer common name>]
+//	ip:<address or prefix>
+func ParseMatcher(rule string) (Matcher, error) {
+	kind, value, found := strings.Cut(rule, ":")
+	if !found || value == "" {
+		return nil, fmt.Errorf("invalid identity rule '%s', expecting <kind>:<value>", rule)
+	}
+
+	switch Kind(kind) {
+	case KindTsig:
+		return NewTsigMatcher(value), nil
+	case KindSig0:
+		return &keyMatcher{KindSig0, value}, nil
+	case KindCertificate:
+		glob, issuer, _ := strings.Cut(value, "@")
+		return NewCertificateMatcher(glob, issuer)
+	case KindAddress:
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			address, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address or prefix '%s'", value)
+			}
+			prefix = netip.PrefixFrom(address.Unmap(), address.Unmap().BitLen())
+		}
+		return &addressMatcher{prefix.Masked()}, nil
+	default:
+		return nil, fmt.Errorf("unknown identity kind '%s'", kind)
+	}
+}
+
+type keyMatcher struct {
+	kind Kind
+	name string
+}
+
+// TSIG key names are compared in canonical form, like the keyring does
+func NewTsigMatcher(name string) Matcher {
+	return &keyMatcher{KindTsig, miekgdns.CanonicalName(name)}
+}
+
+func (m *keyMatcher) Kind() Kind {
+	return m.kind
+}
+
+func (m *keyMatcher) Match(identity Identity) bool {
+	if identity.Kind != m.kind {
+		return false
+	}
+	// SIG(0) signer names may be compressed, hence case-altered
+	if m.kind == KindSig0 {
+		return strings.EqualFold(identity.Name, m.name)
+	}
+	return miekgdns.CanonicalName(identity.Name) == m.name
+}
+
+func (m *keyMatcher) String() string {
+	return fmt.Sprintf("%s:%s", m.kind, m.name)
+}
+
+type certificateMatcher struct {
+	glob   string
+	labels []string
+	issuer string
+}
+
+// Matches certificates having a name matching the glob, issued by the given CA if not empty.
+// The glob is matched label by label, a '*' never spans several labels.
+func NewCertificateMatcher(glob string, issuer string) (Matcher, error) {
+	glob = strings.ToLower(glob)
+	labels := strings.Split(strings.TrimSuffix(glob, "."), ".")
+	for _, label := range labels {
+		if _, err := path.Match(label, ""); err != nil {
+			return nil, fmt.Errorf("invalid certificate name glob '%s': %w", glob, err)
+		}
+	}
+	return &certificateMatcher{glob, labels, issuer}, nil
+}
+
+func (m *certificateMatcher) Kind() Kind {
+	return KindCertificate
+}
+
+func (m *certificateMatcher) Match(identity Identity) bool {
+	if identity.Kind != KindCertificate {
+		return false
+	}
+	if m.issuer != "" && !slices.ContainsFunc(identity.Issuers, func(issuer string) bool {
+		return strings.EqualFold(issuer, m.issuer)
+	}) {
+		return false
+	}
+	return slices.ContainsFunc(identity.Names, m.matchName)
+}
+
+func (m *certificateMatcher) matchName(name string) bool {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	if len(labels) != len(m.labels) {
+		return false
+	}
+	for i, label := range labels {
+		if matched, _ := path.Match(m.labels[i], label); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *certificateMatcher) String() string {
+	if m.issuer != "" {
+		return fmt.Sprintf("%s:%s@%s", KindCertificate, m.glob, m.issuer)
+	}
+	return fmt.Sprintf("%s:%s", KindCertificate, m.glob)
+}
+
+type addressMatcher struct {
+	prefix netip.Prefix
+}
+
+func (m *addressMatcher) Kind() Kind {
+	return KindAddress
+}
+
+func (m *addressMatcher) Match(identity Identity) bool {
+	return identity.Kind == KindAddress && m.prefix.Contains(identity.Address)
+}
+
+func (m *addressMatcher) String() string {
+	return fmt.Sprintf("%s:%s", KindAddress, m.prefix)
+}
@@ -0,0 +1,208 @@
+package identity
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+type testAuthority struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+func newTestAuthority(t *testing.T, name string) *testAuthority {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testAuthority{certificate, key}
+}
+
+// Issues a client certificate
+func (a *testAuthority) issue(t *testing.T, commonName string, dnsNames ...string) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.certificate, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// Runs a TLS handshake with a client certificate, returning the server side connection state
+func handshake(t *testing.T, authority *testAuthority, client tls.Certificate) tls.ConnectionState {
+	t.Helper()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(authority.certificate)
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	server := tls.Server(serverConn, &tls.Config{
+		Certificates: []tls.Certificate{authority.issue(t, "server", "server.test")},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    pool,
+	})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- tls.Client(clientConn, &tls.Config{
+			Certificates: []tls.Certificate{client},
+			RootCAs:      pool,
+			ServerName:   "server.test",
+		}).Handshake()
+	}()
+	if err := server.Handshake(); err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("client handshake: %v", err)
+	}
+	return server.ConnectionState()
+}
+
+func TestCertificateIdentity(t *testing.T) {
+	authority := newTestAuthority(t, "Internal CA")
+	state := handshake(t, authority, authority.issue(t, "Host.K8s.Internal", "host.k8s.internal", "api.k8s.internal"))
+
+	identity, ok := NewCertificateIdentity(&state)
+	if !ok {
+		t.Fatal("no identity for a verified certificate")
+	}
+	if identity.Kind != KindCertificate || identity.Name != "Host.K8s.Internal" {
+		t.Errorf("unexpected identity %s", identity)
+	}
+	if len(identity.Names) != 2 || identity.Names[0] != "host.k8s.internal" || identity.Names[1] != "api.k8s.internal" {
+		t.Errorf("unexpected names %v", identity.Names)
+	}
+	if len(identity.Issuers) != 1 || identity.Issuers[0] != "Internal CA" {
+		t.Errorf("unexpected issuers %v", identity.Issuers)
+	}
+
+	// certificates not verified against the client CA carry no identity
+	state.VerifiedChains = nil
+	if _, ok := NewCertificateIdentity(&state); ok {
+		t.Error("got an identity for an unverified certificate")
+	}
+	if _, ok := NewCertificateIdentity(nil); ok {
+		t.Error("got an identity without TLS")
+	}
+}
+
+func TestCertificateMatcher(t *testing.T) {
+	authority := newTestAuthority(t, "Internal CA")
+	other := newTestAuthority(t, "Other CA")
+
+	tests := []struct {
+		rule      string
+		authority *testAuthority
+		names     []string
+		match     bool
+	}{
+		{"cert:host.k8s.internal", authority, []string{"host.k8s.internal"}, true},
+		{"cert:HOST.k8s.internal.", authority, []string{"host.k8s.internal"}, true},
+		{"cert:*.k8s.internal", authority, []string{"host.k8s.internal"}, true},
+		{"cert:*.k8s.internal", authority, []string{"k8s.internal"}, false},
+		// a '*' stands for a single label
+		{"cert:*.k8s.internal", authority, []string{"a.b.k8s.internal"}, false},
+		{"cert:*.*.k8s.internal", authority, []string{"a.b.k8s.internal"}, true},
+		{"cert:*.*.k8s.internal", authority, []string{"host.k8s.internal"}, false},
+		{"cert:*.internal", authority, []string{"host.k8s.internal"}, false},
+		{"cert:node-*.k8s.internal", authority, []string{"node-1.k8s.internal"}, true},
+		{"cert:node-*.k8s.internal", authority, []string{"node-1.evil.k8s.internal"}, false},
+		// any of the DNS names may match
+		{"cert:*.k8s.internal", authority, []string{"client", "host.k8s.internal"}, true},
+		{"cert:*.k8s.internal@Internal CA", authority, []string{"host.k8s.internal"}, true},
+		{"cert:*.k8s.internal@internal ca", authority, []string{"host.k8s.internal"}, true},
+		{"cert:*.k8s.internal@Internal CA", other, []string{"host.k8s.internal"}, false},
+	}
+	for _, test := range tests {
+		matcher, err := ParseMatcher(test.rule)
+		if err != nil {
+			t.Fatalf("%s: %v", test.rule, err)
+		}
+		state := handshake(t, test.authority, test.authority.issue(t, test.names[0], test.names[1:]...))
+		identity, ok := NewCertificateIdentity(&state)
+		if !ok {
+			t.Fatalf("%s: no identity for a verified certificate", test.rule)
+		}
+		if matched := matcher.Match(identity); matched != test.match {
+			t.Errorf("%s: got %t for %v, expected %t", test.rule, matched, test.names, test.match)
+		}
+	}
+}
+
+func TestParseMatcher(t *testing.T) {
+	tests := []struct {
+		rule  string
+		valid bool
+	}{
+		{"tsig:main.", true},
+		{"sig0:host.example.test.", true},
+		{"cert:*.k8s.internal@Internal CA", true},
+		{"cert:[a-.k8s.internal", false},
+		{"ip:192.0.2.0/24", true},
+		{"ip:2001:db8::1", true},
+		{"ip:not an address", false},
+		{"cert:", false},
+		{"token:secret", false},
+	}
+	for _, test := range tests {
+		if _, err := ParseMatcher(test.rule); (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, expected valid %t", test.rule, err, test.valid)
+		}
+	}
+}
+
+func TestAddressMatcher(t *testing.T) {
+	matcher, err := ParseMatcher("ip:192.0.2.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for address, match := range map[string]bool{"192.0.2.10": true, "::ffff:192.0.2.10": true, "198.51.100.1": false} {
+		if matched := matcher.Match(NewAddressIdentity(netip.MustParseAddr(address))); matched != match {
+			t.Errorf("%s: got %t, expected %t", address, matched, match)
+		}
+	}
+}
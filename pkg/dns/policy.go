@@ -0,0 +1,63 @@
+package dns
+
+import (
+	"net/netip"
+	"slices"
+
+	miekgdns "github.com/miekg/dns"
+)
+
+// Constraints on the records added to a zone by updates, the zero value allowing anything
+type Policy struct {
+	// TTL bounds, none when zero
+	MinTtl uint32
+	MaxTtl uint32
+	// Out of bounds TTLs are brought within bounds instead of refusing the update
+	ClampTtl bool
+	// Types allowed to be added, any when empty
+	Types []uint16
+	// Limits on the size of an RRset and on the number of records of a name, none when zero
+	MaxRRsetSize      int
+	MaxRecordsPerName int
+	// Networks the addresses of A and AAAA records must belong to, any when empty
+	Networks []netip.Prefix
+}
+
+func (p *Policy) AllowsType(rrType uint16) bool {
+	return len(p.Types) == 0 || slices.Contains(p.Types, rrType)
+}
+
+// Returns the TTL brought within bounds, and whether it was within bounds already
+func (p *Policy) BoundTtl(ttl uint32) (uint32, bool) {
+	if p.MinTtl > 0 && ttl < p.MinTtl {
+		return p.MinTtl, false
+	}
+	if p.MaxTtl > 0 && ttl > p.MaxTtl {
+		return p.MaxTtl, false
+	}
+	return ttl, true
+}
+
+// Records other than A and AAAA are always allowed
+func (p *Policy) AllowsAddress(rr miekgdns.RR) bool {
+	if len(p.Networks) == 0 {
+		return true
+	}
+
+	var ip []byte
+	switch rr := rr.(type) {
+	case *miekgdns.A:
+		ip = rr.A
+	case *miekgdns.AAAA:
+		ip = rr.AAAA
+	default:
+		return true
+	}
+
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	return slices.ContainsFunc(p.Networks, func(network netip.Prefix) bool { return network.Contains(addr) })
+}
@@ -0,0 +1,65 @@
+package sig0
+
+import (
+	"errors"
+	"fmt"
+
+	miekgdns "github.com/miekg/dns"
+)
+
+var ErrUnknownKey = errors.New("unknown SIG(0) key")
+
+// Public keys of SIG(0) signers, by canonical owner name
+type Keyring map[string][]*miekgdns.KEY
+
+func NewKeyring() Keyring {
+	return make(Keyring)
+}
+
+// The key is a KEY RR in presentation format, as written by dnssec-keygen -T KEY
+func (keyring Keyring) AddKey(text string) error {
+	rr, err := miekgdns.NewRR(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse KEY record: %w", err)
+	}
+	key, ok := rr.(*miekgdns.KEY)
+	if !ok || key == nil {
+		return fmt.Errorf("expected a KEY record")
+	}
+
+	name := miekgdns.CanonicalName(key.Hdr.Name)
+	for _, existing := range keyring[name] {
+		if existing.KeyTag() == key.KeyTag() && existing.Algorithm == key.Algorithm {
+			return fmt.Errorf("key '%s' with tag %d exists in keyring", name, key.KeyTag())
+		}
+	}
+	keyring[name] = append(keyring[name], key)
+	return nil
+}
+
+func (keyring Keyring) IsEmpty() bool {
+	return len(keyring) == 0
+}
+
+// Returns the SIG(0) record of the message, which must be the last additional RR
+func SignatureOf(msg *miekgdns.Msg) *miekgdns.SIG {
+	if len(msg.Extra) == 0 {
+		return nil
+	}
+	sig, _ := msg.Extra[len(msg.Extra)-1].(*miekgdns.SIG)
+	return sig
+}
+
+// Verifies the signature over the message as received on the wire, and returns the signing key
+func (keyring Keyring) Verify(raw []byte, sig *miekgdns.SIG) (*miekgdns.KEY, error) {
+	for _, key := range keyring[miekgdns.CanonicalName(sig.SignerName)] {
+		if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+			continue
+		}
+		if err := sig.Verify(key, raw); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
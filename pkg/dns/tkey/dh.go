@@ -0,0 +1,147 @@
+package tkey
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	miekgdns "github.com/miekg/dns"
+)
+
+// Diffie-Hellman KEY record algorithm (RFC 2539)
+const AlgorithmDH uint8 = 2
+
+// Smaller groups are refused, including well-known group 1
+const minPrimeBits = 1024
+
+// Well-known group 2 (RFC 2409 section 6.2), with generator 2
+var oakleyGroup2, _ = new(big.Int).SetString(
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74"+
+		"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437"+
+		"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE65381FFFFFFFFFFFFFFFF", 16)
+
+var ErrInvalidDhKey = errors.New("invalid Diffie-Hellman key")
+
+// Diffie-Hellman public key, as found in KEY records
+type DhKey struct {
+	Prime     *big.Int
+	Generator *big.Int
+	Public    *big.Int
+	// Index of the well-known group, zero when the prime is given explicitly
+	group uint8
+}
+
+// Public key format (RFC 2539 section 2):
+//
+//	prime length (2 bytes) | prime | generator length (2 bytes) | generator | public length (2 bytes) | public
+//
+// A prime length of 1 or 2 gives the index of a well-known group instead of the prime, with an empty generator.
+func ParseDhKey(key *miekgdns.KEY) (*DhKey, error) {
+	if key.Algorithm != AlgorithmDH {
+		return nil, fmt.Errorf("%w: unexpected algorithm %d", ErrInvalidDhKey, key.Algorithm)
+	}
+	data, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDhKey, err)
+	}
+
+	var fields [3][]byte
+	for idx := range fields {
+		if len(data) < 2 {
+			return nil, fmt.Errorf("%w: truncated key", ErrInvalidDhKey)
+		}
+		length := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+length {
+			return nil, fmt.Errorf("%w: truncated key", ErrInvalidDhKey)
+		}
+		fields[idx], data = data[2:2+length], data[2+length:]
+	}
+
+	dh := &DhKey{Public: new(big.Int).SetBytes(fields[2])}
+	switch len(fields[0]) {
+	case 1, 2:
+		dh.group = fields[0][len(fields[0])-1]
+		if dh.group != 2 || len(fields[1]) != 0 {
+			return nil, fmt.Errorf("%w: unsupported well-known group %d", ErrInvalidDhKey, dh.group)
+		}
+		dh.Prime = oakleyGroup2
+		dh.Generator = big.NewInt(2)
+	default:
+		dh.Prime = new(big.Int).SetBytes(fields[0])
+		dh.Generator = new(big.Int).SetBytes(fields[1])
+		if dh.Prime.BitLen() < minPrimeBits || !dh.Prime.ProbablyPrime(20) {
+			return nil, fmt.Errorf("%w: prime too small or not prime", ErrInvalidDhKey)
+		}
+	}
+
+	// degenerate values would give away the shared secret
+	limit := new(big.Int).Sub(dh.Prime, big.NewInt(1))
+	one := big.NewInt(1)
+	if dh.Generator.Cmp(one) <= 0 || dh.Generator.Cmp(limit) >= 0 ||
+		dh.Public.Cmp(one) <= 0 || dh.Public.Cmp(limit) >= 0 {
+		return nil, fmt.Errorf("%w: degenerate generator or public value", ErrInvalidDhKey)
+	}
+	return dh, nil
+}
+
+func (k *DhKey) Encode() string {
+	var data []byte
+	field := func(value []byte) {
+		data = binary.BigEndian.AppendUint16(data, uint16(len(value)))
+		data = append(data, value...)
+	}
+
+	if k.group != 0 {
+		field([]byte{k.group})
+		field(nil)
+	} else {
+		field(k.Prime.Bytes())
+		field(k.Generator.Bytes())
+	}
+	field(k.Public.Bytes())
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// Generates a key pair in the group of the peer key, returning the private value and the public key
+func GenerateDhKey(peer *DhKey) (*big.Int, *DhKey, error) {
+	// private value in [2, p-2]
+	private, err := rand.Int(rand.Reader, new(big.Int).Sub(peer.Prime, big.NewInt(3)))
+	if err != nil {
+		return nil, nil, err
+	}
+	private.Add(private, big.NewInt(2))
+
+	public := &DhKey{
+		Prime:     peer.Prime,
+		Generator: peer.Generator,
+		Public:    new(big.Int).Exp(peer.Generator, private, peer.Prime),
+		group:     peer.group,
+	}
+	return private, public, nil
+}
+
+func SharedSecret(private *big.Int, peer *DhKey) []byte {
+	return new(big.Int).Exp(peer.Public, private, peer.Prime).Bytes()
+}
+
+// RFC 2930 section 4.1:
+//
+//	keying material = XOR ( DH value, MD5 ( query data | DH value ) | MD5 ( server data | DH value ) )
+//
+// The result is as long as the shortest operand.
+func KeyingMaterial(shared []byte, queryData []byte, serverData []byte) []byte {
+	queryDigest := md5.Sum(append(append([]byte{}, queryData...), shared...))
+	serverDigest := md5.Sum(append(append([]byte{}, serverData...), shared...))
+	digests := append(queryDigest[:], serverDigest[:]...)
+
+	material := make([]byte, min(len(shared), len(digests)))
+	for idx := range material {
+		material[idx] = shared[idx] ^ digests[idx]
+	}
+	return material
+}
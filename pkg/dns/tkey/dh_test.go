@@ -0,0 +1,145 @@
+package tkey
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+
+	miekgdns "github.com/miekg/dns"
+)
+
+// A KEY record holding the length-prefixed fields of a Diffie-Hellman public key
+func dhRecord(fields ...[]byte) *miekgdns.KEY {
+	var data []byte
+	for _, field := range fields {
+		data = binary.BigEndian.AppendUint16(data, uint16(len(field)))
+		data = append(data, field...)
+	}
+	return &miekgdns.KEY{DNSKEY: miekgdns.DNSKEY{
+		Hdr:       miekgdns.RR_Header{Name: "key.example.", Rrtype: miekgdns.TypeKEY, Class: miekgdns.ClassINET},
+		Algorithm: AlgorithmDH,
+		PublicKey: base64.StdEncoding.EncodeToString(data),
+	}}
+}
+
+func TestParseDhKey(t *testing.T) {
+	var (
+		prime     = oakleyGroup2.Bytes()
+		two       = []byte{2}
+		public    = big.NewInt(0x1234567).Bytes()
+		lastValue = new(big.Int).Sub(oakleyGroup2, big.NewInt(1)).Bytes()
+	)
+
+	wrongAlgorithm := dhRecord([]byte{2}, nil, public)
+	wrongAlgorithm.Algorithm = miekgdns.RSASHA256
+
+	tests := []struct {
+		name   string
+		record *miekgdns.KEY
+		valid  bool
+		group  uint8
+	}{
+		{"well-known group 2", dhRecord([]byte{2}, nil, public), true, 2},
+		{"well-known group 2 on two bytes", dhRecord([]byte{0, 2}, nil, public), true, 2},
+		{"explicit prime", dhRecord(prime, two, public), true, 0},
+		{"well-known group 1", dhRecord([]byte{1}, nil, public), false, 0},
+		{"well-known group with a generator", dhRecord([]byte{2}, two, public), false, 0},
+		{"wrong algorithm", wrongAlgorithm, false, 0},
+		{"small prime", dhRecord(big.NewInt(23).Bytes(), two, []byte{5}), false, 0},
+		{"large non prime", dhRecord(new(big.Int).Add(oakleyGroup2, big.NewInt(2)).Bytes(), two, public), false, 0},
+		{"generator of 1", dhRecord(prime, []byte{1}, public), false, 0},
+		{"generator of 0", dhRecord(prime, nil, public), false, 0},
+		{"public value of 1", dhRecord([]byte{2}, nil, []byte{1}), false, 0},
+		{"public value of p-1", dhRecord([]byte{2}, nil, lastValue), false, 0},
+		{"public value of p", dhRecord([]byte{2}, nil, prime), false, 0},
+	}
+	for _, test := range tests {
+		key, err := ParseDhKey(test.record)
+		if !test.valid {
+			if !errors.Is(err, ErrInvalidDhKey) {
+				t.Errorf("%s: expected an invalid key error, got %v", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if key.Prime.Cmp(oakleyGroup2) != 0 || key.Generator.Cmp(big.NewInt(2)) != 0 || key.group != test.group {
+			t.Errorf("%s: unexpected group %d, generator %s", test.name, key.group, key.Generator)
+		}
+	}
+}
+
+func TestParseTruncatedDhKey(t *testing.T) {
+	data, _ := base64.StdEncoding.DecodeString(dhRecord([]byte{2}, nil, big.NewInt(5).Bytes()).PublicKey)
+	for length := range len(data) {
+		record := dhRecord()
+		record.PublicKey = base64.StdEncoding.EncodeToString(data[:length])
+		if _, err := ParseDhKey(record); !errors.Is(err, ErrInvalidDhKey) {
+			t.Errorf("%d bytes: expected an invalid key error, got %v", length, err)
+		}
+	}
+}
+
+// Both sides of an exchange derive the same keying material
+func TestDhRoundTrip(t *testing.T) {
+	for _, group := range [][]byte{{2}, oakleyGroup2.Bytes()} {
+		generator := []byte{2}
+		if len(group) == 1 {
+			generator = nil
+		}
+		template, err := ParseDhKey(dhRecord(group, generator, []byte{5}))
+		if err != nil {
+			t.Fatalf("ParseDhKey: %v", err)
+		}
+
+		clientPrivate, clientPublic, err := GenerateDhKey(template)
+		if err != nil {
+			t.Fatalf("GenerateDhKey: %v", err)
+		}
+		record := dhRecord()
+		record.PublicKey = clientPublic.Encode()
+		serverPeer, err := ParseDhKey(record)
+		if err != nil {
+			t.Fatalf("server side ParseDhKey: %v", err)
+		}
+
+		serverPrivate, serverPublic, err := GenerateDhKey(serverPeer)
+		if err != nil {
+			t.Fatalf("GenerateDhKey: %v", err)
+		}
+		record.PublicKey = serverPublic.Encode()
+		clientPeer, err := ParseDhKey(record)
+		if err != nil {
+			t.Fatalf("client side ParseDhKey: %v", err)
+		}
+		if clientPeer.group != template.group {
+			t.Errorf("group %d not kept by the server key, got %d", template.group, clientPeer.group)
+		}
+
+		queryData, serverData := []byte("query nonce"), []byte("server nonce")
+		clientMaterial := KeyingMaterial(SharedSecret(clientPrivate, clientPeer), queryData, serverData)
+		serverMaterial := KeyingMaterial(SharedSecret(serverPrivate, serverPeer), queryData, serverData)
+		if !bytes.Equal(clientMaterial, serverMaterial) {
+			t.Errorf("keying materials differ:\n%x\n%x", clientMaterial, serverMaterial)
+		}
+		if len(clientMaterial) != 2*16 {
+			t.Errorf("expected keying material as long as both digests, got %d bytes", len(clientMaterial))
+		}
+	}
+}
+
+func TestKeyingMaterial(t *testing.T) {
+	shared := bytes.Repeat([]byte{0xff}, 8)
+	material := KeyingMaterial(shared, []byte("query"), []byte("server"))
+	if len(material) != len(shared) {
+		t.Errorf("expected keying material as long as a short shared secret, got %d bytes", len(material))
+	}
+	if bytes.Equal(material, KeyingMaterial(shared, []byte("other"), []byte("server"))) {
+		t.Error("keying material doesn't depend on the query data")
+	}
+}
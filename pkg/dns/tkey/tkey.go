@@ -0,0 +1,58 @@
+package tkey
+
+import (
+	miekgdns "github.com/miekg/dns"
+)
+
+// TKEY modes (RFC 2930 section 2.5)
+const (
+	ModeServerAssignment   uint16 = 1
+	ModeDiffieHellman      uint16 = 2
+	ModeGssApi             uint16 = 3
+	ModeResolverAssignment uint16 = 4
+	ModeDeletion           uint16 = 5
+)
+
+var modeToString = map[uint16]string{
+	ModeServerAssignment:   "server-assignment",
+	ModeDiffieHellman:      "diffie-hellman",
+	ModeGssApi:             "gss-api",
+	ModeResolverAssignment: "resolver-assignment",
+	ModeDeletion:           "deletion",
+}
+
+func ModeToString(mode uint16) string {
+	if text, found := modeToString[mode]; found {
+		return text
+	}
+	return "unknown"
+}
+
+// Key negotiations are queries for the TKEY type, the key name being the question name
+func IsRequest(msg *miekgdns.Msg) bool {
+	return msg.Opcode == miekgdns.OpcodeQuery && len(msg.Question) == 1 &&
+		msg.Question[0].Qtype == miekgdns.TypeTKEY
+}
+
+// Returns the TKEY record of a request, found in the additional or answer section and owned by the question name
+func RequestOf(msg *miekgdns.Msg) *miekgdns.TKEY {
+	name := miekgdns.CanonicalName(msg.Question[0].Name)
+	for _, section := range [][]miekgdns.RR{msg.Extra, msg.Answer} {
+		for _, rr := range section {
+			if tkey, ok := rr.(*miekgdns.TKEY); ok && miekgdns.CanonicalName(tkey.Hdr.Name) == name {
+				return tkey
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the Diffie-Hellman KEY record of the requester, from the additional section
+func DhKeyOf(msg *miekgdns.Msg) *miekgdns.KEY {
+	for _, rr := range msg.Extra {
+		if key, ok := rr.(*miekgdns.KEY); ok && key.Algorithm == AlgorithmDH {
+			return key
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package dns
+
+import (
+	miekgdns "github.com/miekg/dns"
+)
+
+// Zones indexed by their labels, from the root down, for longest-suffix lookups.
+// Not safe for concurrent use.
+type ZoneTree struct {
+	root *zoneNode
+}
+
+type zoneNode struct {
+	zone     *Zone
+	children map[string]*zoneNode
+}
+
+func NewZoneTree() *ZoneTree {
+	return &ZoneTree{root: &zoneNode{}}
+}
+
+// Labels of a canonical name, from the rightmost one
+func reversedLabels(name string) []string {
+	labels := miekgdns.SplitDomainName(miekgdns.CanonicalName(name))
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return labels
+}
+
+func (t *ZoneTree) Insert(zone *Zone) {
+	node := t.root
+	for _, label := range reversedLabels(zone.Fqdn()) {
+		if node.children == nil {
+			node.children = make(map[string]*zoneNode)
+		}
+		child, found := node.children[label]
+		if !found {
+			child = &zoneNode{}
+			node.children[label] = child
+		}
+		node = child
+	}
+	node.zone = zone
+}
+
+// Empty branches are pruned
+func (t *ZoneTree) Remove(fqdn string) {
+	labels := reversedLabels(fqdn)
+	path := []*zoneNode{t.root}
+	node := t.root
+	for _, label := range labels {
+		child, found := node.children[label]
+		if !found {
+			return
+		}
+		path = append(path, child)
+		node = child
+	}
+	node.zone = nil
+
+	for i := len(labels); i > 0; i-- {
+		node := path[i]
+		if node.zone != nil || len(node.children) > 0 {
+			break
+		}
+		delete(path[i-1].children, labels[i-1])
+	}
+}
+
+// Returns the zone with exactly this name
+func (t *ZoneTree) Get(fqdn string) (*Zone, bool) {
+	node := t.root
+	for _, label := range reversedLabels(fqdn) {
+		child, found := node.children[label]
+		if !found {
+			return nil, false
+		}
+		node = child
+	}
+	return node.zone, node.zone != nil
+}
+
+// Returns the deepest zone the name belongs to
+func (t *ZoneTree) Match(name string) (*Zone, bool) {
+	match := t.root.zone
+	node := t.root
+	for _, label := range reversedLabels(name) {
+		child, found := node.children[label]
+		if !found {
+			break
+		}
+		node = child
+		if node.zone != nil {
+			match = node.zone
+		}
+	}
+	return match, match != nil
+}
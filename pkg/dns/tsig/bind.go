@@ -0,0 +1,76 @@
+package tsig
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	miekgdns "github.com/miekg/dns"
+)
+
+// Generates a secret for the algorithm, sized after its digest when size is zero
+func GenerateKey(algorithm string, size int) (TsigKey, error) {
+	hmac, err := NewHmac(miekgdns.Fqdn(miekgdns.CanonicalName(algorithm)))
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		size = hmac.Size()
+	}
+
+	key := make(TsigKey, size)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return key, nil
+}
+
+// Key statement as written by tsig-keygen, algorithm names being given without the trailing dot
+func FormatBindKey(name string, algorithm string, key TsigKey) string {
+	return fmt.Sprintf("key \"%s\" {\n\talgorithm %s;\n\tsecret \"%s\";\n};\n",
+		name, strings.TrimSuffix(miekgdns.CanonicalName(algorithm), "."), key.ToBase64())
+}
+
+// Key statement of a BIND configuration or key file
+type BindKey struct {
+	Name      string
+	Algorithm string
+	Secret    string
+}
+
+var (
+	bindComments     = regexp.MustCompile(`(?s)/\*.*?\*/|//[^\n]*|#[^\n]*`)
+	bindKeyStatement = regexp.MustCompile(`key\s+"?([^"\s{]+)"?\s*\{([^}]*)\}\s*;`)
+	bindKeyOption    = regexp.MustCompile(`(\w+)\s+"?([^";\s]+)"?\s*;`)
+)
+
+// Parses the key statements of a file as written by tsig-keygen, other statements are ignored
+func ParseBindKeys(data string) ([]BindKey, error) {
+	var keys []BindKey
+
+	for _, statement := range bindKeyStatement.FindAllStringSubmatch(bindComments.ReplaceAllString(data, ""), -1) {
+		key := BindKey{Name: miekgdns.Fqdn(statement[1])}
+		for _, option := range bindKeyOption.FindAllStringSubmatch(statement[2], -1) {
+			switch option[1] {
+			case "algorithm":
+				key.Algorithm = miekgdns.Fqdn(miekgdns.CanonicalName(option[2]))
+			case "secret":
+				key.Secret = option[2]
+			}
+		}
+		if key.Algorithm == "" || key.Secret == "" {
+			return nil, fmt.Errorf("key '%s' is missing its algorithm or secret", key.Name)
+		}
+		if _, err := base64.StdEncoding.DecodeString(key.Secret); err != nil {
+			return nil, fmt.Errorf("key '%s' secret decoding: %w", key.Name, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no key statement found")
+	}
+	return keys, nil
+}
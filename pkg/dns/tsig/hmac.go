@@ -39,6 +39,24 @@ func NewHmac(algorithm string) (HmacAlgorithm, error) {
 	}
 }
 
+// Digest size in bytes, which is also the recommended key size
+func (alg HmacAlgorithm) Size() int {
+	switch alg {
+	case HmacSHA1:
+		return sha1.Size
+	case HmacSHA224:
+		return sha256.Size224
+	case HmacSHA256:
+		return sha256.Size
+	case HmacSHA384:
+		return sha512.Size384
+	case HmacSHA512:
+		return sha512.Size
+	default:
+		panic("unknown HMAC algorithm")
+	}
+}
+
 func (alg HmacAlgorithm) Sum(msg []byte, key []byte) ([]byte, error) {
 	var h hash.Hash
 
@@ -3,21 +3,47 @@ package tsig
 import (
 	"encoding/base64"
 	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	miekgdns "github.com/miekg/dns"
 )
 
 type TsigKey []byte
 
-type TsigKeyring map[string]TsigKey
+// Session key negotiated with TKEY, valid until its expiration
+type DynamicKey struct {
+	Key       TsigKey
+	Algorithm string
+	// Static key the session key was negotiated with, authorizations are inherited from it
+	Owner      string
+	Expiration time.Time
+}
+
+// Static keys come from the configuration, dynamic ones are negotiated at runtime and expire.
+// Disabled static keys are kept, but neither them nor their session keys can be used.
+// Key names are looked up in canonical form, whatever their case and trailing dot.
+type TsigKeyring struct {
+	lock     sync.RWMutex
+	static   map[string]TsigKey
+	dynamic  map[string]*DynamicKey
+	disabled map[string]bool
+}
 
-func NewTsigKeyring() TsigKeyring {
-	return make(TsigKeyring, 0)
+func NewTsigKeyring() *TsigKeyring {
+	return &TsigKeyring{
+		static:   make(map[string]TsigKey),
+		dynamic:  make(map[string]*DynamicKey),
+		disabled: make(map[string]bool),
+	}
 }
 
 func (k TsigKey) ToBase64() string {
 	return base64.StdEncoding.EncodeToString(k)
 }
 
-func (keyring TsigKeyring) AddEncodedKey(name string, key string) error {
+func (keyring *TsigKeyring) AddEncodedKey(name string, key string) error {
 	decoded, err := base64.StdEncoding.DecodeString(key)
 	if err != nil {
 		return fmt.Errorf("key decoding: %w", err)
@@ -25,24 +51,135 @@ func (keyring TsigKeyring) AddEncodedKey(name string, key string) error {
 	return keyring.AddKey(name, decoded)
 }
 
-func (keyring TsigKeyring) AddKey(name string, key []byte) error {
-	if _, found := keyring[name]; found {
+func (keyring *TsigKeyring) AddKey(name string, key []byte) error {
+	name = miekgdns.CanonicalName(name)
+	keyring.lock.Lock()
+	defer keyring.lock.Unlock()
+
+	if _, found := keyring.static[name]; found {
 		return fmt.Errorf("key '%s' exists in keyring", name)
 	}
 
-	keyring[name] = key
+	keyring.static[name] = key
 	return nil
 }
 
-func (keyring TsigKeyring) HasKey(name string) bool {
-	_, found := keyring[name]
+// Only static keys are considered
+func (keyring *TsigKeyring) HasKey(name string) bool {
+	name = miekgdns.CanonicalName(name)
+	keyring.lock.RLock()
+	defer keyring.lock.RUnlock()
+
+	_, found := keyring.static[name]
+	return found
+}
+
+// Names of the static keys, sorted
+func (keyring *TsigKeyring) Names() []string {
+	keyring.lock.RLock()
+	defer keyring.lock.RUnlock()
+
+	names := make([]string, 0, len(keyring.static))
+	for name := range keyring.static {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Returns a static key, or a dynamic key which did not expire, unless disabled
+func (keyring *TsigKeyring) Key(name string) TsigKey {
+	name = miekgdns.CanonicalName(name)
+	keyring.lock.RLock()
+	defer keyring.lock.RUnlock()
+
+	if key, found := keyring.static[name]; found {
+		if keyring.disabled[name] {
+			return nil
+		}
+		return key
+	}
+	if dynamic, found := keyring.dynamic[name]; found && time.Now().Before(dynamic.Expiration) {
+		if keyring.disabled[miekgdns.CanonicalName(dynamic.Owner)] {
+			return nil
+		}
+		return dynamic.Key
+	}
+	return nil
+}
+
+func (keyring *TsigKeyring) SetDisabled(name string, disabled bool) error {
+	name = miekgdns.CanonicalName(name)
+	keyring.lock.Lock()
+	defer keyring.lock.Unlock()
+
+	if _, found := keyring.static[name]; !found {
+		return fmt.Errorf("unknown key '%s'", name)
+	}
+	if disabled {
+		keyring.disabled[name] = true
+	} else {
+		delete(keyring.disabled, name)
+	}
+	return nil
+}
+
+func (keyring *TsigKeyring) IsDisabled(name string) bool {
+	name = miekgdns.CanonicalName(name)
+	keyring.lock.RLock()
+	defer keyring.lock.RUnlock()
+
+	return keyring.disabled[name]
+}
+
+// Expired keys are dropped before the limit is checked, zero meaning no limit
+func (keyring *TsigKeyring) AddDynamicKey(name string, key *DynamicKey, limit int) error {
+	name = miekgdns.CanonicalName(name)
+	keyring.lock.Lock()
+	defer keyring.lock.Unlock()
+
+	keyring.prune(time.Now())
+
+	if _, found := keyring.static[name]; found {
+		return fmt.Errorf("key '%s' exists in keyring", name)
+	}
+	if _, found := keyring.dynamic[name]; found {
+		return fmt.Errorf("key '%s' exists in keyring", name)
+	}
+	if limit > 0 && len(keyring.dynamic) >= limit {
+		return fmt.Errorf("too many dynamic keys in keyring")
+	}
+
+	keyring.dynamic[name] = key
+	return nil
+}
+
+func (keyring *TsigKeyring) DynamicKey(name string) (*DynamicKey, bool) {
+	name = miekgdns.CanonicalName(name)
+	keyring.lock.RLock()
+	defer keyring.lock.RUnlock()
+
+	dynamic, found := keyring.dynamic[name]
+	if !found || !time.Now().Before(dynamic.Expiration) {
+		return nil, false
+	}
+	return dynamic, true
+}
+
+func (keyring *TsigKeyring) RemoveDynamicKey(name string) bool {
+	name = miekgdns.CanonicalName(name)
+	keyring.lock.Lock()
+	defer keyring.lock.Unlock()
+
+	_, found := keyring.dynamic[name]
+	delete(keyring.dynamic, name)
 	return found
 }
 
-func (keyring TsigKeyring) Key(name string) TsigKey {
-	key, found := keyring[name]
-	if !found {
-		return nil
+func (keyring *TsigKeyring) prune(now time.Time) {
+	for name, dynamic := range keyring.dynamic {
+		if !now.Before(dynamic.Expiration) {
+			delete(keyring.dynamic, name)
+		}
 	}
-	return key
 }
@@ -26,6 +26,14 @@ func (p *TsigProvider) generate(msg []byte, t *miekgdns.TSIG) ([]byte, error) {
 		return nil, miekgdns.ErrSecret
 	}
 
+	// session keys may only be used with the negotiated algorithm
+	if dynamic, found := p.keyring.DynamicKey(keyName); found &&
+		miekgdns.CanonicalName(dynamic.Algorithm) != miekgdns.CanonicalName(t.Algorithm) {
+		p.logger.Debugw("failed to compute MAC: algorithm differs from the negotiated one", "key", keyName,
+			"hmac", t.Algorithm, "negotiated", dynamic.Algorithm)
+		return nil, miekgdns.ErrKeyAlg
+	}
+
 	// TODO check if canonicalization of t.Algorithm is needed
 	tsigHmac, err := NewHmac(t.Algorithm)
 	if err != nil {
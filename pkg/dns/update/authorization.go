@@ -2,46 +2,58 @@ package update
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/enix/tsigoat/pkg/dns"
+	"github.com/enix/tsigoat/pkg/dns/identity"
 )
 
 type Authorization struct {
 	Zone       *dns.Zone
-	authKey    string
-	authAlg    string
-	authPassed bool
+	identities []identity.Identity
+	authorized *identity.Identity
 }
 
-func (a *Authorization) VerifiedIssuer(key string, algorithm string) {
-	if a.authPassed {
-		panic("cannot mark authentication status again")
+// Identities must have been verified by the caller
+func (a *Authorization) AddIdentity(id identity.Identity) {
+	if a.authorized != nil {
+		panic("cannot add an identity after evaluation")
 	}
-	a.authKey = key
-	a.authAlg = algorithm
-	a.authPassed = true
+	a.identities = append(a.identities, id)
+}
+
+// Returns the identity the update was authorized for, if any
+func (a *Authorization) Issuer() (string, bool) {
+	if a.authorized == nil {
+		return "", false
+	}
+	return a.authorized.String(), true
 }
 
 func (a *Authorization) Evaluate() error {
-	if a.authPassed == true {
-		// Check the key can perform updates on this zone
-		if a.Zone.KeyIsAuthorized(a.authKey) == false {
-			return fmt.Errorf("unauthorized key")
+	// The first identity allowed by the zone rules wins
+	for _, id := range a.identities {
+		if !a.Zone.Authorizes(id) {
+			continue
 		}
 
 		// Check the HMAC algorithm is allowed
-		if a.Zone.AlgorithmIsPermitted(a.authAlg) == false {
+		if id.Kind == identity.KindTsig && a.Zone.AlgorithmIsPermitted(id.Algorithm) == false {
 			return fmt.Errorf("forbidden HMAC algorithm")
 		}
-	} else {
-		// Check if we should block unauthenticated updates
-		if a.Zone.HasAuthenticationDisabled() == false {
-			// An early check should have been made in Server.Handle() too
-			return fmt.Errorf("zone require authentication")
-		}
+
+		a.authorized = &id
+		return nil
 	}
 
-	// FIXME implement non crypto authorization schemes here
+	// Check if we should block unauthenticated updates
+	if a.Zone.HasAuthenticationDisabled() == false {
+		if slices.ContainsFunc(a.identities, identity.Identity.IsCryptographic) {
+			return fmt.Errorf("unauthorized identity")
+		}
+		// An early check should have been made in Server.Handle() too
+		return fmt.Errorf("zone require authentication")
+	}
 
 	return nil
 }
@@ -0,0 +1,177 @@
+package update
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/enix/tsigoat/pkg/adapters/common"
+	miekgdns "github.com/miekg/dns"
+)
+
+// EDNS0 option requesting a dry run of an update, from the local use range (RFC 6891 section 9).
+// Responses to dry runs carry the option back, with the changes that would have been made.
+const DryRunOption uint16 = 65001
+
+const (
+	ChangeAdd    = "add"
+	ChangeDelete = "delete"
+)
+
+// A record added or deleted by an update
+type Change struct {
+	Action string
+	Record miekgdns.RR
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s", c.Action, c.Record.String())
+}
+
+// Contents of an RRset before and after an update, empty when the RRset is absent
+type RRsetChange struct {
+	Name   string
+	Type   uint16
+	Before []miekgdns.RR
+	After  []miekgdns.RR
+}
+
+// Records deleted from and added to the RRset, compared in presentation format
+func (c *RRsetChange) Changes() []Change {
+	var changes []Change
+
+	contains := func(set []miekgdns.RR, rr miekgdns.RR) bool {
+		return slices.ContainsFunc(set, func(other miekgdns.RR) bool { return other.String() == rr.String() })
+	}
+	for _, rr := range c.Before {
+		if !contains(c.After, rr) {
+			changes = append(changes, Change{ChangeDelete, rr})
+		}
+	}
+	for _, rr := range c.After {
+		if !contains(c.Before, rr) {
+			changes = append(changes, Change{ChangeAdd, rr})
+		}
+	}
+	return changes
+}
+
+type rrsetKey struct {
+	name   string
+	rrType uint16
+}
+
+// Transaction recording the contents of the RRsets an update changes. For dry runs, the changes
+// are kept to the transaction instead of reaching the backend, even with adapters that are not
+// transactional, later reads of the update seeing them.
+type recordingTransaction struct {
+	common.IAdapterTransaction
+	dryRun bool
+	// RRsets changed by a dry run, empty once deleted
+	overlay map[rrsetKey][]miekgdns.RR
+	rrsets  []*RRsetChange
+	changed map[rrsetKey]*RRsetChange
+}
+
+func newRecordingTransaction(transaction common.IAdapterTransaction, dryRun bool) *recordingTransaction {
+	return &recordingTransaction{
+		IAdapterTransaction: transaction,
+		dryRun:              dryRun,
+		overlay:             make(map[rrsetKey][]miekgdns.RR),
+		changed:             make(map[rrsetKey]*RRsetChange),
+	}
+}
+
+func (t *recordingTransaction) GetAll(name string) (map[uint16][]miekgdns.RR, error) {
+	sets, err := t.IAdapterTransaction.GetAll(name)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint16][]miekgdns.RR, len(sets))
+	for rrType, set := range sets {
+		result[rrType] = set
+	}
+	canonical := miekgdns.CanonicalName(name)
+	for key, set := range t.overlay {
+		if key.name != canonical {
+			continue
+		}
+		if len(set) == 0 {
+			delete(result, key.rrType)
+		} else {
+			result[key.rrType] = slices.Clone(set)
+		}
+	}
+	return result, nil
+}
+
+func (t *recordingTransaction) GetSet(name string, rrType uint16) ([]miekgdns.RR, error) {
+	if set, found := t.overlay[rrsetKey{miekgdns.CanonicalName(name), rrType}]; found {
+		return slices.Clone(set), nil
+	}
+	return t.IAdapterTransaction.GetSet(name, rrType)
+}
+
+func (t *recordingTransaction) AddSet(set []miekgdns.RR) error {
+	if len(set) == 0 {
+		return fmt.Errorf("Recording.AddSet: empty RRset")
+	}
+	return t.record(set[0].Header().Name, set[0].Header().Rrtype, set, func() error {
+		return t.IAdapterTransaction.AddSet(set)
+	})
+}
+
+func (t *recordingTransaction) ChangeSet(set []miekgdns.RR) error {
+	if len(set) == 0 {
+		return fmt.Errorf("Recording.ChangeSet: empty RRset")
+	}
+	return t.record(set[0].Header().Name, set[0].Header().Rrtype, set, func() error {
+		return t.IAdapterTransaction.ChangeSet(set)
+	})
+}
+
+func (t *recordingTransaction) DeleteSet(name string, rrType uint16) error {
+	return t.record(name, rrType, nil, func() error {
+		return t.IAdapterTransaction.DeleteSet(name, rrType)
+	})
+}
+
+func (t *recordingTransaction) Commit() error {
+	if t.dryRun {
+		return fmt.Errorf("dry run transactions cannot be committed")
+	}
+	return t.IAdapterTransaction.Commit()
+}
+
+// Keeps the RRset contents before its first change, then applies the change unless in a dry run
+func (t *recordingTransaction) record(name string, rrType uint16, set []miekgdns.RR, apply func() error) error {
+	key := rrsetKey{miekgdns.CanonicalName(name), rrType}
+	change, found := t.changed[key]
+	if !found {
+		current, err := t.GetSet(name, rrType)
+		if err != nil {
+			return err
+		}
+		change = &RRsetChange{Name: name, Type: rrType, Before: current}
+		t.changed[key] = change
+		t.rrsets = append(t.rrsets, change)
+	}
+
+	if t.dryRun {
+		t.overlay[key] = slices.Clone(set)
+	} else if err := apply(); err != nil {
+		return err
+	}
+	change.After = slices.Clone(set)
+	return nil
+}
+
+// RRsets whose contents changed, in the order they were first changed
+func (t *recordingTransaction) changes() []RRsetChange {
+	var rrsets []RRsetChange
+	for _, change := range t.rrsets {
+		if len(change.Changes()) > 0 {
+			rrsets = append(rrsets, *change)
+		}
+	}
+	return rrsets
+}
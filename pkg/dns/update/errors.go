@@ -0,0 +1,53 @@
+package update
+
+import (
+	"errors"
+	"fmt"
+
+	miekgdns "github.com/miekg/dns"
+)
+
+// An update failure to be reported with a specific response code, instead of SERVFAIL
+type RcodeError struct {
+	Rcode int
+	Err   error
+	// Extended DNS error explaining the response code (RFC 8914), if any
+	ExtendedError *miekgdns.EDNS0_EDE
+}
+
+func NewRcodeError(rcode int, format string, args ...any) *RcodeError {
+	return &RcodeError{Rcode: rcode, Err: fmt.Errorf(format, args...)}
+}
+
+// Updates violating the zone policy are refused, the violation being explained to the client
+func NewPolicyError(format string, args ...any) *RcodeError {
+	err := NewRcodeError(miekgdns.RcodeRefused, format, args...)
+	err.ExtendedError = &miekgdns.EDNS0_EDE{InfoCode: miekgdns.ExtendedErrorCodeProhibited, ExtraText: err.Err.Error()}
+	return err
+}
+
+func (e *RcodeError) Error() string {
+	return fmt.Sprintf("%s: %s", miekgdns.RcodeToString[e.Rcode], e.Err.Error())
+}
+
+func (e *RcodeError) Unwrap() error {
+	return e.Err
+}
+
+// Returns the response code carried by the error chain, if any
+func RcodeOf(err error) (int, bool) {
+	var rcodeErr *RcodeError
+	if errors.As(err, &rcodeErr) {
+		return rcodeErr.Rcode, true
+	}
+	return 0, false
+}
+
+// Returns the extended DNS error carried by the error chain, if any
+func ExtendedErrorOf(err error) *miekgdns.EDNS0_EDE {
+	var rcodeErr *RcodeError
+	if errors.As(err, &rcodeErr) {
+		return rcodeErr.ExtendedError
+	}
+	return nil
+}
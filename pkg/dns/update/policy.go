@@ -0,0 +1,62 @@
+package update
+
+import (
+	miekgdns "github.com/miekg/dns"
+)
+
+// Checks the content of a record added to the zone against the zone policy,
+// bringing its TTL within bounds when the policy clamps TTLs
+func (t *Task) checkPolicy(rr miekgdns.RR) error {
+	policy := t.Authorization.Zone.Policy()
+	header := rr.Header()
+	rrType := miekgdns.TypeToString[header.Rrtype]
+
+	if !policy.AllowsType(header.Rrtype) {
+		t.Logger.Infow("record type not allowed by the zone policy", "name", header.Name, "type", rrType)
+		return NewPolicyError("%s records are not allowed in this zone", rrType)
+	}
+
+	if ttl, ok := policy.BoundTtl(header.Ttl); !ok {
+		if !policy.ClampTtl {
+			t.Logger.Infow("record TTL out of the zone policy bounds", "name", header.Name, "type", rrType,
+				"ttl", header.Ttl, "min", policy.MinTtl, "max", policy.MaxTtl)
+			return NewPolicyError("TTL %d of %s/%s is out of the bounds of this zone", header.Ttl, header.Name, rrType)
+		}
+		t.Logger.Debugw("clamping record TTL to the zone policy bounds", "name", header.Name, "type", rrType,
+			"ttl", header.Ttl, "clamped", ttl)
+		header.Ttl = ttl
+	}
+
+	if !policy.AllowsAddress(rr) {
+		t.Logger.Infow("record address out of the zone policy networks", "name", header.Name, "type", rrType,
+			"record", rr.String())
+		return NewPolicyError("address of %s/%s is not in a network allowed in this zone", header.Name, rrType)
+	}
+	return nil
+}
+
+// Checks the number of records of the name and of the RRset once the record is added
+func (t *Task) checkPolicyLimits(rr miekgdns.RR, zoneSets map[uint16][]miekgdns.RR) error {
+	policy := t.Authorization.Zone.Policy()
+	header := rr.Header()
+	rrType := miekgdns.TypeToString[header.Rrtype]
+
+	if size := len(zoneSets[header.Rrtype]) + 1; policy.MaxRRsetSize > 0 && size > policy.MaxRRsetSize {
+		t.Logger.Infow("RRset would exceed the zone policy size limit", "name", header.Name, "type", rrType,
+			"limit", policy.MaxRRsetSize)
+		return NewPolicyError("RRset %s/%s would exceed %d records", header.Name, rrType, policy.MaxRRsetSize)
+	}
+
+	if policy.MaxRecordsPerName > 0 {
+		count := 1
+		for _, set := range zoneSets {
+			count += len(set)
+		}
+		if count > policy.MaxRecordsPerName {
+			t.Logger.Infow("name would exceed the zone policy records limit", "name", header.Name,
+				"limit", policy.MaxRecordsPerName)
+			return NewPolicyError("%s would exceed %d records", header.Name, policy.MaxRecordsPerName)
+		}
+	}
+	return nil
+}
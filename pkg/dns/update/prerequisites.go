@@ -1,6 +1,8 @@
 package update
 
 import (
+	"fmt"
+
 	"github.com/enix/tsigoat/pkg/adapters/common"
 	miekgdns "github.com/miekg/dns"
 )
@@ -67,7 +69,94 @@ func (p *Prerequisites) AddSetEquality(rrset []miekgdns.RR, failWithRcode int) {
 	})
 }
 
+// Checks every prerequisite in order, failing with the response code of the first unmet one
 func (p *Prerequisites) Evaluate(transaction common.IAdapterTransaction) error {
-	// FIXME not implemented
+	for _, test := range p.tests {
+		if len(test.records) == 0 {
+			continue
+		}
+		name := test.records[0].Header().Name
+		rrType := test.records[0].Header().Rrtype
+
+		switch test.kind {
+		case prereqNameExists, prereqNameAbsent:
+			sets, err := transaction.GetAll(name)
+			if err != nil {
+				return fmt.Errorf("failed to get all RRsets: %w", err)
+			}
+			if exists := len(sets) > 0; exists != (test.kind == prereqNameExists) {
+				return NewRcodeError(test.failRcode, "name %s is in use: %t", name, exists)
+			}
+		case prereqNameWithTypeExists, prereqNameWithTypeAbsent:
+			set, err := transaction.GetSet(name, rrType)
+			if err != nil {
+				return fmt.Errorf("failed to get RRset: %w", err)
+			}
+			if exists := len(set) > 0; exists != (test.kind == prereqNameWithTypeExists) {
+				return NewRcodeError(test.failRcode, "RRset %s/%s exists: %t", name, miekgdns.TypeToString[rrType],
+					exists)
+			}
+		case prereqRRsetsEquality:
+			if err := evaluateSetEquality(transaction, test); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
+
+// RFC 2136 section 3.2.3, the records of each name and type must match the zone RRset exactly
+func evaluateSetEquality(transaction common.IAdapterTransaction, test prereqTest) error {
+	type setKey struct {
+		name   string
+		rrType uint16
+	}
+	var (
+		keys []setKey
+		sets = make(map[setKey][]miekgdns.RR)
+	)
+	for _, rr := range test.records {
+		key := setKey{miekgdns.CanonicalName(rr.Header().Name), rr.Header().Rrtype}
+		if _, found := sets[key]; !found {
+			keys = append(keys, key)
+		}
+		sets[key] = append(sets[key], rr)
+	}
+
+	for _, key := range keys {
+		zoneSet, err := transaction.GetSet(key.name, key.rrType)
+		if err != nil {
+			return fmt.Errorf("failed to get RRset: %w", err)
+		}
+		equal, err := equalSets(sets[key], zoneSet)
+		if err != nil {
+			return err
+		}
+		if !equal {
+			return NewRcodeError(test.failRcode, "RRset %s/%s differs", key.name, miekgdns.TypeToString[key.rrType])
+		}
+	}
+	return nil
+}
+
+// Compares RDATAs only, duplicates being ignored
+func equalSets(set []miekgdns.RR, other []miekgdns.RR) (bool, error) {
+	contains := func(set []miekgdns.RR, rr miekgdns.RR) (bool, error) {
+		for _, item := range set {
+			if equal, err := EqualRdata(rr, item); err != nil || equal {
+				return equal, err
+			}
+		}
+		return false, nil
+	}
+
+	for _, pair := range [][2][]miekgdns.RR{{set, other}, {other, set}} {
+		for _, rr := range pair[0] {
+			found, err := contains(pair[1], rr)
+			if err != nil || !found {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
@@ -1,6 +1,8 @@
 package update
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"github.com/enix/tsigoat/pkg/adapters/common"
@@ -11,12 +13,32 @@ import (
 const ()
 
 type Task struct {
+	Context         context.Context
 	Authorization   *Authorization
 	Prerequisites   *Prerequisites
 	UpdateZoneClass uint16
 	UpdateRRset     *[]miekgdns.RR
 	Logger          *zap.SugaredLogger
-	transaction     common.IAdapterTransaction
+	// Changes are computed against the backend without being applied
+	DryRun bool
+	// Contents of the changed RRsets are recorded, as for dry runs
+	RecordChanges bool
+	transaction   common.IAdapterTransaction
+	rrsets        []RRsetChange
+}
+
+// RRsets changed by a successful update or dry run, when recorded
+func (t *Task) RRsets() []RRsetChange {
+	return t.rrsets
+}
+
+// Records changed by a successful update or dry run, when recorded
+func (t *Task) Changes() []Change {
+	var changes []Change
+	for _, rrset := range t.rrsets {
+		changes = append(changes, rrset.Changes()...)
+	}
+	return changes
 }
 
 func (t *Task) Execute() error {
@@ -25,39 +47,127 @@ func (t *Task) Execute() error {
 	// Validate authorizations
 	t.Logger.Debugw("evaluating authorizations")
 	if err := t.Authorization.Evaluate(); err != nil {
-		return fmt.Errorf("authorization failed: %w", err)
+		return NewRcodeError(miekgdns.RcodeRefused, "authorization failed: %w", err)
 	}
 
 	zone := t.Authorization.Zone
 	adapter := zone.Handler()
 
+	// Let adapters know who is updating the zone
+	if issuer, ok := t.Authorization.Issuer(); ok {
+		t.Context = common.ContextWithIssuer(t.Context, issuer)
+	}
+
 	// Start an adapter transaction
 	t.Logger.Infow("starting a new transaction", "adapter", adapter.Name())
-	t.transaction, err = adapter.NewTransaction(zone.Fqdn(), t.Logger)
+	t.transaction, err = adapter.NewTransaction(t.Context, zone.Fqdn(), t.Logger)
 	if err != nil {
 		return fmt.Errorf("new transaction: %w", err)
 	}
+	if t.DryRun {
+		return t.dryRun(adapter)
+	}
+	var recorder *recordingTransaction
+	if t.RecordChanges {
+		recorder = newRecordingTransaction(t.transaction, false)
+		t.transaction = recorder
+	}
+
+	if err := t.execute(); err != nil {
+		t.Logger.Debugw("rolling back the transaction", "adapter", adapter.Name())
+		if rbErr := t.transaction.Rollback(); rbErr != nil {
+			t.Logger.Errorw("transaction rollback failed, the zone may be partially updated", "adapter", adapter.Name(),
+				"error", rbErr.Error())
+		}
+		return err
+	}
+
+	t.Logger.Debugw("committing the transaction", "adapter", adapter.Name())
+	if err := t.transaction.Commit(); err != nil {
+		return fmt.Errorf("transaction commit: %w", err)
+	}
+	if recorder != nil {
+		t.rrsets = recorder.changes()
+	}
+
+	// FIXME add panic defer ?
+
+	return nil
+}
+
+// Executes the update without committing, the backend being left untouched even on success
+func (t *Task) dryRun(adapter common.IAdapter) error {
+	transaction := newRecordingTransaction(t.transaction, true)
+	t.transaction = transaction
+
+	err := t.execute()
+
+	// Nothing reached the backend, adapters unable to roll back have nothing to undo
+	t.Logger.Debugw("rolling back the dry run transaction", "adapter", adapter.Name())
+	if rbErr := transaction.Rollback(); rbErr != nil && !errors.Is(rbErr, common.ErrRollbackNotSupported) {
+		t.Logger.Errorw("dry run transaction rollback failed", "adapter", adapter.Name(), "error", rbErr.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	t.rrsets = transaction.changes()
+	changes := t.Changes()
+	t.Logger.Infow("dry run of the update succeeded, nothing applied", "adapter", adapter.Name(), "changes", len(changes))
+	for _, change := range changes {
+		t.Logger.Infow("dry run change", "action", change.Action, "record", change.Record.String())
+	}
+	return nil
+}
+
+func (t *Task) execute() error {
+	// Names below a delegation point belong to the child zone
+	if err := t.checkDelegations(); err != nil {
+		return err
+	}
 
 	// Validate all update prerequisites
 	t.Logger.Debugw("validating update prerequisites", "count", t.Prerequisites.Count())
-	t.Logger.Info("!!! NOT IMPLEMENTED !!!") // FIXME
 	if err := t.Prerequisites.Evaluate(t.transaction); err != nil {
 		return fmt.Errorf("prerequisites failed: %w", err)
 	}
 
 	// Proceed with the update
 	t.Logger.Debugw("executing update section", "count", len(*t.UpdateRRset))
-	if err := t.doUpdate(); err != nil {
-		return err
-	}
+	return t.doUpdate()
+}
 
-	if err := t.transaction.Commit(); err != nil {
-		// return fmt.Errorf("transaction failure: %w", err)
-		t.Logger.Info("!!! NOT IMPLEMENTED !!!") // FIXME
-	}
+// Updates at the delegation point itself are allowed, to manage the delegation NS and DS RRsets
+func (t *Task) checkDelegations() error {
+	apex := t.Authorization.Zone.Fqdn()
+	delegated := make(map[string]bool)
 
-	// FIXME add panic defer ?
+	for _, rr := range *t.UpdateRRset {
+		name := miekgdns.CanonicalName(rr.Header().Name)
 
+		// ancestors of the name strictly below the zone apex
+		for _, offset := range miekgdns.Split(name)[1:] {
+			ancestor := name[offset:]
+			if ancestor == apex || !miekgdns.IsSubDomain(apex, ancestor) {
+				break
+			}
+
+			isCut, found := delegated[ancestor]
+			if !found {
+				set, err := t.transaction.GetSet(ancestor, miekgdns.TypeNS)
+				if err != nil {
+					return fmt.Errorf("failed to look for a delegation: %w", err)
+				}
+				isCut = len(set) > 0
+				delegated[ancestor] = isCut
+			}
+			if isCut {
+				t.Logger.Infow("update for a name below a delegation point", "name", rr.Header().Name, "delegation", ancestor)
+				return NewRcodeError(miekgdns.RcodeNotZone, "%s is below the delegation point %s", rr.Header().Name,
+					ancestor)
+			}
+		}
+	}
 	return nil
 }
 
@@ -186,6 +296,11 @@ func (t *Task) doAddToRRset(rr miekgdns.RR) error {
 	rrName := rr.Header().Name
 	rrType := rr.Header().Rrtype
 
+	// Records violating the zone policy fail the whole update, even if they would be ignored
+	if err := t.checkPolicy(rr); err != nil {
+		return err
+	}
+
 	zoneSets, err := t.transaction.GetAll(rrName)
 	if err != nil {
 		t.Logger.Errorw("error getting zone RRsets", "name", rrName, "error", err.Error())
@@ -213,9 +328,16 @@ func (t *Task) doAddToRRset(rr miekgdns.RR) error {
 	zoneSet := zoneSets[rrType]
 
 	if rrType == miekgdns.TypeSOA {
-		// FIXME
-		t.Logger.Info("!!! NOT IMPLEMENTED !!!")
-		return fmt.Errorf("!!! NOT IMPLEMENTED !!!")
+		if len(zoneSet) == 0 {
+			t.Logger.Debugw("ignoring SOA record for a name without SOA", "name", rrName)
+			return nil
+		}
+		serial, zoneSerial := rr.(*miekgdns.SOA).Serial, zoneSet[0].(*miekgdns.SOA).Serial
+		if !serialGreater(serial, zoneSerial) {
+			t.Logger.Debugw("ignoring SOA record with a serial not greater than the zone one", "name", rrName,
+				"serial", serial, "zone_serial", zoneSerial)
+			return nil
+		}
 	}
 
 	for idx, zoneRr := range zoneSet {
@@ -237,7 +359,17 @@ func (t *Task) doAddToRRset(rr miekgdns.RR) error {
 		}
 	}
 
+	if err := t.checkPolicyLimits(rr, zoneSets); err != nil {
+		return err
+	}
+
 	zoneSet = append(zoneSet, rr)
+	if maxSize := t.Authorization.Zone.Handler().Capabilities().MaxRRsetSize; maxSize > 0 && len(zoneSet) > maxSize {
+		t.Logger.Infow("RRset would exceed the handler size limit", "name", rrName, "type", miekgdns.TypeToString[rrType],
+			"limit", maxSize)
+		return NewRcodeError(miekgdns.RcodeRefused, "RRset %s/%s would exceed %d records", rrName,
+			miekgdns.TypeToString[rrType], maxSize)
+	}
 	if len(zoneSet) > 1 {
 		if err := t.transaction.ChangeSet(zoneSet); err != nil {
 			t.Logger.Errorw("error changing zone RRset", "name", rrName, "type", miekgdns.TypeToString[rrType], "error", err.Error())
@@ -281,8 +413,7 @@ func (t *Task) doDeleteRRset(rr miekgdns.RR) error {
 
 	rrName := rr.Header().Name
 	rrType := rr.Header().Rrtype
-	// FIXME not good
-	isZoneName := (rrName == t.Authorization.Zone.Fqdn())
+	isZoneName := miekgdns.CanonicalName(rrName) == t.Authorization.Zone.Fqdn()
 
 	if rrType == miekgdns.TypeANY {
 		sets, err := t.transaction.GetAll(rrName)
@@ -291,7 +422,7 @@ func (t *Task) doDeleteRRset(rr miekgdns.RR) error {
 			return fmt.Errorf("doDeleteRRset: failed to get all sets: %w", err)
 		}
 		for setType := range sets {
-			if setType == miekgdns.TypeSOA || setType == miekgdns.TypeNS {
+			if isZoneName && (setType == miekgdns.TypeSOA || setType == miekgdns.TypeNS) {
 				continue
 			}
 			// TODO refactor
@@ -345,6 +476,10 @@ func (t *Task) doDeleteFromRRset(rr miekgdns.RR) error {
 		t.Logger.Debug("doDeleteFromRRset: skipping SOA record")
 		return nil
 	case *miekgdns.NS:
+		// delegations below the apex may lose all their NS records
+		if miekgdns.CanonicalName(rrName) != t.Authorization.Zone.Fqdn() {
+			break
+		}
 		set, err := t.transaction.GetSet(rrName, miekgdns.TypeNS)
 		if err != nil {
 			t.Logger.Errorw("error getting zone RRset type NS", "name", rrName, "error", err.Error())
@@ -0,0 +1,448 @@
+package update
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/enix/tsigoat/pkg/adapters/common"
+	"github.com/enix/tsigoat/pkg/adapters/memory"
+	"github.com/enix/tsigoat/pkg/dns"
+	miekgdns "github.com/miekg/dns"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var testRecords = []string{
+	"example.test. 3600 IN SOA ns1.example.test. hostmaster.example.test. 10 3600 600 86400 300",
+	"example.test. 3600 IN NS ns1.example.test.",
+	"example.test. 3600 IN NS ns2.example.test.",
+	"example.test. 3600 IN TXT \"apex\"",
+	"www.example.test. 300 IN A 192.0.2.1",
+	"www.example.test. 300 IN A 192.0.2.2",
+	"www.example.test. 300 IN TXT \"www\"",
+	"sub.example.test. 3600 IN NS ns.sub.example.test.",
+}
+
+func newTestZone(t *testing.T) *dns.Zone {
+	t.Helper()
+
+	adapter, err := memory.NewMemoryAdapter("test", &memory.MemoryAdapterConfiguration{Records: testRecords},
+		zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewMemoryAdapter: %v", err)
+	}
+	zone, err := dns.NewZone("example.test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zone.SetHandler(adapter)
+	zone.DisableAuthentication()
+	return zone
+}
+
+func mustRR(t *testing.T, value string) miekgdns.RR {
+	t.Helper()
+
+	rr, err := miekgdns.NewRR(value)
+	if err != nil {
+		t.Fatalf("invalid record %q: %v", value, err)
+	}
+	return rr
+}
+
+// Prerequisite records have no RDATA, their class telling what is checked
+func prereqRR(name string, rrType uint16, class uint16) miekgdns.RR {
+	return &miekgdns.ANY{Hdr: miekgdns.RR_Header{Name: name, Rrtype: rrType, Class: class}}
+}
+
+// Deletions are built like clients do, with the class and RDATA conventions of RFC 2136
+func deleteNameRR(t *testing.T, name string) miekgdns.RR {
+	request := new(miekgdns.Msg)
+	request.RemoveName([]miekgdns.RR{mustRR(t, name+" 0 IN A 192.0.2.1")})
+	return request.Ns[0]
+}
+
+func deleteRRsetRR(t *testing.T, value string) miekgdns.RR {
+	request := new(miekgdns.Msg)
+	request.RemoveRRset([]miekgdns.RR{mustRR(t, value)})
+	return request.Ns[0]
+}
+
+func deleteRR(t *testing.T, value string) miekgdns.RR {
+	request := new(miekgdns.Msg)
+	request.Remove([]miekgdns.RR{mustRR(t, value)})
+	return request.Ns[0]
+}
+
+func runUpdate(t *testing.T, zone *dns.Zone, prerequisites *Prerequisites, updates ...miekgdns.RR) error {
+	t.Helper()
+
+	if prerequisites == nil {
+		prerequisites = &Prerequisites{}
+	}
+	task := Task{
+		Context:         context.Background(),
+		Authorization:   &Authorization{Zone: zone},
+		Prerequisites:   prerequisites,
+		UpdateZoneClass: miekgdns.ClassINET,
+		UpdateRRset:     &updates,
+		Logger:          zap.NewNop().Sugar(),
+	}
+	return task.Execute()
+}
+
+func setOf(t *testing.T, zone *dns.Zone, name string, rrType uint16) []miekgdns.RR {
+	t.Helper()
+
+	tx, err := zone.Handler().NewTransaction(context.Background(), zone.Fqdn(), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	defer tx.Rollback()
+	set, err := tx.GetSet(name, rrType)
+	if err != nil {
+		t.Fatalf("GetSet: %v", err)
+	}
+	return set
+}
+
+func TestSerialGreater(t *testing.T) {
+	tests := []struct {
+		serial  uint32
+		other   uint32
+		greater bool
+	}{
+		{11, 10, true},
+		{10, 11, false},
+		{10, 10, false},
+		// wrapping around
+		{0, 0xffffffff, true},
+		{0xffffffff, 0, false},
+		{0x7fffffff, 0, true},
+		// undefined by RFC 1982, never greater
+		{0x80000000, 0, false},
+		{0, 0x80000000, false},
+	}
+	for _, test := range tests {
+		if greater := serialGreater(test.serial, test.other); greater != test.greater {
+			t.Errorf("serialGreater(%d, %d): got %t, expected %t", test.serial, test.other, greater, test.greater)
+		}
+	}
+}
+
+func TestPrerequisites(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(p *Prerequisites)
+		rcode int
+	}{
+		{"name in use", func(p *Prerequisites) {
+			p.AddNameMustExist(prereqRR("WWW.example.test.", miekgdns.TypeANY, miekgdns.ClassANY),
+				miekgdns.RcodeNameError)
+		}, miekgdns.RcodeSuccess},
+		{"name not in use", func(p *Prerequisites) {
+			p.AddNameMustExist(prereqRR("nope.example.test.", miekgdns.TypeANY, miekgdns.ClassANY),
+				miekgdns.RcodeNameError)
+		}, miekgdns.RcodeNameError},
+		{"name in use when it must not", func(p *Prerequisites) {
+			p.AddNameMustBeAbsent(prereqRR("www.example.test.", miekgdns.TypeANY, miekgdns.ClassNONE),
+				miekgdns.RcodeYXDomain)
+		}, miekgdns.RcodeYXDomain},
+		{"RRset exists", func(p *Prerequisites) {
+			p.AddNameWithTypeMustExist(prereqRR("www.example.test.", miekgdns.TypeA, miekgdns.ClassANY),
+				miekgdns.RcodeNXRrset)
+		}, miekgdns.RcodeSuccess},
+		{"RRset does not exist", func(p *Prerequisites) {
+			p.AddNameWithTypeMustExist(prereqRR("www.example.test.", miekgdns.TypeMX, miekgdns.ClassANY),
+				miekgdns.RcodeNXRrset)
+		}, miekgdns.RcodeNXRrset},
+		{"RRset exists when it must not", func(p *Prerequisites) {
+			p.AddNameWithTypeMustBeAbsent(prereqRR("www.example.test.", miekgdns.TypeA, miekgdns.ClassNONE),
+				miekgdns.RcodeYXRrset)
+		}, miekgdns.RcodeYXRrset},
+		{"RRset equal", func(p *Prerequisites) {
+			p.AddSetEquality([]miekgdns.RR{
+				mustRR(t, "www.example.test. 0 IN A 192.0.2.2"),
+				mustRR(t, "www.example.test. 0 IN A 192.0.2.1"),
+			}, miekgdns.RcodeNXRrset)
+		}, miekgdns.RcodeSuccess},
+		{"RRset different", func(p *Prerequisites) {
+			p.AddSetEquality([]miekgdns.RR{mustRR(t, "www.example.test. 0 IN A 192.0.2.1")}, miekgdns.RcodeNXRrset)
+		}, miekgdns.RcodeNXRrset},
+		{"first unmet wins", func(p *Prerequisites) {
+			p.AddNameMustExist(prereqRR("www.example.test.", miekgdns.TypeANY, miekgdns.ClassANY),
+				miekgdns.RcodeNameError)
+			p.AddNameWithTypeMustBeAbsent(prereqRR("www.example.test.", miekgdns.TypeTXT, miekgdns.ClassNONE),
+				miekgdns.RcodeYXRrset)
+			p.AddNameMustExist(prereqRR("nope.example.test.", miekgdns.TypeANY, miekgdns.ClassANY),
+				miekgdns.RcodeNameError)
+		}, miekgdns.RcodeYXRrset},
+	}
+	for _, test := range tests {
+		zone := newTestZone(t)
+		prerequisites := &Prerequisites{}
+		test.build(prerequisites)
+
+		err := runUpdate(t, zone, prerequisites, mustRR(t, "new.example.test. 300 IN A 192.0.2.3"))
+		rcode := miekgdns.RcodeSuccess
+		if err != nil {
+			var found bool
+			if rcode, found = RcodeOf(err); !found {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+				continue
+			}
+		}
+		if rcode != test.rcode {
+			t.Errorf("%s: got %s, expected %s", test.name, miekgdns.RcodeToString[rcode],
+				miekgdns.RcodeToString[test.rcode])
+		}
+
+		// the update is applied only when every prerequisite is met
+		applied := len(setOf(t, zone, "new.example.test.", miekgdns.TypeA)) > 0
+		if applied != (test.rcode == miekgdns.RcodeSuccess) {
+			t.Errorf("%s: update applied: %t", test.name, applied)
+		}
+	}
+}
+
+func TestAddSoa(t *testing.T) {
+	tests := []struct {
+		record string
+		serial uint32
+	}{
+		{"example.test. 3600 IN SOA ns1.example.test. hostmaster.example.test. 11 3600 600 86400 300", 11},
+		{"EXAMPLE.test. 3600 IN SOA ns1.example.test. hostmaster.example.test. 12 3600 600 86400 300", 12},
+		{"example.test. 3600 IN SOA ns1.example.test. hostmaster.example.test. 10 3600 600 86400 300", 10},
+		{"example.test. 3600 IN SOA ns1.example.test. hostmaster.example.test. 9 3600 600 86400 300", 10},
+		// a name without SOA doesn't get one
+		{"www.example.test. 3600 IN SOA ns1.example.test. hostmaster.example.test. 11 3600 600 86400 300", 10},
+	}
+	for _, test := range tests {
+		zone := newTestZone(t)
+		if err := runUpdate(t, zone, nil, mustRR(t, test.record)); err != nil {
+			t.Errorf("%s: %v", test.record, err)
+			continue
+		}
+		set := setOf(t, zone, "example.test.", miekgdns.TypeSOA)
+		if len(set) != 1 || set[0].(*miekgdns.SOA).Serial != test.serial {
+			t.Errorf("%s: got %v, expected serial %d", test.record, set, test.serial)
+		}
+		if set := setOf(t, zone, "www.example.test.", miekgdns.TypeSOA); len(set) != 0 {
+			t.Errorf("%s: SOA added below the apex", test.record)
+		}
+	}
+}
+
+func TestDeleteName(t *testing.T) {
+	zone := newTestZone(t)
+	err := runUpdate(t, zone, nil, deleteNameRR(t, "EXAMPLE.Test."), deleteNameRR(t, "www.example.test."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the apex keeps its SOA and NS records only
+	tests := []struct {
+		name   string
+		rrType uint16
+		count  int
+	}{
+		{"example.test.", miekgdns.TypeSOA, 1},
+		{"example.test.", miekgdns.TypeNS, 2},
+		{"example.test.", miekgdns.TypeTXT, 0},
+		{"www.example.test.", miekgdns.TypeA, 0},
+		{"www.example.test.", miekgdns.TypeTXT, 0},
+	}
+	for _, test := range tests {
+		if count := len(setOf(t, zone, test.name, test.rrType)); count != test.count {
+			t.Errorf("%s/%s: got %d records, expected %d", test.name, miekgdns.TypeToString[test.rrType], count,
+				test.count)
+		}
+	}
+}
+
+func TestDeleteRRset(t *testing.T) {
+	tests := []struct {
+		record string
+		rrType uint16
+		count  int
+	}{
+		{"Example.Test. 0 IN SOA ns1.example.test. hostmaster.example.test. 0 0 0 0 0", miekgdns.TypeSOA, 1},
+		{"Example.Test. 0 IN NS ns1.example.test.", miekgdns.TypeNS, 2},
+		{"example.test. 0 IN TXT \"\"", miekgdns.TypeTXT, 0},
+		// delegations are not protected
+		{"sub.example.test. 0 IN NS ns.sub.example.test.", miekgdns.TypeNS, 0},
+	}
+	for _, test := range tests {
+		zone := newTestZone(t)
+		rr := deleteRRsetRR(t, test.record)
+		if err := runUpdate(t, zone, nil, rr); err != nil {
+			t.Errorf("%s: %v", test.record, err)
+			continue
+		}
+		name := miekgdns.CanonicalName(rr.Header().Name)
+		if count := len(setOf(t, zone, name, test.rrType)); count != test.count {
+			t.Errorf("%s: got %d records left, expected %d", test.record, count, test.count)
+		}
+	}
+}
+
+func TestDeleteLastNS(t *testing.T) {
+	zone := newTestZone(t)
+
+	// the last NS record of the apex is kept
+	err := runUpdate(t, zone, nil,
+		deleteRR(t, "example.test. 0 IN NS ns1.example.test."),
+		deleteRR(t, "EXAMPLE.test. 0 IN NS ns2.example.test."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set := setOf(t, zone, "example.test.", miekgdns.TypeNS); len(set) != 1 {
+		t.Errorf("expected the last apex NS record to be kept, got %v", set)
+	}
+
+	// the one of a delegation is not
+	if err := runUpdate(t, zone, nil, deleteRR(t, "sub.example.test. 0 IN NS ns.sub.example.test.")); err != nil {
+		t.Fatal(err)
+	}
+	if set := setOf(t, zone, "sub.example.test.", miekgdns.TypeNS); len(set) != 0 {
+		t.Errorf("expected the delegation NS record to be deleted, got %v", set)
+	}
+
+	// SOA records are never deleted one by one
+	soa := "example.test. 0 IN SOA ns1.example.test. hostmaster.example.test. 10 3600 600 86400 300"
+	if err := runUpdate(t, zone, nil, deleteRR(t, soa)); err != nil {
+		t.Fatal(err)
+	}
+	if set := setOf(t, zone, "example.test.", miekgdns.TypeSOA); len(set) != 1 {
+		t.Errorf("expected the SOA record to be kept, got %v", set)
+	}
+}
+
+// Adapters applying changes right away, like PowerDNS, cannot roll back
+type noRollbackAdapter struct {
+	common.IAdapter
+}
+
+func (a *noRollbackAdapter) NewTransaction(ctx context.Context, zone string, logger *zap.SugaredLogger) (common.IAdapterTransaction, error) {
+	transaction, err := a.IAdapter.NewTransaction(ctx, zone, logger)
+	return &noRollbackTransaction{transaction}, err
+}
+
+type noRollbackTransaction struct {
+	common.IAdapterTransaction
+}
+
+func (t *noRollbackTransaction) Rollback() error {
+	t.IAdapterTransaction.Rollback()
+	return common.ErrRollbackNotSupported
+}
+
+func TestDryRunWithoutRollback(t *testing.T) {
+	zone := newTestZone(t)
+	zone.SetHandler(&noRollbackAdapter{zone.Handler()})
+	core, logs := observer.New(zapcore.WarnLevel)
+
+	updates := []miekgdns.RR{mustRR(t, "new.example.test. 300 IN A 192.0.2.3")}
+	task := Task{
+		Context:         context.Background(),
+		Authorization:   &Authorization{Zone: zone},
+		Prerequisites:   &Prerequisites{},
+		UpdateZoneClass: miekgdns.ClassINET,
+		UpdateRRset:     &updates,
+		Logger:          zap.New(core).Sugar(),
+		DryRun:          true,
+	}
+	if err := task.Execute(); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if len(task.Changes()) != 1 {
+		t.Errorf("expected a single change, got %v", task.Changes())
+	}
+	if set := setOf(t, zone, "new.example.test.", miekgdns.TypeA); len(set) != 0 {
+		t.Errorf("dry run applied to the zone: %v", set)
+	}
+	for _, entry := range logs.All() {
+		t.Errorf("unexpected log entry: %s", entry.Message)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	networks := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name    string
+		policy  dns.Policy
+		record  string
+		allowed bool
+		// TTL of the added record when allowed
+		ttl uint32
+	}{
+		{"allowed type", dns.Policy{Types: []uint16{miekgdns.TypeA}},
+			"new.example.test. 300 IN A 192.0.2.3", true, 300},
+		{"disallowed type", dns.Policy{Types: []uint16{miekgdns.TypeA}},
+			"new.example.test. 300 IN TXT \"text\"", false, 0},
+		{"TTL too low", dns.Policy{MinTtl: 300, MaxTtl: 3600},
+			"new.example.test. 60 IN A 192.0.2.3", false, 0},
+		{"TTL too high", dns.Policy{MinTtl: 300, MaxTtl: 3600},
+			"new.example.test. 86400 IN A 192.0.2.3", false, 0},
+		{"TTL within bounds", dns.Policy{MinTtl: 300, MaxTtl: 3600},
+			"new.example.test. 600 IN A 192.0.2.3", true, 600},
+		{"TTL clamped up", dns.Policy{MinTtl: 300, MaxTtl: 3600, ClampTtl: true},
+			"new.example.test. 60 IN A 192.0.2.3", true, 300},
+		{"TTL clamped down", dns.Policy{MinTtl: 300, MaxTtl: 3600, ClampTtl: true},
+			"new.example.test. 86400 IN A 192.0.2.3", true, 3600},
+		{"A in networks", dns.Policy{Networks: networks},
+			"new.example.test. 300 IN A 10.1.2.3", true, 300},
+		{"A out of networks", dns.Policy{Networks: networks},
+			"new.example.test. 300 IN A 192.0.2.3", false, 0},
+		{"AAAA out of networks", dns.Policy{Networks: networks},
+			"new.example.test. 300 IN AAAA 2001:db8::1", false, 0},
+		{"IPv4-mapped AAAA in networks", dns.Policy{Networks: networks},
+			"new.example.test. 300 IN AAAA ::ffff:10.1.2.3", true, 300},
+		{"IPv4-mapped AAAA out of networks", dns.Policy{Networks: networks},
+			"new.example.test. 300 IN AAAA ::ffff:192.0.2.3", false, 0},
+		{"other types regardless of networks", dns.Policy{Networks: networks},
+			"new.example.test. 300 IN TXT \"text\"", true, 300},
+		// www.example.test holds 2 A records and a TXT one
+		{"RRset size exceeded", dns.Policy{MaxRRsetSize: 2},
+			"www.example.test. 300 IN A 192.0.2.3", false, 0},
+		{"RRset size with an identical record", dns.Policy{MaxRRsetSize: 2},
+			"www.example.test. 600 IN A 192.0.2.1", true, 600},
+		{"records per name exceeded", dns.Policy{MaxRecordsPerName: 3},
+			"www.example.test. 300 IN AAAA 2001:db8::1", false, 0},
+		{"records per name with an identical record", dns.Policy{MaxRecordsPerName: 3},
+			"www.example.test. 600 IN TXT \"www\"", true, 600},
+	}
+	for _, test := range tests {
+		zone := newTestZone(t)
+		zone.SetPolicy(test.policy)
+		rr := mustRR(t, test.record)
+		before := len(setOf(t, zone, rr.Header().Name, rr.Header().Rrtype))
+
+		err := runUpdate(t, zone, nil, rr)
+		set := setOf(t, zone, rr.Header().Name, rr.Header().Rrtype)
+		if test.allowed {
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+				continue
+			}
+			idx := slices.IndexFunc(set, func(zoneRr miekgdns.RR) bool { return zoneRr.Header().Ttl == test.ttl })
+			if idx < 0 {
+				t.Errorf("%s: no record with TTL %d in %v", test.name, test.ttl, set)
+			}
+			continue
+		}
+
+		var rcodeErr *RcodeError
+		if !errors.As(err, &rcodeErr) || rcodeErr.Rcode != miekgdns.RcodeRefused || rcodeErr.ExtendedError == nil ||
+			rcodeErr.ExtendedError.InfoCode != miekgdns.ExtendedErrorCodeProhibited {
+			t.Errorf("%s: expected REFUSED with the Prohibited extended error, got %v", test.name, err)
+		}
+		if len(set) != before {
+			t.Errorf("%s: refused record applied: %v", test.name, set)
+		}
+	}
+}
@@ -41,3 +41,8 @@ func EqualRdata(rr1 miekgdns.RR, rr2 miekgdns.RR) (bool, error) {
 	// fmt.Printf("\nrd1 > %s\nrd2 > %s\n=== > %t\n", rr1Ukn.Rdata, rr2Ukn.Rdata, rr1Ukn.Rdata == rr2Ukn.Rdata)
 	return rr1Ukn.Rdata == rr2Ukn.Rdata, nil
 }
+
+// Serial number arithmetic of RFC 1982, true when serial is greater than other
+func serialGreater(serial uint32, other uint32) bool {
+	return serial != other && serial-other < 1<<31
+}
@@ -2,16 +2,24 @@ package dns
 
 import (
 	"fmt"
+	"slices"
+	"sync"
 
 	"github.com/enix/tsigoat/pkg/adapters/common"
+	"github.com/enix/tsigoat/pkg/dns/identity"
 	miekgdns "github.com/miekg/dns"
 )
 
 type Zone struct {
-	fqdn      string
-	handler   common.IAdapter
-	validKeys []string
-	unsecure  bool
+	fqdn     string
+	handler  common.IAdapter
+	unsecure bool
+	policy   Policy
+	dryRun   bool
+
+	// rules may be changed at runtime through the admin API
+	rulesLock sync.RWMutex
+	rules     []identity.Matcher
 }
 
 func NewZone(name string) (*Zone, error) {
@@ -39,17 +47,75 @@ func (z *Zone) SetHandler(adapter common.IAdapter) {
 	z.handler = adapter
 }
 
+func (z *Zone) Policy() *Policy {
+	return &z.policy
+}
+
+func (z *Zone) SetPolicy(policy Policy) {
+	z.policy = policy
+}
+
+// Updates to the zone are evaluated but never applied
+func (z *Zone) DryRun() bool {
+	return z.dryRun
+}
+
+func (z *Zone) SetDryRun(dryRun bool) {
+	z.dryRun = dryRun
+}
+
 func (z *Zone) AddValidKey(name string) {
-	z.validKeys = append(z.validKeys, name)
+	z.AddRule(identity.NewTsigMatcher(name))
+}
+
+// Returns false when the key was not valid for the zone
+func (z *Zone) RemoveValidKey(name string) bool {
+	z.rulesLock.Lock()
+	defer z.rulesLock.Unlock()
+
+	key := identity.NewTsigMatcher(name).String()
+	count := len(z.rules)
+	z.rules = slices.DeleteFunc(z.rules, func(rule identity.Matcher) bool {
+		return rule.String() == key
+	})
+	return len(z.rules) != count
 }
 
-func (z *Zone) KeyIsAuthorized(name string) bool {
-	for _, k := range z.validKeys {
-		if k == name {
-			return true
-		}
+func (z *Zone) HasValidKey(name string) bool {
+	key := identity.NewTsigMatcher(name).String()
+	return slices.ContainsFunc(z.Rules(), func(rule identity.Matcher) bool {
+		return rule.String() == key
+	})
+}
+
+func (z *Zone) AddRule(rule identity.Matcher) {
+	z.rulesLock.Lock()
+	defer z.rulesLock.Unlock()
+
+	z.rules = append(z.rules, rule)
+}
+
+func (z *Zone) Rules() []identity.Matcher {
+	z.rulesLock.RLock()
+	defer z.rulesLock.RUnlock()
+
+	return slices.Clone(z.rules)
+}
+
+func (z *Zone) Authorizes(id identity.Identity) bool {
+	return slices.ContainsFunc(z.Rules(), func(rule identity.Matcher) bool {
+		return rule.Match(id)
+	})
+}
+
+// Unsigned updates may be authorized by the source address, or not require authentication at all
+func (z *Zone) AllowsUnsigned() bool {
+	if z.unsecure {
+		return true
 	}
-	return false
+	return slices.ContainsFunc(z.Rules(), func(rule identity.Matcher) bool {
+		return rule.Kind() == identity.KindAddress
+	})
 }
 
 func (a *Zone) AlgorithmIsPermitted(algorithm string) bool {
@@ -58,8 +124,11 @@ func (a *Zone) AlgorithmIsPermitted(algorithm string) bool {
 }
 
 func (z *Zone) DisableAuthentication() {
+	z.rulesLock.Lock()
+	defer z.rulesLock.Unlock()
+
 	z.unsecure = true
-	z.validKeys = nil
+	z.rules = nil
 }
 
 func (z *Zone) HasAuthenticationDisabled() bool {
@@ -1,7 +1,6 @@
 package logging
 
 import (
-	"fmt"
 	"io"
 	"log/slog"
 
@@ -23,7 +22,13 @@ func NewLogger(format Format, level zapcore.Level, stdout io.Writer, stderr io.W
 		encoderConfig = zap.NewDevelopmentEncoderConfig()
 		encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 	case SimpleFormat:
-		fmt.Println("!!! NOT IMPLEMENTED !!!")
+		// CLI commands print their output on stdout, messages are kept short
+		encoderConfig = zapcore.EncoderConfig{
+			LevelKey:       "level",
+			MessageKey:     "msg",
+			EncodeLevel:    zapcore.LowercaseLevelEncoder,
+			EncodeDuration: zapcore.StringDurationEncoder,
+		}
 	default:
 		encoderConfig = zap.NewProductionEncoderConfig()
 	}
@@ -39,6 +44,8 @@ func NewLogger(format Format, level zapcore.Level, stdout io.Writer, stderr io.W
 	switch format {
 	case DeveloperFormat:
 		config.Development = true
+	case SimpleFormat:
+		config.OutputPaths = []string{"stderr"}
 	case JSONFormat:
 		config.Encoding = "json"
 	}
@@ -0,0 +1,175 @@
+package selftest
+
+import (
+	"fmt"
+
+	"github.com/enix/tsigoat/pkg/client"
+	miekgdns "github.com/miekg/dns"
+)
+
+const (
+	categoryPrerequisites = "prerequisites"
+	categoryCname         = "cname"
+	categoryApex          = "apex"
+	categoryTsig          = "tsig"
+	categoryAtomicity     = "atomicity"
+)
+
+// Cases run in order, later ones relying on the records added by earlier ones
+var cases = []testCase{
+	{categoryPrerequisites, "name not in use on an unused name", func(s *suite) error {
+		return s.expect(miekgdns.RcodeSuccess, "prereq nxdomain "+s.name(""))
+	}},
+	{categoryPrerequisites, "name in use on an unused name is NXDOMAIN", func(s *suite) error {
+		return s.expect(miekgdns.RcodeNameError, "prereq yxdomain "+s.name(""))
+	}},
+	{categoryPrerequisites, "signed update adding a record", func(s *suite) error {
+		return s.add("", "300 A 192.0.2.1")
+	}},
+	{categoryPrerequisites, "name in use on a used name", func(s *suite) error {
+		return s.expect(miekgdns.RcodeSuccess, "prereq yxdomain "+s.name(""))
+	}},
+	{categoryPrerequisites, "name not in use on a used name is YXDOMAIN", func(s *suite) error {
+		return s.expect(miekgdns.RcodeYXDomain, "prereq nxdomain "+s.name(""))
+	}},
+	{categoryPrerequisites, "RRset exists", func(s *suite) error {
+		return s.expect(miekgdns.RcodeSuccess, "prereq yxrrset "+s.name("")+" A")
+	}},
+	{categoryPrerequisites, "RRset does not exist on an existing RRset is YXRRSET", func(s *suite) error {
+		return s.expect(miekgdns.RcodeYXRrset, "prereq nxrrset "+s.name("")+" A")
+	}},
+	{categoryPrerequisites, "RRset exists on a missing RRset is NXRRSET", func(s *suite) error {
+		return s.expect(miekgdns.RcodeNXRrset, "prereq yxrrset "+s.name("")+" TXT")
+	}},
+	{categoryPrerequisites, "RRset exists with matching data", func(s *suite) error {
+		return s.expect(miekgdns.RcodeSuccess, "prereq yxrrset "+s.name("")+" A 192.0.2.1")
+	}},
+	{categoryPrerequisites, "RRset exists with other data is NXRRSET", func(s *suite) error {
+		return s.expect(miekgdns.RcodeNXRrset, "prereq yxrrset "+s.name("")+" A 192.0.2.2")
+	}},
+	{categoryPrerequisites, "prerequisite outside of the zone is NOTZONE", func(s *suite) error {
+		return s.expect(miekgdns.RcodeNotZone, "prereq yxdomain "+outOfZone)
+	}},
+
+	{categoryCname, "CNAME is ignored on a name with other records", func(s *suite) error {
+		return steps(
+			func() error { return s.add("cname-a", "300 A 192.0.2.1") },
+			func() error { return s.add("cname-a", "300 CNAME target.example.net.") },
+			func() error { return s.holds("nxrrset " + s.name("cname-a") + " CNAME") },
+		)
+	}},
+	{categoryCname, "other records are ignored on a CNAME", func(s *suite) error {
+		return steps(
+			func() error { return s.add("cname-b", "300 CNAME target.example.net.") },
+			func() error { return s.add("cname-b", "300 TXT selftest") },
+			func() error { return s.holds("nxrrset " + s.name("cname-b") + " TXT") },
+		)
+	}},
+	{categoryCname, "CNAME replaces the existing CNAME", func(s *suite) error {
+		return steps(
+			func() error { return s.add("cname-b", "300 CNAME other.example.net.") },
+			func() error { return s.holds("yxrrset " + s.name("cname-b") + " CNAME other.example.net.") },
+			func() error {
+				return s.expect(miekgdns.RcodeNXRrset,
+					"prereq yxrrset "+s.name("cname-b")+" CNAME target.example.net.")
+			},
+		)
+	}},
+
+	{categoryApex, "apex SOA cannot be deleted", func(s *suite) error {
+		return steps(
+			func() error { return s.expect(miekgdns.RcodeSuccess, "delete "+s.target.Zone+" SOA") },
+			func() error { return s.holds("yxrrset " + s.target.Zone + " SOA") },
+		)
+	}},
+	{categoryApex, "apex NS RRset cannot be deleted", func(s *suite) error {
+		if err := s.holds("yxrrset " + s.target.Zone + " NS"); err != nil {
+			return skip("the zone has no apex NS RRset")
+		}
+		return steps(
+			func() error { return s.expect(miekgdns.RcodeSuccess, "delete "+s.target.Zone+" NS") },
+			func() error { return s.holds("yxrrset " + s.target.Zone + " NS") },
+		)
+	}},
+	{categoryApex, "SOA with a name other than the apex is ignored", func(s *suite) error {
+		return steps(
+			func() error {
+				return s.add("soa", "300 SOA ns.example.net. hostmaster.example.net. 1 3600 600 86400 300")
+			},
+			func() error { return s.holds("nxrrset " + s.name("soa") + " SOA") },
+		)
+	}},
+	{categoryApex, "record outside of the zone is NOTZONE", func(s *suite) error {
+		return s.expect(miekgdns.RcodeNotZone, "add "+outOfZone+" 300 A 192.0.2.1")
+	}},
+
+	{categoryTsig, "response is signed with the request key", func(s *suite) error {
+		if s.target.Key == nil {
+			return skip("no key given, the zone is not secured by TSIG")
+		}
+		result, err := s.sendWith(s.target.Key, "prereq yxdomain "+s.name(""))
+		if err != nil {
+			return err
+		}
+		if result.Tsig != client.TsigVerified {
+			return &failure{message: fmt.Sprintf("expected a verified response signature, got %s", result.Tsig)}
+		}
+		return nil
+	}},
+	{categoryTsig, "unsigned update is rejected", func(s *suite) error {
+		if s.target.Key == nil {
+			return skip("no key given, the zone is not secured by TSIG")
+		}
+		return s.rejected(nil, "tsig-unsigned")
+	}},
+	{categoryTsig, "update signed with a wrong secret is rejected (BADSIG)", func(s *suite) error {
+		key, err := s.alteredKey()
+		if err != nil {
+			return err
+		}
+		key.Secret = "dHNpZ29hdCBzZWxmdGVzdCB3cm9uZyBzZWNyZXQ="
+		return s.rejected(key, "tsig-badsig")
+	}},
+	{categoryTsig, "update signed with an unknown key is rejected (BADKEY)", func(s *suite) error {
+		key, err := s.alteredKey()
+		if err != nil {
+			return err
+		}
+		key.Name = "tsigoat-selftest-unknown-key."
+		return s.rejected(key, "tsig-badkey")
+	}},
+	{categoryTsig, "update signed outside of the time window is rejected (BADTIME)", func(s *suite) error {
+		return s.staleSignature()
+	}},
+
+	{categoryAtomicity, "update failing a prerequisite is not applied", func(s *suite) error {
+		return steps(
+			func() error {
+				return s.expect(miekgdns.RcodeYXDomain, "prereq nxdomain "+s.name(""),
+					"add "+s.name("")+" 300 TXT selftest")
+			},
+			func() error { return s.holds("nxrrset " + s.name("") + " TXT") },
+		)
+	}},
+	{categoryAtomicity, "update with a record outside of the zone is not applied", func(s *suite) error {
+		s.track(s.name("partial-a"))
+		return steps(
+			func() error {
+				return s.expect(miekgdns.RcodeNotZone, "add "+s.name("partial-a")+" 300 A 192.0.2.1",
+					"add "+outOfZone+" 300 A 192.0.2.1")
+			},
+			func() error { return s.holds("nxdomain " + s.name("partial-a")) },
+		)
+	}},
+	{categoryAtomicity, "update with a record below a delegation is rolled back", func(s *suite) error {
+		s.track(s.name("partial-b"))
+		return steps(
+			func() error { return s.add("delegated", "300 NS ns.example.net.") },
+			func() error {
+				return s.expect(miekgdns.RcodeNotZone, "add "+s.name("partial-b")+" 300 A 192.0.2.1",
+					"add "+s.name("host.delegated")+" 300 A 192.0.2.1")
+			},
+			func() error { return s.holds("nxdomain " + s.name("partial-b")) },
+		)
+	}},
+}
@@ -0,0 +1,238 @@
+package selftest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/client"
+	miekgdns "github.com/miekg/dns"
+)
+
+const (
+	Passed  = "pass"
+	Failed  = "fail"
+	Skipped = "skip"
+)
+
+// Names outside of any zone, expected to be answered with NOTZONE
+const outOfZone = "tsigoat-selftest.invalid."
+
+// Server and zone under test. Records are only created below a random label of the zone,
+// except for the apex checks which try to delete the apex SOA and NS RRsets.
+type Target struct {
+	Server  string
+	Zone    string
+	Key     *client.Key
+	Options client.SendOptions
+}
+
+type Outcome struct {
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+type Report struct {
+	Zone string `json:"zone"`
+	// Name below which records were created
+	Base     string    `json:"base"`
+	Outcomes []Outcome `json:"outcomes"`
+}
+
+func (r *Report) Count(status string) int {
+	count := 0
+	for _, outcome := range r.Outcomes {
+		if outcome.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *Report) Passed() bool {
+	return r.Count(Failed) == 0
+}
+
+// A step that did not get the expected answer, or a reason to skip the case
+type failure struct {
+	skip    bool
+	message string
+}
+
+func (f *failure) Error() string {
+	return f.message
+}
+
+func skip(format string, args ...any) error {
+	return &failure{true, fmt.Sprintf(format, args...)}
+}
+
+type testCase struct {
+	category string
+	name     string
+	run      func(*suite) error
+}
+
+type suite struct {
+	target Target
+	base   string
+	// names to clean up once done
+	names []string
+}
+
+// Runs the conformance suite and removes the records it created
+func Run(target Target) *Report {
+	target.Zone = miekgdns.Fqdn(miekgdns.CanonicalName(target.Zone))
+
+	label := make([]byte, 4)
+	rand.Read(label)
+	s := &suite{target: target, base: fmt.Sprintf("tsigoat-selftest-%s.%s", hex.EncodeToString(label), target.Zone)}
+	report := &Report{Zone: target.Zone, Base: s.base}
+
+	for _, test := range cases {
+		outcome := Outcome{Category: test.category, Name: test.name, Status: Passed}
+		if err := test.run(s); err != nil {
+			outcome.Status, outcome.Detail = Failed, err.Error()
+			if failure, ok := err.(*failure); ok && failure.skip {
+				outcome.Status = Skipped
+			}
+		}
+		report.Outcomes = append(report.Outcomes, outcome)
+	}
+
+	s.cleanup()
+	return report
+}
+
+// Names relative to the base name, the base name itself when empty
+func (s *suite) name(relative string) string {
+	if relative == "" {
+		return s.base
+	}
+	return relative + "." + s.base
+}
+
+// Sends the script lines as a single update, signed with the given key
+func (s *suite) sendWith(key *client.Key, lines ...string) (*client.Result, error) {
+	script := client.NewScript(client.Request{Server: s.target.Server, Zone: s.target.Zone, Key: key})
+	for _, line := range lines {
+		if err := script.Line(line); err != nil {
+			return nil, fmt.Errorf("selftest script '%s': %w", line, err)
+		}
+	}
+	requests := script.Requests()
+	if len(requests) != 1 {
+		return nil, fmt.Errorf("selftest script makes %d updates", len(requests))
+	}
+	return client.Send(requests[0], s.target.Options), nil
+}
+
+// Sends an update and checks the response code is one of the expected ones
+func (s *suite) expectWith(key *client.Key, rcodes []int, lines ...string) error {
+	result, err := s.sendWith(key, lines...)
+	if err != nil {
+		return err
+	}
+	if result.Error != "" {
+		return &failure{message: fmt.Sprintf("%s: %s", strings.Join(lines, "; "), result.Error)}
+	}
+
+	expected := make([]string, 0, len(rcodes))
+	for _, rcode := range rcodes {
+		expected = append(expected, miekgdns.RcodeToString[rcode])
+	}
+	if !slices.Contains(expected, result.Rcode) {
+		return &failure{message: fmt.Sprintf("%s: expected %s, got %s", strings.Join(lines, "; "),
+			strings.Join(expected, " or "), result.Rcode)}
+	}
+	return nil
+}
+
+func (s *suite) expect(rcode int, lines ...string) error {
+	return s.expectWith(s.target.Key, []int{rcode}, lines...)
+}
+
+// Zone contents are checked with prerequisite only updates, as the server may not answer queries
+func (s *suite) holds(prerequisite string) error {
+	return s.expect(miekgdns.RcodeSuccess, "prereq "+prerequisite)
+}
+
+func (s *suite) add(relative string, record string) error {
+	s.track(s.name(relative))
+	return s.expect(miekgdns.RcodeSuccess, fmt.Sprintf("add %s %s", s.name(relative), record))
+}
+
+func (s *suite) track(name string) {
+	if !slices.Contains(s.names, name) {
+		s.names = append(s.names, name)
+	}
+}
+
+// Best effort, as a broken server may refuse the deletions as well
+func (s *suite) cleanup() {
+	for _, name := range slices.Backward(s.names) {
+		s.sendWith(s.target.Key, "delete "+name)
+	}
+}
+
+// Runs the steps in order, stopping at the first failure
+func steps(steps ...func() error) error {
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A key differing from the target key by its name, secret or signing time
+func (s *suite) alteredKey() (*client.Key, error) {
+	if s.target.Key == nil {
+		return nil, skip("no key given, the zone is not secured by TSIG")
+	}
+	key := *s.target.Key
+	return &key, nil
+}
+
+// Rejected signatures are answered with NOTAUTH (RFC 8945) or REFUSED, the zone being unchanged
+func (s *suite) rejected(key *client.Key, relative string) error {
+	rejections := []int{miekgdns.RcodeNotAuth, miekgdns.RcodeRefused}
+	return steps(
+		func() error {
+			return s.expectWith(key, rejections, fmt.Sprintf("add %s 300 A 192.0.2.1", s.name(relative)))
+		},
+		func() error { return s.holds("nxdomain " + s.name(relative)) },
+	)
+}
+
+func (s *suite) staleSignature() error {
+	if s.target.Key == nil {
+		return skip("no key given, the zone is not secured by TSIG")
+	}
+	key := s.target.Key
+
+	script := client.NewScript(client.Request{Server: s.target.Server, Zone: s.target.Zone})
+	script.Line(fmt.Sprintf("add %s 300 A 192.0.2.1", s.name("tsig-time")))
+	msg, err := script.Requests()[0].Message()
+	if err != nil {
+		return err
+	}
+	// twice the fudge of 300 seconds
+	msg.SetTsig(miekgdns.Fqdn(miekgdns.CanonicalName(key.Name)), miekgdns.Fqdn(miekgdns.CanonicalName(key.Algorithm)),
+		300, time.Now().Add(-10*time.Minute).Unix())
+
+	result := client.SendMessage(msg, s.target.Server, key, s.target.Options)
+	if result.Error != "" {
+		return &failure{message: result.Error}
+	}
+	if result.Rcode != miekgdns.RcodeToString[miekgdns.RcodeNotAuth] &&
+		result.Rcode != miekgdns.RcodeToString[miekgdns.RcodeRefused] {
+		return &failure{message: fmt.Sprintf("stale signature: expected NOTAUTH or REFUSED, got %s", result.Rcode)}
+	}
+	return s.holds("nxdomain " + s.name("tsig-time"))
+}
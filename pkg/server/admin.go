@@ -0,0 +1,392 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/dns"
+	"github.com/enix/tsigoat/pkg/dns/identity"
+	"github.com/enix/tsigoat/pkg/dns/tsig"
+	miekgdns "github.com/miekg/dns"
+)
+
+const (
+	adminKeySourceConfig = "config"
+	adminKeySourceApi    = "api"
+)
+
+type adminKey struct {
+	Name     string   `json:"name"`
+	Source   string   `json:"source"`
+	Default  bool     `json:"default"`
+	Disabled bool     `json:"disabled"`
+	Zones    []string `json:"zones"`
+}
+
+type adminNewKey struct {
+	Name      string   `json:"name"`
+	Algorithm string   `json:"algorithm"`
+	Zones     []string `json:"zones"`
+}
+
+// Only returned once, when the key is created
+type adminCreatedKey struct {
+	Name      string   `json:"name"`
+	Algorithm string   `json:"algorithm"`
+	Secret    string   `json:"secret"`
+	Zones     []string `json:"zones"`
+}
+
+type adminZone struct {
+	Zone     string   `json:"zone"`
+	Handler  string   `json:"handler"`
+	Unsecure bool     `json:"unsecure"`
+	Keys     []string `json:"keys"`
+	Rules    []string `json:"rules"`
+}
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) initAdmin(config *AdminConfiguration) (err error) {
+	if config.Address == "" {
+		return nil
+	}
+
+	s.history = newUpdateHistory(config.History)
+
+	if s.state, err = loadAdminState(config.StateFile); err != nil {
+		return
+	}
+	for _, key := range s.state.Keys {
+		if err = s.keyring.AddEncodedKey(key.Name, key.Secret); err != nil {
+			return fmt.Errorf("failed to add key '%s' from state file: %w", key.Name, err)
+		}
+	}
+	for _, name := range s.state.Disabled {
+		if err = s.keyring.SetDisabled(name, true); err != nil {
+			Logger.Warnw("ignoring unknown key disabled in state file", "keyname", name)
+		}
+	}
+	Logger.Debugw("loaded admin state", "file", config.StateFile, "keys", len(s.state.Keys),
+		"disabled", len(s.state.Disabled), "zones", len(s.state.Zones))
+	return nil
+}
+
+func (s *Server) newAdminServer(config *AdminConfiguration) (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/keys", s.adminListKeys)
+	mux.HandleFunc("POST /api/v1/keys", s.adminCreateKey)
+	mux.HandleFunc("POST /api/v1/keys/{key}/disable", s.adminDisableKey)
+	mux.HandleFunc("POST /api/v1/keys/{key}/enable", s.adminEnableKey)
+	mux.HandleFunc("GET /api/v1/zones", s.adminListZones)
+	mux.HandleFunc("PUT /api/v1/zones/{zone}/keys/{key}", s.adminAttachKey)
+	mux.HandleFunc("DELETE /api/v1/zones/{zone}/keys/{key}", s.adminDetachKey)
+	mux.HandleFunc("GET /api/v1/updates", s.adminListUpdates)
+
+	server := &http.Server{
+		Addr:              config.Address,
+		Handler:           s.adminAuthenticate(config.Tokens, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	if config.Tls != nil {
+		reloader, err := newTlsReloader(config.Tls)
+		if err != nil {
+			return nil, err
+		}
+		server.TLSConfig = reloader.tlsConfig("http/1.1")
+	}
+	return server, nil
+}
+
+func (s *Server) serveAdmin(server *http.Server) {
+	var err error
+
+	Logger.Infow("starting admin API", "address", server.Addr, "tls", server.TLSConfig != nil)
+	if server.TLSConfig == nil {
+		Logger.Warnw("admin API tokens are sent in clear text, as allowed by the allowPlainHttp setting")
+	}
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil {
+		Logger.Fatalw("failed to start admin API", "address", server.Addr, "error", err)
+	}
+}
+
+func (s *Server) adminAuthenticate(tokens []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || !slices.ContainsFunc(tokens, func(valid string) bool {
+			return subtle.ConstantTimeCompare([]byte(token), []byte(valid)) == 1
+		}) {
+			Logger.Infow("unauthenticated admin API request", "remote", r.RemoteAddr, "method", r.Method,
+				"path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			adminReply(w, http.StatusUnauthorized, adminError{"invalid or missing token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func adminReply(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		Logger.Debugw("failed to write admin API response", "error", err.Error())
+	}
+}
+
+func adminFail(w http.ResponseWriter, status int, format string, args ...any) {
+	adminReply(w, status, adminError{fmt.Sprintf(format, args...)})
+}
+
+func (s *Server) listZones() []*dns.Zone {
+	s.zonesLock.RLock()
+	defer s.zonesLock.RUnlock()
+
+	return slices.Clone(s.zones)
+}
+
+func (s *Server) adminListKeys(w http.ResponseWriter, r *http.Request) {
+	zones := s.listZones()
+
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	keys := make([]adminKey, 0)
+	for _, name := range s.keyring.Names() {
+		key := adminKey{
+			Name:     name,
+			Source:   adminKeySourceConfig,
+			Default:  name == s.defaultKeyName,
+			Disabled: s.keyring.IsDisabled(name),
+			Zones:    make([]string, 0),
+		}
+		if slices.ContainsFunc(s.state.Keys, func(created stateKey) bool { return created.Name == name }) {
+			key.Source = adminKeySourceApi
+		}
+		for _, zone := range zones {
+			if zone.HasValidKey(name) {
+				key.Zones = append(key.Zones, zone.Fqdn())
+			}
+		}
+		keys = append(keys, key)
+	}
+	adminReply(w, http.StatusOK, keys)
+}
+
+// The secret is generated here, sized after the HMAC algorithm digest
+func (s *Server) adminCreateKey(w http.ResponseWriter, r *http.Request) {
+	var request adminNewKey
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		adminFail(w, http.StatusBadRequest, "invalid request: %s", err)
+		return
+	}
+
+	// named like keys are on the wire
+	request.Name = miekgdns.Fqdn(miekgdns.CanonicalName(request.Name))
+	if _, ok := miekgdns.IsDomainName(request.Name); !ok || request.Name == "." {
+		adminFail(w, http.StatusBadRequest, "invalid key name '%s'", request.Name)
+		return
+	}
+	if request.Algorithm == "" {
+		request.Algorithm = miekgdns.HmacSHA256
+	}
+	request.Algorithm = miekgdns.Fqdn(miekgdns.CanonicalName(request.Algorithm))
+	secret, err := tsig.GenerateKey(request.Algorithm, 0)
+	if err != nil {
+		adminFail(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+
+	zones := make([]*dns.Zone, 0, len(request.Zones))
+	for _, name := range request.Zones {
+		zone, status, err := s.adminSecuredZone(name)
+		if err != nil {
+			adminFail(w, status, "%s", err)
+			return
+		}
+		zones = append(zones, zone)
+	}
+
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	if err := s.keyring.AddKey(request.Name, secret); err != nil {
+		adminFail(w, http.StatusConflict, "%s", err)
+		return
+	}
+	created := stateKey{
+		Name:      request.Name,
+		Algorithm: request.Algorithm,
+		Secret:    secret.ToBase64(),
+		Created:   time.Now().UTC(),
+	}
+	s.state.Keys = append(s.state.Keys, created)
+
+	response := adminCreatedKey{Name: created.Name, Algorithm: created.Algorithm, Secret: created.Secret,
+		Zones: make([]string, 0)}
+	for _, zone := range zones {
+		s.state.attach(zone.Fqdn(), created.Name)
+		if !zone.HasValidKey(created.Name) {
+			zone.AddValidKey(created.Name)
+		}
+		response.Zones = append(response.Zones, zone.Fqdn())
+	}
+
+	Logger.Infow("created key through the admin API", "keyname", created.Name, "algorithm", created.Algorithm,
+		"zones", response.Zones, "remote", r.RemoteAddr)
+	if !s.saveState(w) {
+		return
+	}
+	adminReply(w, http.StatusCreated, response)
+}
+
+func (s *Server) adminDisableKey(w http.ResponseWriter, r *http.Request) {
+	s.adminSetKeyDisabled(w, r, true)
+}
+
+func (s *Server) adminEnableKey(w http.ResponseWriter, r *http.Request) {
+	s.adminSetKeyDisabled(w, r, false)
+}
+
+// Disabled keys stay in the keyring and attached to zones, but signatures made with them are rejected
+func (s *Server) adminSetKeyDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	name := adminKeyName(r)
+
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	if err := s.keyring.SetDisabled(name, disabled); err != nil {
+		adminFail(w, http.StatusNotFound, "%s", err)
+		return
+	}
+	s.state.Disabled = slices.DeleteFunc(s.state.Disabled, func(value string) bool { return value == name })
+	if disabled {
+		s.state.Disabled = append(s.state.Disabled, name)
+	}
+
+	Logger.Infow("changed key status through the admin API", "keyname", name, "disabled", disabled,
+		"remote", r.RemoteAddr)
+	if !s.saveState(w) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminListZones(w http.ResponseWriter, r *http.Request) {
+	zones := make([]adminZone, 0)
+	for _, zone := range s.listZones() {
+		info := adminZone{
+			Zone:     zone.Fqdn(),
+			Handler:  zone.Handler().Name(),
+			Unsecure: zone.HasAuthenticationDisabled(),
+			Keys:     make([]string, 0),
+			Rules:    make([]string, 0),
+		}
+		for _, rule := range zone.Rules() {
+			info.Rules = append(info.Rules, rule.String())
+			if rule.Kind() == identity.KindTsig {
+				info.Keys = append(info.Keys, strings.TrimPrefix(rule.String(), string(identity.KindTsig)+":"))
+			}
+		}
+		zones = append(zones, info)
+	}
+	adminReply(w, http.StatusOK, zones)
+}
+
+func (s *Server) adminAttachKey(w http.ResponseWriter, r *http.Request) {
+	zone, status, err := s.adminSecuredZone(r.PathValue("zone"))
+	if err != nil {
+		adminFail(w, status, "%s", err)
+		return
+	}
+	key := adminKeyName(r)
+	if !s.keyring.HasKey(key) {
+		adminFail(w, http.StatusNotFound, "unknown key '%s'", key)
+		return
+	}
+
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	s.state.attach(zone.Fqdn(), key)
+	if !zone.HasValidKey(key) {
+		zone.AddValidKey(key)
+	}
+
+	Logger.Infow("attached key to zone through the admin API", "name", zone.Fqdn(), "keyname", key,
+		"remote", r.RemoteAddr)
+	if !s.saveState(w) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminDetachKey(w http.ResponseWriter, r *http.Request) {
+	zone, status, err := s.adminSecuredZone(r.PathValue("zone"))
+	if err != nil {
+		adminFail(w, status, "%s", err)
+		return
+	}
+	key := adminKeyName(r)
+
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	if !zone.RemoveValidKey(key) {
+		adminFail(w, http.StatusNotFound, "key '%s' is not attached to zone '%s'", key, zone.Fqdn())
+		return
+	}
+	s.state.detach(zone.Fqdn(), key)
+
+	Logger.Infow("detached key from zone through the admin API", "name", zone.Fqdn(), "keyname", key,
+		"remote", r.RemoteAddr)
+	if !s.saveState(w) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminListUpdates(w http.ResponseWriter, r *http.Request) {
+	adminReply(w, http.StatusOK, s.history.list())
+}
+
+// Key names in paths are taken like the ones of created keys, which are named like keys are on the wire
+func adminKeyName(r *http.Request) string {
+	return miekgdns.Fqdn(miekgdns.CanonicalName(r.PathValue("key")))
+}
+
+// Keys cannot be attached to zones with authentication disabled
+func (s *Server) adminSecuredZone(name string) (*dns.Zone, int, error) {
+	zone, found := s.lookupZone(miekgdns.Fqdn(miekgdns.CanonicalName(name)))
+	if !found {
+		return nil, http.StatusNotFound, fmt.Errorf("unknown zone '%s'", name)
+	}
+	if zone.HasAuthenticationDisabled() {
+		return nil, http.StatusConflict, errors.New("zone has authentication disabled")
+	}
+	return zone, 0, nil
+}
+
+// Must be called with the state lock held. Runtime changes are kept when saving fails.
+func (s *Server) saveState(w http.ResponseWriter) bool {
+	if err := s.state.save(s.Configuration.Admin.StateFile); err != nil {
+		Logger.Errorw("failed to save admin state", "file", s.Configuration.Admin.StateFile, "error", err.Error())
+		adminFail(w, http.StatusInternalServerError, "change applied but not saved: %s", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testAdminToken = "admin-token"
+
+func adminConfiguration(admin string) string {
+	return `tsig:
+  keys:
+    - {name: main., key: ` + testMainSecret + `}
+handlers:
+  - name: mem
+    default: true
+    adapter: memory
+    memory:
+      records:
+        - "example.test. 3600 IN SOA ns1.example.test. hostmaster.example.test. 1 3600 600 86400 300"
+zones:
+  - {zone: example.test, keys: [main.]}
+admin:
+  address: "127.0.0.1:8080"
+  tokens: [` + testAdminToken + `]
+` + admin
+}
+
+func TestAdminPlainHttp(t *testing.T) {
+	tests := []struct {
+		admin string
+		valid bool
+	}{
+		{"", false},
+		{"  allowPlainHttp: false\n", false},
+		{"  allowPlainHttp: true\n", true},
+		// TLS files are still checked
+		{"  tls: {certFile: /nonexistent/tls.crt, keyFile: /nonexistent/tls.key}\n", false},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "tsigoat.yaml")
+		if err := os.WriteFile(path, []byte(adminConfiguration(test.admin)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		file := NewConfigurationFile(YamlConfiguration)
+		file.FullPath = path
+		_, _, err := LoadConfiguration(file, Logger)
+		if (err == nil) != test.valid {
+			t.Errorf("%q: got error %v, expected valid %t", test.admin, err, test.valid)
+		}
+	}
+}
+
+func adminRequest(t *testing.T, handler http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+testAdminToken)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// Key names in paths don't have to be written like on the wire
+func TestAdminKeyNames(t *testing.T) {
+	_, s := startTestServer(t, adminConfiguration("  allowPlainHttp: true\n"))
+	server, err := s.newAdminServer(&s.Configuration.Admin)
+	if err != nil {
+		t.Fatalf("newAdminServer: %v", err)
+	}
+	zone, _ := s.lookupZone("example.test.")
+
+	response := adminRequest(t, server.Handler, http.MethodPost, "/api/v1/keys", `{"name": "Ops.Example"}`)
+	if response.Code != http.StatusCreated || !strings.Contains(response.Body.String(), `"name":"ops.example."`) {
+		t.Fatalf("key creation: got %d %s", response.Code, response.Body)
+	}
+
+	steps := []struct {
+		method string
+		path   string
+		check  func() bool
+	}{
+		{http.MethodPut, "/api/v1/zones/example.test/keys/OPS.EXAMPLE", func() bool { return zone.HasValidKey("ops.example.") }},
+		{http.MethodPost, "/api/v1/keys/Ops.Example/disable", func() bool { return s.keyring.IsDisabled("ops.example.") }},
+		{http.MethodPost, "/api/v1/keys/ops.example./enable", func() bool { return !s.keyring.IsDisabled("ops.example.") }},
+		{http.MethodDelete, "/api/v1/zones/example.test/keys/OPS.example", func() bool { return !zone.HasValidKey("ops.example.") }},
+	}
+	for _, step := range steps {
+		response := adminRequest(t, server.Handler, step.method, step.path, "")
+		if response.Code != http.StatusNoContent {
+			t.Errorf("%s %s: got %d %s", step.method, step.path, response.Code, response.Body)
+		} else if !step.check() {
+			t.Errorf("%s %s: change not applied", step.method, step.path)
+		}
+	}
+}
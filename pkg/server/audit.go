@@ -0,0 +1,87 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/audit"
+	"github.com/enix/tsigoat/pkg/dns/update"
+	miekgdns "github.com/miekg/dns"
+)
+
+func (s *Server) initAudit(config *AuditConfiguration) error {
+	for idx, sinkConfig := range config.Sinks {
+		sink, err := newAuditSink(&sinkConfig)
+		if err != nil {
+			return fmt.Errorf("audit sink %d: %w", idx, err)
+		}
+		Logger.Infow("recording updates to an audit sink", "sink", sink.String())
+		s.auditSinks = append(s.auditSinks, sink)
+	}
+	return nil
+}
+
+func newAuditSink(config *AuditSinkConfiguration) (audit.Sink, error) {
+	switch config.Type {
+	case AuditFile:
+		return audit.NewFileSink(config.Path)
+	case AuditSyslog:
+		return audit.NewSyslogSink(config.Network, config.Address, config.Tag)
+	case AuditWebhook:
+		return audit.NewWebhookSink(config.Url, config.Headers, config.Timeout, Logger), nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink type '%s'", config.Type)
+	}
+}
+
+func (s *Server) closeAudit() {
+	for _, sink := range s.auditSinks {
+		if err := sink.Close(); err != nil {
+			Logger.Errorw("failed to close audit sink", "sink", sink.String(), "error", err.Error())
+		}
+	}
+}
+
+// Records an update, the task being nil when the update was rejected before it started
+func (s *Server) auditUpdate(writer miekgdns.ResponseWriter, received *miekgdns.Msg, task *update.Task, rcode int,
+	reason string) {
+	if len(s.auditSinks) == 0 {
+		return
+	}
+
+	record := &audit.Record{
+		Time:          time.Now().UTC(),
+		Event:         audit.EventRejected,
+		Client:        writer.RemoteAddr().String(),
+		Rcode:         miekgdns.RcodeToString[rcode],
+		Reason:        reason,
+		Prerequisites: audit.Strings(received.Answer),
+		Updates:       audit.Strings(received.Ns),
+	}
+	if len(received.Question) > 0 {
+		record.Zone = received.Question[0].Name
+	}
+	if tsig := received.IsTsig(); tsig != nil {
+		record.Key = tsig.Hdr.Name
+	}
+	if task != nil {
+		record.Zone = task.Authorization.Zone.Fqdn()
+		record.Identity, _ = task.Authorization.Issuer()
+		for _, rrset := range task.RRsets() {
+			record.RRsets = append(record.RRsets, audit.NewRRset(rrset))
+		}
+		if rcode == miekgdns.RcodeSuccess {
+			record.Event = audit.EventApplied
+			if task.DryRun {
+				record.Event = audit.EventDryRun
+			}
+		}
+	}
+
+	for _, sink := range s.auditSinks {
+		if err := sink.Write(record); err != nil {
+			Logger.Errorw("failed to write audit record", "sink", sink.String(), "zone", record.Zone,
+				"client", record.Client, "error", err.Error())
+		}
+	}
+}
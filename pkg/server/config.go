@@ -3,12 +3,16 @@ package server
 import (
 	"fmt"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/enix/tsigoat/internal/product"
 	"github.com/enix/tsigoat/pkg/adapters"
 	"github.com/enix/tsigoat/pkg/adapters/common"
+	"github.com/enix/tsigoat/pkg/dns/identity"
 	"github.com/enix/tsigoat/pkg/types"
 	"github.com/go-playground/validator/v10"
+	miekgdns "github.com/miekg/dns"
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
@@ -20,6 +24,9 @@ func init() {
 	validate.RegisterValidation("uniquedefault", validateUniqueDefault)
 	validate.RegisterValidation("adapterslug", validateAdapterSlug)
 	validate.RegisterValidation("zoneconfig", validateZoneConfiguration)
+	validate.RegisterValidation("identityrule", validateIdentityRule)
+	validate.RegisterValidation("rrtype", validateRRType)
+	validate.RegisterValidation("admintls", validateAdminTls, true)
 }
 
 const (
@@ -43,19 +50,74 @@ type ConfigurationFile struct {
 }
 
 type Configuration struct {
-	Tsig     TsigConfiguration
-	Handlers []HandlerConfiguration `validate:"gt=0,unique=Name,uniquedefault,dive"`
-	Zones    []ZoneConfiguration    `validate:"gt=0,unique=Zone,dive,zoneconfig"`
+	// Files, globs or directories relative to this file, adding zones, keys, handlers and discovery rules
+	Include   []string `validate:"dive,required"`
+	Server    ServerConfiguration
+	Tsig      TsigConfiguration
+	Sig0      Sig0Configuration
+	Handlers  []HandlerConfiguration `validate:"gt=0,unique=Name,uniquedefault,dive"`
+	Zones     []ZoneConfiguration    `validate:"unique=Zone,dive,zoneconfig"`
+	Discovery DiscoveryConfiguration
+	Admin     AdminConfiguration
+	Audit     AuditConfiguration
+}
+
+type ServerConfiguration struct {
+	UpdateTimeout time.Duration `validate:"gte=0"`
+	// Refuse updates to unknown zones like unsigned updates to secured zones, instead of answering NOTAUTH
+	HideZones bool
+	// Updates are evaluated and logged but never applied to any zone
+	DryRun bool
+	// UDP and TCP on port 5353 when empty
+	Listeners []ListenerConfiguration `validate:"dive"`
+}
+
+const (
+	ListenerUdp = "udp"
+	ListenerTcp = "tcp"
+	ListenerTls = "tls"
+)
+
+type ListenerConfiguration struct {
+	Net     string                    `validate:"required,oneof=udp tcp tls"`
+	Address string                    `validate:"required,hostname_port"`
+	Tls     *TlsListenerConfiguration `validate:"required_if=Net tls,excluded_unless=Net tls"`
+}
+
+// DNS over TLS (RFC 7858), files are reloaded within seconds when they change
+type TlsListenerConfiguration struct {
+	CertFile     string `validate:"required,file"`
+	KeyFile      string `validate:"required,file"`
+	ClientCaFile string `validate:"omitempty,file"`
+	// Refuse connections without a client certificate signed by the client CA
+	RequireClientCert bool `validate:"excluded_without=ClientCaFile"`
 }
 
 type TsigConfiguration struct {
 	Keys []TsigKeyConfiguration `validate:"unique=Name,uniquedefault,dive"`
+	Tkey TkeyConfiguration
+}
+
+// Session key negotiation (RFC 2930), enabled when bootstrap keys are given.
+// Session keys are granted the zone authorizations of the key they were negotiated with.
+type TkeyConfiguration struct {
+	// Static keys allowed to sign negotiation requests
+	BootstrapKeys []string `validate:"omitempty,unique,dive,required"`
+	// Upper bound of session key lifetimes, 1 hour when zero
+	MaxLifetime time.Duration `validate:"gte=0"`
+	// Upper bound of live session keys, 1024 when zero
+	MaxKeys int `validate:"gte=0"`
+}
+
+// Public keys as KEY records in presentation format, the owner name being the key name
+type Sig0Configuration struct {
+	Keys []string `validate:"dive,required"`
 }
 
 type TsigKeyConfiguration struct {
 	Default bool
 	Name    string `validate:"required,printascii"` // FIXME check RFC (format and length)
-	Key     string `validate:"required,base64"`
+	Key     string `validate:"required,base64" sensitive:"true"`
 }
 
 type EmbeddedHandlerConfiguration struct {
@@ -70,10 +132,109 @@ type HandlerConfiguration struct {
 }
 
 type ZoneConfiguration struct {
-	Zone     string   `validate:"required,fqdn"`
-	Handler  string   `validate:"omitempty,printascii"`
-	Keys     []string `validate:"omitempty,dive,printascii"` // FIXME check RFC (format and length)
+	Zone    string   `validate:"required,fqdn"`
+	Handler string   `validate:"omitempty,printascii"`
+	Keys    []string `validate:"omitempty,dive,printascii"` // FIXME check RFC (format and length)
+	// Client certificate names allowed to update the zone over TLS, as an alternative to keys
+	Certificates []string `validate:"omitempty,dive,required"`
+	// Identity rules, such as "cert:*.k8s.internal@Internal CA", "sig0:host.example.com." or "ip:192.0.2.0/24"
+	Allow    []string `validate:"omitempty,dive,identityrule"`
 	Unsecure bool
+	Requires ZoneRequirements
+	Policy   ZonePolicyConfiguration
+	// Updates are evaluated and logged but never applied to the zone
+	DryRun bool
+}
+
+// Constraints on the records added by updates, violations being refused with an extended DNS error
+type ZonePolicyConfiguration struct {
+	// TTL bounds in seconds, none when zero
+	MinTtl uint32
+	MaxTtl uint32 `validate:"omitempty,gtefield=MinTtl"`
+	// Out of bounds TTLs are brought within bounds instead of refusing the update
+	ClampTtl bool
+	// Types allowed to be added, such as "A" or "TXT", any when empty
+	Types []string `validate:"dive,rrtype"`
+	// Limits on the size of an RRset and on the number of records of a name, none when zero
+	MaxRRsetSize      int `validate:"gte=0"`
+	MaxRecordsPerName int `validate:"gte=0"`
+	// Networks the addresses of A and AAAA records must belong to, such as "10.0.0.0/8"
+	Networks []string `validate:"dive,cidr"`
+}
+
+// REST API changing keys and zones at runtime, disabled without address
+type AdminConfiguration struct {
+	Address string `validate:"omitempty,hostname_port"`
+	// Bearer tokens granting access to the API
+	Tokens []string                  `validate:"required_with=Address,dive,required" sensitive:"true"`
+	Tls    *TlsListenerConfiguration `validate:"admintls"`
+	// Serve the API over plain HTTP without TLS, sending tokens in clear text
+	AllowPlainHttp bool
+	// Runtime changes are saved there and applied again at startup, they are lost on restart otherwise
+	StateFile string
+	// Number of recent updates kept for inspection, 100 when zero
+	History int `validate:"gte=0"`
+}
+
+const (
+	AuditFile    = "file"
+	AuditSyslog  = "syslog"
+	AuditWebhook = "webhook"
+)
+
+// Every update received is recorded to each sink, with the RRsets changed by applied updates
+type AuditConfiguration struct {
+	Sinks []AuditSinkConfiguration `validate:"dive"`
+}
+
+type AuditSinkConfiguration struct {
+	Type string `validate:"required,oneof=file syslog webhook"`
+	// JSON lines file records are appended to
+	Path string `validate:"required_if=Type file,excluded_unless=Type file"`
+	// Remote syslog server, the local daemon when empty, over UDP unless the network is set
+	Network string `validate:"omitempty,excluded_unless=Type syslog,oneof=udp tcp"`
+	Address string `validate:"omitempty,excluded_unless=Type syslog,hostname_port"`
+	// Syslog tag, the product slug when empty
+	Tag string `validate:"omitempty,excluded_unless=Type syslog"`
+	// Records are posted one by one as JSON, with the headers such as an Authorization one
+	Url     string            `validate:"required_if=Type webhook,excluded_unless=Type webhook"`
+	Headers map[string]string `validate:"excluded_unless=Type webhook" sensitive:"true"`
+	// Deadline of a webhook delivery, 10 seconds when zero
+	Timeout time.Duration `validate:"gte=0"`
+}
+
+const (
+	VerifyZonesOff  = "off"
+	VerifyZonesWarn = "warn"
+	VerifyZonesFail = "fail"
+)
+
+type DiscoveryConfiguration struct {
+	// Check configured zones exist in their backend
+	Verify string `validate:"omitempty,oneof=off warn fail"`
+	// Zones are listed again at this interval, at startup only when zero
+	Interval time.Duration                `validate:"gte=0"`
+	Rules    []DiscoveryRuleConfiguration `validate:"dive"`
+}
+
+// Backend zones matching a rule are served as if listed in the configuration.
+// Key names are templates, see DiscoveredZone for the available fields.
+type DiscoveryRuleConfiguration struct {
+	Handler  string   `validate:"omitempty,printascii"`
+	Glob     string   `validate:"required_without=Regex,excluded_with=Regex"`
+	Regex    string   `validate:"required_without=Glob,excluded_with=Glob"`
+	Keys     []string `validate:"omitempty,dive,required"`
+	Unsecure bool     `validate:"excluded_with=Keys"`
+	Policy   ZonePolicyConfiguration
+	DryRun   bool
+}
+
+// Checked against the capabilities of the zone handler at startup
+type ZoneRequirements struct {
+	Types         []string `validate:"dive,required"`
+	Transactional bool
+	Comments      bool
+	Dnssec        bool
 }
 
 func NewConfigurationFile(defaultFormat ConfigFormat) *ConfigurationFile {
@@ -97,15 +258,16 @@ func (c *Configuration) Unmarshal(viper *viper.Viper) error {
 	err = viper.Unmarshal(c, func(decoderConfig *mapstructure.DecoderConfig) {
 		decoderConfig.ErrorUnused = true
 		decoderConfig.DecodeHook = mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
 			decodeHandlerConfiguration(),
 		)
 	})
 	if err != nil {
-		return fmt.Errorf("parsing error: %w", err)
+		return fmt.Errorf("parsing error: %w", &ProblemsError{decodeProblems(err)})
 	}
 
-	if err = validate.Struct(c); err != nil {
-		return fmt.Errorf("validation error: %w", err)
+	if problems := c.Check(); len(problems) > 0 {
+		return fmt.Errorf("validation error: %w", &ProblemsError{problems})
 	}
 
 	return nil
@@ -147,6 +309,7 @@ func decodeHandlerConfiguration() mapstructure.DecodeHookFunc {
 			Result:      abstractAdapterConfig,
 			ErrorUnused: true,
 			ErrorUnset:  false,
+			DecodeHook:  mapstructure.StringToTimeDurationHookFunc(),
 		})
 		if err = adapterConfigDecoder.Decode(adapterData); err != nil {
 			return data, fmt.Errorf("failed to decode handler adapter configuration")
@@ -192,71 +355,26 @@ func validateAdapterSlug(fl validator.FieldLevel) bool {
 	return adapters.IsSlug(fl.Field().Interface().(common.AdapterSlug))
 }
 
+func validateIdentityRule(fl validator.FieldLevel) bool {
+	_, err := identity.ParseMatcher(fl.Field().String())
+	return err == nil
+}
+
+func validateRRType(fl validator.FieldLevel) bool {
+	_, found := miekgdns.StringToType[strings.ToUpper(fl.Field().String())]
+	return found
+}
+
+// Tokens are only sent in clear text when explicitly allowed
+func validateAdminTls(fl validator.FieldLevel) bool {
+	admin := fl.Parent().Interface().(AdminConfiguration)
+	return admin.Address == "" || admin.Tls != nil || admin.AllowPlainHttp
+}
+
 func validateZoneConfiguration(fl validator.FieldLevel) bool {
 	top := fl.Top().Interface().(*Configuration)
 	val := fl.Field().Interface().(ZoneConfiguration)
 
-	// validate the handler
-	if val.Handler != "" {
-		found := false
-		for _, handler := range top.Handlers {
-			if val.Handler == handler.Name {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return false
-		}
-	} else {
-		// check the default handler exists
-		hasDefault := false
-		for _, handler := range top.Handlers {
-			if handler.Default {
-				hasDefault = true
-				break
-			}
-		}
-		if !hasDefault {
-			return false
-		}
-	}
-
-	if val.Unsecure {
-		// want no key when auth disabled
-		// enforced to make it more difficult to craft unsafe config by accident
-		if len(val.Keys) > 0 {
-			return false
-		}
-	} else {
-		if len(val.Keys) > 0 {
-			// check all key references resolve
-			for _, key := range val.Keys {
-				found := false
-				for _, tkey := range top.Tsig.Keys {
-					if key == tkey.Name {
-						found = true
-						break
-					}
-				}
-				if !found {
-					return false
-				}
-			}
-		} else {
-			// check the default key exists
-			hasDefault := false
-			for _, key := range top.Tsig.Keys {
-				if key.Default {
-					hasDefault = true
-					break
-				}
-			}
-			if !hasDefault {
-				return false
-			}
-		}
-	}
-
-	return true
+	// explained by Configuration.Check
+	return len(zoneProblems(top, &val)) == 0
 }
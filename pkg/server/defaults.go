@@ -0,0 +1,52 @@
+package server
+
+import (
+	"github.com/enix/tsigoat/internal/product"
+	"github.com/enix/tsigoat/pkg/adapters/common"
+	"github.com/enix/tsigoat/pkg/audit"
+)
+
+// Fills unset settings with the values the server runs with, at startup and before dumps
+func (c *Configuration) setDefaults() {
+	if c.Server.UpdateTimeout == 0 {
+		c.Server.UpdateTimeout = defaultUpdateTimeout
+	}
+
+	if c.Tsig.Tkey.MaxLifetime == 0 {
+		c.Tsig.Tkey.MaxLifetime = defaultTkeyLifetime
+	}
+	if c.Tsig.Tkey.MaxKeys == 0 {
+		c.Tsig.Tkey.MaxKeys = defaultTkeyMaxKeys
+	}
+
+	if c.Discovery.Verify == "" {
+		c.Discovery.Verify = VerifyZonesWarn
+	}
+
+	if c.Admin.Address != "" && c.Admin.History == 0 {
+		c.Admin.History = defaultHistorySize
+	}
+
+	for idx := range c.Audit.Sinks {
+		sink := &c.Audit.Sinks[idx]
+		switch sink.Type {
+		case AuditSyslog:
+			if sink.Network == "" && sink.Address != "" {
+				sink.Network = "udp"
+			}
+			if sink.Tag == "" {
+				sink.Tag = product.Slug
+			}
+		case AuditWebhook:
+			if sink.Timeout == 0 {
+				sink.Timeout = audit.DefaultWebhookTimeout
+			}
+		}
+	}
+
+	for _, handler := range c.Handlers {
+		if settings, ok := handler.Settings.(common.IAdapterDefaults); ok {
+			settings.SetDefaults()
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/adapters/common"
+	"github.com/enix/tsigoat/pkg/dns"
+	miekgdns "github.com/miekg/dns"
+)
+
+// Fields available to the key name templates of discovery rules, e.g. "{{ .Label }}-update"
+type DiscoveredZone struct {
+	// Fully qualified zone name, with the trailing dot
+	Zone string
+	// Zone name without the trailing dot
+	Name string
+	// Leftmost label of the zone name
+	Label string
+}
+
+type discoveryRule struct {
+	config  *DiscoveryRuleConfiguration
+	adapter common.IAdapter
+	match   func(string) bool
+	keys    []*template.Template
+	policy  dns.Policy
+}
+
+func (s *Server) initDiscovery() error {
+	config := &s.Configuration.Discovery
+
+	for idx := range config.Rules {
+		rule, err := s.newDiscoveryRule(&config.Rules[idx])
+		if err != nil {
+			return fmt.Errorf("discovery rule #%d: %w", idx+1, err)
+		}
+		s.discoveryRules = append(s.discoveryRules, rule)
+	}
+
+	if config.Verify == VerifyZonesOff && len(s.discoveryRules) == 0 {
+		return nil
+	}
+
+	Logger.Debugw("listing zones from backends", "verify", config.Verify, "rules", len(s.discoveryRules))
+	return s.discover(true)
+}
+
+func (s *Server) newDiscoveryRule(config *DiscoveryRuleConfiguration) (*discoveryRule, error) {
+	rule := &discoveryRule{config: config}
+
+	if config.Handler != "" {
+		adapter, found := s.adaptersByName[config.Handler]
+		if !found {
+			return nil, fmt.Errorf("unknown handler '%s'", config.Handler)
+		}
+		rule.adapter = adapter
+	} else if s.defaultAdapter != nil {
+		rule.adapter = s.defaultAdapter
+	} else {
+		return nil, fmt.Errorf("no handler set and server has no default handler")
+	}
+	if _, ok := rule.adapter.(common.IZoneLister); !ok {
+		return nil, fmt.Errorf("handler '%s' cannot list zones", rule.adapter.Name())
+	}
+
+	policy, err := zonePolicy(&config.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	rule.policy = policy
+
+	if config.Glob != "" {
+		pattern := miekgdns.Fqdn(miekgdns.CanonicalName(config.Glob))
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob '%s': %w", config.Glob, err)
+		}
+		rule.match = func(zone string) bool {
+			matched, _ := path.Match(pattern, zone)
+			return matched
+		}
+	} else {
+		regex, err := regexp.Compile(config.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex '%s': %w", config.Regex, err)
+		}
+		rule.match = regex.MatchString
+	}
+
+	for _, key := range config.Keys {
+		tmpl, err := template.New(key).Option("missingkey=error").Parse(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key template '%s': %w", key, err)
+		}
+		rule.keys = append(rule.keys, tmpl)
+	}
+	return rule, nil
+}
+
+func (s *Server) discoveryLoop(interval time.Duration) {
+	Logger.Infow("zones will be listed from backends periodically", "interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.discover(false); err != nil {
+			Logger.Errorw("zone discovery failed", "error", err.Error())
+		}
+	}
+}
+
+// Verifies configured zones exist in their backend, and registers or removes discovered zones.
+// Only runs at startup or from the discovery loop, which is the sole writer of the discovered zone set.
+func (s *Server) discover(startup bool) error {
+	listings := make(map[common.IAdapter]map[string]bool)
+	list := func(adapter common.IAdapter) (map[string]bool, bool) {
+		if zones, done := listings[adapter]; done {
+			return zones, zones != nil
+		}
+		listings[adapter] = nil
+
+		lister, ok := adapter.(common.IZoneLister)
+		if !ok {
+			Logger.Debugw("handler cannot list zones", "handler", adapter.Name())
+			return nil, false
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.updateTimeout)
+		defer cancel()
+		names, err := lister.ListZones(ctx)
+		if err != nil {
+			Logger.Warnw("failed to list zones from handler", "handler", adapter.Name(), "error", err.Error())
+			return nil, false
+		}
+
+		zones := make(map[string]bool, len(names))
+		for _, name := range names {
+			zones[miekgdns.Fqdn(miekgdns.CanonicalName(name))] = true
+		}
+		Logger.Debugw("listed zones from handler", "handler", adapter.Name(), "count", len(zones))
+		listings[adapter] = zones
+		return zones, true
+	}
+
+	var errs []error
+
+	// configured zones
+	if verify := s.Configuration.Discovery.Verify; verify != VerifyZonesOff {
+		for _, zone := range s.staticZones() {
+			zones, ok := list(zone.Handler())
+			if !ok {
+				if startup && verify == VerifyZonesFail {
+					errs = append(errs, fmt.Errorf("zone '%s': cannot list zones of handler '%s'", zone.Fqdn(),
+						zone.Handler().Name()))
+				}
+				continue
+			}
+			if !zones[zone.Fqdn()] {
+				Logger.Warnw("configured zone not found in its backend", "name", zone.Fqdn(), "handler",
+					zone.Handler().Name())
+				if startup && verify == VerifyZonesFail {
+					errs = append(errs, fmt.Errorf("zone '%s' not found in handler '%s'", zone.Fqdn(),
+						zone.Handler().Name()))
+				}
+			}
+		}
+	}
+
+	// discovered zones, the first matching rule wins
+	seen := make(map[string]bool)
+	listed := make(map[common.IAdapter]bool)
+	for _, rule := range s.discoveryRules {
+		zones, ok := list(rule.adapter)
+		if !ok {
+			continue
+		}
+		listed[rule.adapter] = true
+
+		for fqdn := range zones {
+			if seen[fqdn] || !rule.match(fqdn) {
+				continue
+			}
+			if _, found := s.lookupZone(fqdn); found && !s.discovered[fqdn] {
+				// configured zones take precedence
+				continue
+			}
+			seen[fqdn] = true
+			if s.discovered[fqdn] {
+				continue
+			}
+
+			zone, err := s.newDiscoveredZone(fqdn, rule)
+			if err != nil {
+				Logger.Warnw("skipping discovered zone", "name", fqdn, "handler", rule.adapter.Name(), "error", err.Error())
+				continue
+			}
+			s.addZone(zone)
+			s.discovered[fqdn] = true
+			Logger.Infow("discovered zone", "name", fqdn, "handler", rule.adapter.Name())
+		}
+	}
+
+	// zones gone from a backend which could be listed
+	for fqdn := range s.discovered {
+		zone, found := s.lookupZone(fqdn)
+		if seen[fqdn] || !found || !listed[zone.Handler()] {
+			continue
+		}
+		s.removeZone(fqdn)
+		delete(s.discovered, fqdn)
+		Logger.Infow("discovered zone removed from its backend", "name", fqdn, "handler", zone.Handler().Name())
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Server) staticZones() []*dns.Zone {
+	s.zonesLock.RLock()
+	defer s.zonesLock.RUnlock()
+
+	zones := make([]*dns.Zone, 0, len(s.zones))
+	for _, zone := range s.zones {
+		if !s.discovered[zone.Fqdn()] {
+			zones = append(zones, zone)
+		}
+	}
+	return zones
+}
+
+func (s *Server) newDiscoveredZone(fqdn string, rule *discoveryRule) (*dns.Zone, error) {
+	zone, err := dns.NewZone(fqdn)
+	if err != nil {
+		return nil, err
+	}
+	zone.SetHandler(rule.adapter)
+	zone.SetPolicy(rule.policy)
+	zone.SetDryRun(rule.config.DryRun)
+
+	if rule.config.Unsecure {
+		zone.DisableAuthentication()
+		return zone, nil
+	}
+
+	name := strings.TrimSuffix(fqdn, ".")
+	label, _, _ := strings.Cut(name, ".")
+	data := DiscoveredZone{Zone: fqdn, Name: name, Label: label}
+
+	var keys []string
+	for _, tmpl := range rule.keys {
+		var key strings.Builder
+		if err := tmpl.Execute(&key, data); err != nil {
+			return nil, fmt.Errorf("failed to render key name: %w", err)
+		}
+		keys = append(keys, key.String())
+	}
+	if len(keys) == 0 && len(s.defaultKeyName) > 0 {
+		keys = append(keys, s.defaultKeyName)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("authentication enabled but no key")
+	}
+
+	for _, key := range keys {
+		if !s.keyring.HasKey(key) {
+			return nil, fmt.Errorf("unknown key '%s'", key)
+		}
+		zone.AddValidKey(key)
+	}
+	return zone, nil
+}
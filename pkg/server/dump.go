@@ -0,0 +1,171 @@
+package server
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Placeholder of the values of fields tagged `sensitive:"true"`
+const Redacted = "<redacted>"
+
+// A zone with the handler and keys it is actually served with, once defaults are applied
+type ZoneBinding struct {
+	Zone    string
+	Handler string
+	Adapter string
+	// Disabled for unsecure zones only
+	Authentication bool
+	Keys           []string
+	// Whether the keys are the default key, changing along with it
+	DefaultKey   bool
+	Certificates []string
+	Allow        []string
+	Requires     ZoneRequirements
+	Policy       ZonePolicyConfiguration
+	// Set for the zone or for the whole server
+	DryRun bool
+}
+
+// Resolves the zones like the server does at startup, discovered zones excepted
+func (c *Configuration) Bindings() []ZoneBinding {
+	var (
+		defaultKeyName string
+		defaultHandler HandlerConfiguration
+		bindings       = make([]ZoneBinding, 0, len(c.Zones))
+	)
+	if idx := slices.IndexFunc(c.Tsig.Keys, func(key TsigKeyConfiguration) bool { return key.Default }); idx >= 0 {
+		defaultKeyName = c.Tsig.Keys[idx].Name
+	}
+	if idx := slices.IndexFunc(c.Handlers, func(handler HandlerConfiguration) bool { return handler.Default }); idx >= 0 {
+		defaultHandler = c.Handlers[idx]
+	}
+
+	for _, zone := range c.Zones {
+		binding := ZoneBinding{
+			Zone:           zone.Zone,
+			Handler:        defaultHandler.Name,
+			Adapter:        string(defaultHandler.Adapter),
+			Authentication: !zone.Unsecure,
+			Keys:           []string{},
+			Certificates:   zone.Certificates,
+			Allow:          zone.Allow,
+			Requires:       zone.Requires,
+			Policy:         zone.Policy,
+			DryRun:         zone.DryRun || c.Server.DryRun,
+		}
+		if zone.Handler != "" {
+			binding.Handler, binding.Adapter = zone.Handler, ""
+			if idx := slices.IndexFunc(c.Handlers, func(handler HandlerConfiguration) bool {
+				return handler.Name == zone.Handler
+			}); idx >= 0 {
+				binding.Adapter = string(c.Handlers[idx].Adapter)
+			}
+		}
+		if binding.Authentication {
+			binding.Keys = zoneKeys(&zone, defaultKeyName)
+			binding.DefaultKey = len(zone.Keys) == 0 && len(binding.Keys) > 0
+		}
+		bindings = append(bindings, binding)
+	}
+
+	return bindings
+}
+
+// Generic form of the configuration, laid out like the configuration file with lowercased keys,
+// but with zones replaced by their bindings. Defaults are applied to the configuration first, like
+// the server does at startup. Secrets are redacted unless included.
+func (c *Configuration) Dump(includeSecrets bool) map[string]any {
+	c.setDefaults()
+	dump := dumpValue(reflect.ValueOf(c), includeSecrets).(map[string]any)
+	dump["zones"] = dumpValue(reflect.ValueOf(c.Bindings()), includeSecrets)
+	return dump
+}
+
+func dumpValue(value reflect.Value, includeSecrets bool) any {
+	switch value.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if value.IsNil() {
+			return nil
+		}
+		return dumpValue(value.Elem(), includeSecrets)
+	case reflect.Struct:
+		if handler, ok := value.Interface().(HandlerConfiguration); ok {
+			// adapter settings are nested under the adapter slug
+			dump := dumpValue(reflect.ValueOf(handler.EmbeddedHandlerConfiguration), includeSecrets).(map[string]any)
+			if settings := dumpValue(reflect.ValueOf(handler.Settings), includeSecrets); settings != nil {
+				dump[string(handler.Adapter)] = settings
+			}
+			return dump
+		}
+		return dumpStruct(value, includeSecrets)
+	case reflect.Slice, reflect.Array:
+		dump := make([]any, 0, value.Len())
+		for idx := range value.Len() {
+			dump = append(dump, dumpValue(value.Index(idx), includeSecrets))
+		}
+		return dump
+	case reflect.Map:
+		dump := make(map[string]any, value.Len())
+		for iter := value.MapRange(); iter.Next(); {
+			dump[strings.ToLower(iter.Key().String())] = dumpValue(iter.Value(), includeSecrets)
+		}
+		return dump
+	default:
+		if duration, ok := value.Interface().(time.Duration); ok {
+			return duration.String()
+		}
+		return value.Interface()
+	}
+}
+
+func dumpStruct(value reflect.Value, includeSecrets bool) map[string]any {
+	dump := make(map[string]any)
+	for idx := range value.NumField() {
+		field := value.Type().Field(idx)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for key, item := range dumpStruct(value.Field(idx), includeSecrets) {
+				dump[key] = item
+			}
+			continue
+		}
+
+		item := dumpValue(value.Field(idx), includeSecrets)
+		if item == nil {
+			// unset sections, TOML having no null value
+			continue
+		}
+		if field.Tag.Get("sensitive") == "true" && !includeSecrets {
+			item = redact(item)
+		}
+		dump[strings.ToLower(field.Name)] = item
+	}
+	return dump
+}
+
+// Empty values are kept, telling unset secrets apart
+func redact(value any) any {
+	switch typed := value.(type) {
+	case string:
+		if typed == "" {
+			return typed
+		}
+		return Redacted
+	case []any:
+		for idx := range typed {
+			typed[idx] = redact(typed[idx])
+		}
+		return typed
+	case map[string]any:
+		for key := range typed {
+			typed[key] = redact(typed[key])
+		}
+		return typed
+	default:
+		return Redacted
+	}
+}
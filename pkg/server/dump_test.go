@@ -0,0 +1,80 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+const bindingsConfiguration = `tsig:
+  keys:
+    - {name: main., key: ` + testMainSecret + `, default: true}
+    - {name: other., key: ` + testOtherSecret + `}
+handlers:
+  - name: mem
+    default: true
+    adapter: memory
+    memory: {}
+  - name: pdns
+    adapter: powerdns
+    powerdns: {url: "http://127.0.0.1:8081", vhost: localhost, key: c2VjcmV0}
+zones:
+  - zone: example.test
+  - {zone: other.test, keys: [other.], handler: pdns}
+  - {zone: open.test, unsecure: true}
+`
+
+func TestBindings(t *testing.T) {
+	bindings := loadTestConfiguration(t, bindingsConfiguration).Bindings()
+
+	tests := []struct {
+		zone       string
+		handler    string
+		adapter    string
+		keys       []string
+		defaultKey bool
+	}{
+		{"example.test", "mem", "memory", []string{"main."}, true},
+		{"other.test", "pdns", "powerdns", []string{"other."}, false},
+		{"open.test", "mem", "memory", []string{}, false},
+	}
+	if len(bindings) != len(tests) {
+		t.Fatalf("expected %d bindings, got %d", len(tests), len(bindings))
+	}
+	for idx, test := range tests {
+		binding := bindings[idx]
+		if binding.Zone != test.zone || binding.Handler != test.handler || binding.Adapter != test.adapter ||
+			!reflect.DeepEqual(binding.Keys, test.keys) || binding.DefaultKey != test.defaultKey {
+			t.Errorf("%s: got %+v", test.zone, binding)
+		}
+	}
+}
+
+// Unset settings are dumped with the values the server runs with
+func TestDumpDefaults(t *testing.T) {
+	dump := loadTestConfiguration(t, bindingsConfiguration).Dump(false)
+
+	tests := []struct {
+		path     []string
+		expected any
+	}{
+		{[]string{"server", "updatetimeout"}, defaultUpdateTimeout.String()},
+		{[]string{"discovery", "verify"}, VerifyZonesWarn},
+		{[]string{"tsig", "tkey", "maxlifetime"}, defaultTkeyLifetime.String()},
+		{[]string{"tsig", "tkey", "maxkeys"}, defaultTkeyMaxKeys},
+	}
+	for _, test := range tests {
+		var value any = dump
+		for _, key := range test.path {
+			value = value.(map[string]any)[key]
+		}
+		if value != test.expected {
+			t.Errorf("%v: got %v, expected %v", test.path, value, test.expected)
+		}
+	}
+
+	handlers := dump["handlers"].([]any)
+	settings := handlers[1].(map[string]any)["powerdns"].(map[string]any)
+	if settings["timeout"] == "0s" {
+		t.Error("PowerDNS timeout dumped without its default")
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/enix/tsigoat/pkg/dns/update"
+	miekgdns "github.com/miekg/dns"
+)
+
+// Room left in responses for the TSIG record, added once the OPT record is filled,
+// and for the option header and the line counting the changes left out
+const (
+	tsigRecordRoom     = 128
+	omittedChangesRoom = 32
+)
+
+// OPT record of the response, added when missing. OPT records are only allowed in responses
+// to requests with one (RFC 6891 section 7), nil being returned otherwise.
+func responseOpt(response *miekgdns.Msg, received *miekgdns.Msg) *miekgdns.OPT {
+	if received.IsEdns0() == nil {
+		return nil
+	}
+	if opt := response.IsEdns0(); opt != nil {
+		return opt
+	}
+	response.SetEdns0(received.IsEdns0().UDPSize(), false)
+	return response.IsEdns0()
+}
+
+func requestsDryRun(received *miekgdns.Msg) bool {
+	opt := received.IsEdns0()
+	if opt == nil {
+		return false
+	}
+	for _, option := range opt.Option {
+		if local, ok := option.(*miekgdns.EDNS0_LOCAL); ok && local.Code == update.DryRunOption {
+			return true
+		}
+	}
+	return false
+}
+
+// Lists the changes of a dry run in the response, one per line, as many as fit in the client buffer
+func addDryRunChanges(response *miekgdns.Msg, received *miekgdns.Msg, changes []update.Change) {
+	opt := responseOpt(response, received)
+	if opt == nil {
+		return
+	}
+
+	budget := max(int(opt.UDPSize()), miekgdns.MinMsgSize) - response.Len() - tsigRecordRoom - omittedChangesRoom
+	lines := make([]string, 0, len(changes))
+	for idx, change := range changes {
+		line := change.String()
+		if len(line)+1 > budget {
+			lines = append(lines, fmt.Sprintf("%d more change(s)", len(changes)-idx))
+			break
+		}
+		lines = append(lines, line)
+		budget -= len(line) + 1
+	}
+
+	opt.Option = append(opt.Option, &miekgdns.EDNS0_LOCAL{
+		Code: update.DryRunOption,
+		Data: []byte(strings.Join(lines, "\n")),
+	})
+}
@@ -1,9 +1,15 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"slices"
+	"time"
 
+	"github.com/enix/tsigoat/pkg/adapters/common"
 	"github.com/enix/tsigoat/pkg/dns"
+	"github.com/enix/tsigoat/pkg/dns/identity"
+	"github.com/enix/tsigoat/pkg/dns/tkey"
 	"github.com/enix/tsigoat/pkg/dns/update"
 	miekgdns "github.com/miekg/dns"
 	"go.uber.org/zap/zapcore"
@@ -20,7 +26,16 @@ func (s *Server) Handle(writer miekgdns.ResponseWriter, received *miekgdns.Msg)
 		rrset         []miekgdns.RR
 		prerequisites update.Prerequisites
 		authorization update.Authorization
-		task          update.Task
+		// set once the update task is built, nil for requests refused before authorization or task creation
+		task          *update.Task
+		ctx           context.Context
+		cancel        context.CancelFunc
+		capabilities  common.Capabilities
+		identities    []identity.Identity
+		identityErr   error
+		authenticated bool
+		dryRun        bool
+		reason        string
 	)
 
 	// Catch panic calls during query processing.
@@ -46,6 +61,16 @@ func (s *Server) Handle(writer miekgdns.ResponseWriter, received *miekgdns.Msg)
 	tsig := received.IsTsig()
 	tsigStatus := writer.TsigStatus()
 
+	// Every verified identity of the requester, the zone rules decide which ones are relevant
+	identities, identityErr = s.identitiesOf(writer, received)
+	authenticated = slices.ContainsFunc(identities, identity.Identity.IsCryptographic)
+
+	// Session key negotiations (RFC 2930) are the only queries answered
+	if len(s.tkeyBootstrap) > 0 && tkey.IsRequest(received) {
+		s.handleTkey(writer, received, identityErr)
+		return
+	}
+
 	// The message we'll send back
 	response := new(miekgdns.Msg)
 
@@ -89,10 +114,11 @@ func (s *Server) Handle(writer miekgdns.ResponseWriter, received *miekgdns.Msg)
 			"extras", len(received.Extra))
 	}
 
-	// Early rejection of invalid TSIG signatures.
-	// This check is performed again later; this instance is solely for optimization and logging purposes.
-	if tsig != nil && tsigStatus != nil {
-		Logger.Debug("early rejection of an invalid signature")
+	// Early rejection of invalid TSIG and SIG(0) signatures.
+	// Invalid signatures never make it to the identities checked later.
+	if identityErr != nil {
+		Logger.Debugw("early rejection of an invalid signature", "error", identityErr.Error())
+		reason = identityErr.Error()
 		response.SetRcode(received, miekgdns.RcodeRefused)
 		goto reply
 	}
@@ -116,17 +142,30 @@ func (s *Server) Handle(writer miekgdns.ResponseWriter, received *miekgdns.Msg)
 		goto formerr
 	}
 
-	// TODO are we allowing for zone enumeration before authentication here?
-	if zone, ok = s.zonesByFqdn[zoneName]; !ok {
+	// Invalid signatures were refused above whether the zone exists or not.
+	// When zones are hidden, unsigned requests get the same answer for unknown and secured zones,
+	// both cases going through the same lookup and checks. Only zones with authentication disabled
+	// can be told apart, as they accept unsigned updates.
+	zone, ok = s.lookupZone(zoneName)
+	if s.hideZones && (!ok || (!authenticated && zone.AllowsUnsigned() == false)) {
+		Logger.Debug("refusing update without revealing whether the zone exists")
+		reason = "unknown zone or unsigned update"
+		response.SetRcode(received, miekgdns.RcodeRefused)
+		goto reply
+	}
+
+	if !ok {
 		Logger.Debug("query for an unknown zone")
+		reason = "unknown zone"
 		response.SetRcode(received, miekgdns.RcodeNotAuth)
 		goto reply
 	}
 
 	// Early rejection of unsigned updates to secured zones.
 	// This check is performed again later; this instance is solely for optimization and logging purposes.
-	if tsig == nil && zone.HasAuthenticationDisabled() == false {
+	if !authenticated && zone.AllowsUnsigned() == false {
 		Logger.Debug("early rejection of an unauthenticated update to a secured zone")
+		reason = "unsigned update to a secured zone"
 		response.SetRcode(received, miekgdns.RcodeRefused)
 		goto reply
 	}
@@ -186,7 +225,8 @@ func (s *Server) Handle(writer miekgdns.ResponseWriter, received *miekgdns.Msg)
 				goto formerr
 			}
 
-			if !miekgdns.IsSubDomain(zoneName, rrHeader.Name) {
+			if !miekgdns.IsSubDomain(zoneName, rrHeader.Name) || !s.ownedByZone(zone, rrHeader.Name) {
+				reason = "prerequisite for a name outside of the zone"
 				response.SetRcode(received, miekgdns.RcodeNotZone)
 				goto reply
 			}
@@ -201,9 +241,7 @@ func (s *Server) Handle(writer miekgdns.ResponseWriter, received *miekgdns.Msg)
 				} else {
 					prerequisites.AddNameWithTypeMustExist(rr, miekgdns.RcodeNXRrset)
 				}
-			}
-
-			if rrHeader.Class == miekgdns.ClassNONE {
+			} else if rrHeader.Class == miekgdns.ClassNONE {
 				if rrHeader.Rdlength != 0 {
 					goto formerr
 				}
@@ -213,9 +251,7 @@ func (s *Server) Handle(writer miekgdns.ResponseWriter, received *miekgdns.Msg)
 				} else {
 					prerequisites.AddNameWithTypeMustBeAbsent(rr, miekgdns.RcodeYXRrset)
 				}
-			}
-
-			if rrHeader.Class == zoneClass {
+			} else if rrHeader.Class == zoneClass {
 				rrset = append(rrset, rr)
 			} else {
 				goto formerr
@@ -240,27 +276,18 @@ func (s *Server) Handle(writer miekgdns.ResponseWriter, received *miekgdns.Msg)
 	//             if (local option)
 	//                  return (REFUSED)
 
-	if tsig != nil {
-		if tsigStatus == nil {
-			authorization.VerifiedIssuer(tsig.Hdr.Name, miekgdns.CanonicalName(tsig.Algorithm))
-		} else {
-			// No need to log this, as it was already handled in the early check.
-			// This code is unlikely to be executed but is retained for authoritative purposes.
-			response.SetRcode(received, miekgdns.RcodeRefused)
-			goto reply
-		}
-	} else {
-		if zone.HasAuthenticationDisabled() == false {
-			// No need to log this, as it was already handled in the early check.
-			// This code is unlikely to be executed but is retained for authoritative purposes.
-			response.SetRcode(received, miekgdns.RcodeRefused)
-			goto reply
-		}
+	if !authenticated && zone.AllowsUnsigned() == false {
+		// No need to log this, as it was already handled in the early check.
+		// This code is unlikely to be executed but is retained for authoritative purposes.
+		reason = "unsigned update to a secured zone"
+		response.SetRcode(received, miekgdns.RcodeRefused)
+		goto reply
 	}
 
-	//
-	// TODO implement non crypto authorization schemes here
-	//
+	// Checked against the zone rules when the update task starts
+	for _, id := range identities {
+		authorization.AddIdentity(id)
+	}
 
 	// -------------------------------------------------------
 	// RFC 2136 - Server Behavior
@@ -285,11 +312,15 @@ func (s *Server) Handle(writer miekgdns.ResponseWriter, received *miekgdns.Msg)
 	//      else
 	//           return (FORMERR)
 
+	capabilities = zone.Handler().Capabilities()
+
 	for _, rr := range received.Ns {
 		if rr != nil {
 			rrHeader := rr.Header()
 
-			if !miekgdns.IsSubDomain(zoneName, rrHeader.Name) {
+			if !miekgdns.IsSubDomain(zoneName, rrHeader.Name) || !s.ownedByZone(zone, rrHeader.Name) {
+				Logger.Debugw("update for a name outside of the zone", "name", rrHeader.Name)
+				reason = "update for a name outside of the zone"
 				response.SetRcode(received, miekgdns.RcodeNotZone)
 				goto reply
 			}
@@ -313,6 +344,15 @@ func (s *Server) Handle(writer miekgdns.ResponseWriter, received *miekgdns.Msg)
 			default:
 				goto formerr
 			}
+
+			// Not part of the RFC, refused before any backend call is made
+			if rrHeader.Rrtype != miekgdns.TypeANY && !capabilities.SupportsType(rrHeader.Rrtype) {
+				Logger.Infow("update with a type not supported by the zone handler", "name", rrHeader.Name,
+					"type", miekgdns.TypeToString[rrHeader.Rrtype], "handler", zone.Handler().Name())
+				reason = "type not supported by the zone handler"
+				response.SetRcode(received, miekgdns.RcodeNotImplemented)
+				goto reply
+			}
 		} else {
 			goto formerr
 		}
@@ -330,15 +370,41 @@ func (s *Server) Handle(writer miekgdns.ResponseWriter, received *miekgdns.Msg)
 	// processing of this section, signal SERVFAIL to the requestor and undo
 	// all updates applied to the zone during this transaction.
 
-	task = update.Task{
+	// The deadline applies to every backend call made on behalf of this update
+	ctx, cancel = context.WithTimeout(context.Background(), s.updateTimeout)
+	defer cancel()
+
+	// Dry runs are evaluated against the backend, which is left untouched
+	dryRun = s.dryRun || zone.DryRun() || requestsDryRun(received)
+	task = &update.Task{
+		Context:         ctx,
 		Authorization:   &authorization,
 		Prerequisites:   &prerequisites,
 		UpdateZoneClass: zoneClass,
 		UpdateRRset:     &received.Ns,
 		Logger:          Logger,
+		DryRun:          dryRun,
+		RecordChanges:   len(s.auditSinks) > 0,
 	}
 
-	if err := task.Execute(); err != nil {
+	err = task.Execute()
+	if err != nil {
+		if rcode, found := update.RcodeOf(err); found {
+			Logger.Infow("zone update rejected", "rcode", miekgdns.RcodeToString[rcode], "error", err.Error())
+			response.SetRcode(received, rcode)
+			// OPT records are only allowed in responses to requests with one (RFC 6891 section 7)
+			if ede := update.ExtendedErrorOf(err); ede != nil {
+				if opt := responseOpt(response, received); opt != nil {
+					opt.Option = append(opt.Option, ede)
+				}
+			}
+			goto reply
+		}
+		if errors.Is(err, common.ErrNotAuthoritative) {
+			Logger.Infow("zone update refused by the backend", "error", err.Error())
+			response.SetRcode(received, miekgdns.RcodeNotAuth)
+			goto reply
+		}
 		Logger.Errorw("zone update task failed", "error", err.Error())
 		response.SetRcode(received, miekgdns.RcodeServerFailure)
 		goto reply
@@ -348,10 +414,52 @@ func (s *Server) Handle(writer miekgdns.ResponseWriter, received *miekgdns.Msg)
 	}
 
 formerr:
+	reason = "malformed update"
 	response.SetRcodeFormatError(received)
 reply:
 	// if Logger.Level() == zapcore.DebugLevel {
 	// 	Logger.Debugf("sending reponse message:\n%s", response.String())
 	// }
+	if task != nil {
+		s.recordUpdate(writer, task, response.Rcode, err)
+	}
+	if received.Opcode == miekgdns.OpcodeUpdate {
+		if err != nil {
+			reason = err.Error()
+		}
+		s.auditUpdate(writer, received, task, response.Rcode, reason)
+	}
+	// Clients are told their update was not applied, whatever enabled the dry run
+	if task != nil && task.DryRun {
+		addDryRunChanges(response, received, task.Changes())
+	}
+	// Responses to validly signed requests are signed with the same key (RFC 8945 section 5.3)
+	if tsig != nil && tsigStatus == nil {
+		response.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+	}
 	writer.WriteMsg(response)
 }
+
+// Kept for inspection through the admin API
+func (s *Server) recordUpdate(writer miekgdns.ResponseWriter, task *update.Task, rcode int, err error) {
+	record := updateRecord{
+		Time:    time.Now().UTC(),
+		Client:  writer.RemoteAddr().String(),
+		Zone:    task.Authorization.Zone.Fqdn(),
+		Changes: len(*task.UpdateRRset),
+		Rcode:   miekgdns.RcodeToString[rcode],
+		DryRun:  task.DryRun,
+	}
+	record.Identity, _ = task.Authorization.Issuer()
+	if err != nil {
+		record.Error = err.Error()
+	}
+	s.history.add(record)
+}
+
+// Names under a configured child zone belong to that zone.
+// Delegations inside the zone are checked by the update task, as they require the zone content.
+func (s *Server) ownedByZone(zone *dns.Zone, name string) bool {
+	owner, found := s.matchZone(name)
+	return found && owner == zone
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	miekgdns "github.com/miekg/dns"
+)
+
+const (
+	testMainSecret  = "c2VjcmV0c2VjcmV0c2VjcmV0"
+	testOtherSecret = "b3RoZXJvdGhlcm90aGVyb3RoZXI="
+	testWrongSecret = "d3Jvbmd3cm9uZ3dyb25nd3Jvbmc="
+)
+
+// A server with example.test secured by main. and other.test secured by other.,
+// or with other.test only when example.test is left out
+func hideZonesConfiguration(hideZones bool, withExample bool) string {
+	records := `        - "other.test. 3600 IN SOA ns1.other.test. hostmaster.other.test. 1 3600 600 86400 300"`
+	zones := `  - {zone: other.test, keys: [other.]}`
+	if withExample {
+		records += "\n" + `        - "example.test. 3600 IN SOA ns1.example.test. hostmaster.example.test. 1 3600 600 86400 300"`
+		zones += "\n" + `  - {zone: example.test, keys: [main.]}`
+	}
+	return fmt.Sprintf(`server:
+  hideZones: %t
+tsig:
+  keys:
+    - {name: main., key: %s}
+    - {name: other., key: %s}
+handlers:
+  - name: mem
+    default: true
+    adapter: memory
+    memory:
+      records:
+%s
+zones:
+%s
+`, hideZones, testMainSecret, testOtherSecret, records, zones)
+}
+
+// An update to example.test, signed when a key is given, and its MAC
+func packUpdate(t *testing.T, keyName string, secret string) ([]byte, string) {
+	t.Helper()
+
+	rr, err := miekgdns.NewRR("www.example.test. 300 IN A 192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := new(miekgdns.Msg)
+	request.SetUpdate("example.test.")
+	request.Insert([]miekgdns.RR{rr})
+	request.Id = 4242
+
+	if keyName == "" {
+		packed, err := request.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return packed, ""
+	}
+	request.SetTsig(keyName, miekgdns.HmacSHA256, 300, time.Now().Unix())
+	packed, mac, err := miekgdns.TsigGenerate(request, secret, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packed, mac
+}
+
+func unpackResponse(t *testing.T, raw []byte) *miekgdns.Msg {
+	t.Helper()
+
+	response := new(miekgdns.Msg)
+	if err := response.Unpack(raw); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	return response
+}
+
+// Unknown zones can't be told apart from secured zones by clients failing to authenticate
+func TestHideZonesUnauthenticated(t *testing.T) {
+	hosting, _ := startTestServer(t, hideZonesConfiguration(true, true))
+	hiding, _ := startTestServer(t, hideZonesConfiguration(true, false))
+
+	tests := []struct {
+		name    string
+		keyName string
+		secret  string
+	}{
+		{"unsigned", "", ""},
+		{"unknown key", "ghost.", testMainSecret},
+		{"wrong secret", "main.", testWrongSecret},
+	}
+
+	var first []byte
+	for _, test := range tests {
+		request, _ := packUpdate(t, test.keyName, test.secret)
+		fromHosting := exchangeRaw(t, hosting, request)
+		fromHiding := exchangeRaw(t, hiding, request)
+
+		if rcode := unpackResponse(t, fromHosting).Rcode; rcode != miekgdns.RcodeRefused {
+			t.Errorf("%s: got %s, expected REFUSED", test.name, miekgdns.RcodeToString[rcode])
+		}
+		if !bytes.Equal(fromHosting[2:], fromHiding[2:]) {
+			t.Errorf("%s: responses differ for a hosted and an unknown zone:\n%x\n%x", test.name, fromHosting,
+				fromHiding)
+		}
+
+		// the reason of the refusal isn't disclosed either
+		if first == nil {
+			first = fromHosting
+		} else if !bytes.Equal(first[2:], fromHosting[2:]) {
+			t.Errorf("%s: response differs from the %s one:\n%x\n%x", test.name, tests[0].name, fromHosting, first)
+		}
+	}
+}
+
+// A key valid for another zone gets the same signed refusal from an unknown zone and a zone it can't update
+func TestHideZonesUnauthorized(t *testing.T) {
+	hosting, _ := startTestServer(t, hideZonesConfiguration(true, true))
+	hiding, _ := startTestServer(t, hideZonesConfiguration(true, false))
+
+	request, mac := packUpdate(t, "other.", testOtherSecret)
+	var responses [][]byte
+	for _, address := range []string{hosting, hiding} {
+		raw := exchangeRaw(t, address, request)
+		response := unpackResponse(t, raw)
+		if err := miekgdns.TsigVerify(raw, testOtherSecret, mac, false); err != nil {
+			t.Fatalf("%s: response not signed with the request key: %v", address, err)
+		}
+
+		// signatures carry the signing time, they are compared without it
+		if response.Rcode != miekgdns.RcodeRefused {
+			t.Errorf("%s: got %s, expected REFUSED", address, miekgdns.RcodeToString[response.Rcode])
+		}
+		response.Extra = response.Extra[:len(response.Extra)-1]
+		unsigned, err := response.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, unsigned)
+	}
+	if !bytes.Equal(responses[0], responses[1]) {
+		t.Errorf("responses differ for a zone the key can't update and an unknown zone:\n%x\n%x", responses[0],
+			responses[1])
+	}
+}
+
+// Without hidden zones, unknown zones are answered NOTAUTH
+func TestHideZonesDisabled(t *testing.T) {
+	hosting, _ := startTestServer(t, hideZonesConfiguration(false, true))
+	hiding, _ := startTestServer(t, hideZonesConfiguration(false, false))
+
+	request, _ := packUpdate(t, "", "")
+	if rcode := unpackResponse(t, exchangeRaw(t, hosting, request)).Rcode; rcode != miekgdns.RcodeRefused {
+		t.Errorf("secured zone: got %s, expected REFUSED", miekgdns.RcodeToString[rcode])
+	}
+	if rcode := unpackResponse(t, exchangeRaw(t, hiding, request)).Rcode; rcode != miekgdns.RcodeNotAuth {
+		t.Errorf("unknown zone: got %s, expected NOTAUTH", miekgdns.RcodeToString[rcode])
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultHistorySize = 100
+
+// Outcome of an update request, as reported by the admin API
+type updateRecord struct {
+	Time     time.Time `json:"time"`
+	Client   string    `json:"client"`
+	Zone     string    `json:"zone"`
+	Identity string    `json:"identity,omitempty"`
+	Changes  int       `json:"changes"`
+	Rcode    string    `json:"rcode"`
+	DryRun   bool      `json:"dryrun,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Ring buffer of the most recent updates, a nil history records nothing
+type updateHistory struct {
+	lock    sync.Mutex
+	records []updateRecord
+	next    int
+}
+
+func newUpdateHistory(size int) *updateHistory {
+	return &updateHistory{records: make([]updateRecord, 0, size)}
+}
+
+func (h *updateHistory) add(record updateRecord) {
+	if h == nil {
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.records) < cap(h.records) {
+		h.records = append(h.records, record)
+		return
+	}
+	h.records[h.next] = record
+	h.next = (h.next + 1) % len(h.records)
+}
+
+// Returns the records, most recent first
+func (h *updateHistory) list() []updateRecord {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	records := make([]updateRecord, 0, len(h.records))
+	for idx := range h.records {
+		records = append(records, h.records[(h.next+len(h.records)-1-idx)%len(h.records)])
+	}
+	return records
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/enix/tsigoat/pkg/dns/identity"
+	"github.com/enix/tsigoat/pkg/dns/sig0"
+	miekgdns "github.com/miekg/dns"
+)
+
+// Returns the verified identities of the requester, or an error when a signature is invalid.
+// TSIG signatures are verified by the library, SIG(0) ones here.
+func (s *Server) identitiesOf(writer miekgdns.ResponseWriter, received *miekgdns.Msg) ([]identity.Identity, error) {
+	var identities []identity.Identity
+
+	// taken in any case, so it doesn't linger
+	var raw []byte
+	if s.rawMessages != nil {
+		raw = s.rawMessages.take(writer.RemoteAddr(), received.Id)
+	}
+
+	if tsig := received.IsTsig(); tsig != nil {
+		if err := writer.TsigStatus(); err != nil {
+			return nil, fmt.Errorf("TSIG: %w", err)
+		}
+		// session keys act on behalf of the key they were negotiated with
+		name := tsig.Hdr.Name
+		if dynamic, found := s.keyring.DynamicKey(name); found {
+			name = dynamic.Owner
+		}
+		identities = append(identities, identity.NewTsigIdentity(name, miekgdns.CanonicalName(tsig.Algorithm)))
+	}
+
+	if sig := sig0.SignatureOf(received); sig != nil {
+		if raw == nil {
+			return nil, fmt.Errorf("SIG(0): %w", sig0.ErrUnknownKey)
+		}
+		key, err := s.sig0Keyring.Verify(raw, sig)
+		if err != nil {
+			return nil, fmt.Errorf("SIG(0): %w", err)
+		}
+		identities = append(identities, identity.NewSig0Identity(miekgdns.CanonicalName(key.Hdr.Name),
+			miekgdns.AlgorithmToString[key.Algorithm]))
+	}
+
+	if stater, ok := writer.(miekgdns.ConnectionStater); ok {
+		if id, ok := identity.NewCertificateIdentity(stater.ConnectionState()); ok {
+			identities = append(identities, id)
+		}
+	}
+
+	if address, ok := addressOf(writer.RemoteAddr()); ok {
+		identities = append(identities, identity.NewAddressIdentity(address))
+	}
+
+	return identities, nil
+}
+
+func addressOf(addr net.Addr) (netip.Addr, bool) {
+	switch value := addr.(type) {
+	case *net.UDPAddr:
+		return value.AddrPort().Addr(), true
+	case *net.TCPAddr:
+		return value.AddrPort().Addr(), true
+	default:
+		return netip.Addr{}, false
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	miekgdns "github.com/miekg/dns"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Extensions of the files included from a directory
+var includeExtensions = []string{".yaml", ".yml", ".json", ".toml"}
+
+// Sections an included file may set, its entries being appended to the ones of the main file.
+// Entries are identified by a field, such as the zone name, so duplicates are reported with their file.
+type includeSection struct {
+	path  string
+	kind  string
+	field string
+	// whether the identifying field is a domain name
+	domain bool
+}
+
+var includeSections = []includeSection{
+	{path: "tsig.keys", kind: "key", field: "name", domain: true},
+	{path: "sig0.keys"},
+	{path: "handlers", kind: "handler", field: "name"},
+	{path: "zones", kind: "zone", field: "zone", domain: true},
+	{path: "discovery.rules"},
+}
+
+func (s *includeSection) key() string {
+	return strings.ReplaceAll(s.path, ".", "\\")
+}
+
+// Name of an entry, empty when the section entries have no identity or the field is missing
+func (s *includeSection) identity(entry any) string {
+	if s.field == "" {
+		return ""
+	}
+	settings, ok := entry.(map[string]any)
+	if !ok {
+		return ""
+	}
+	for key, value := range settings {
+		name, ok := value.(string)
+		if !ok || !strings.EqualFold(key, s.field) {
+			continue
+		}
+		if s.domain {
+			return miekgdns.Fqdn(miekgdns.CanonicalName(name))
+		}
+		return name
+	}
+	return ""
+}
+
+// File and index in its section an entry of the merged configuration comes from
+type includeOrigin struct {
+	file  string
+	index int
+}
+
+// Outcome of merging the included files into the main one
+type includes struct {
+	// origin of every entry, by section path, empty file for the main file
+	origins  map[string][]includeOrigin
+	problems []Problem
+}
+
+// Merges the files included by the main configuration file into its settings. Duplicate entries
+// are reported and dropped, so the remaining problems are only reported once by validation.
+func includeFiles(v *viper.Viper, logger *zap.SugaredLogger) (*includes, error) {
+	result := &includes{origins: make(map[string][]includeOrigin)}
+
+	patterns := v.GetStringSlice("include")
+	if len(patterns) == 0 {
+		return result, nil
+	}
+	files, err := includedFiles(v.ConfigFileUsed(), patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string][]any)
+	// file defining each entry, by section path then identity
+	definitions := make(map[string]map[string]string)
+	for _, section := range includeSections {
+		entries, _ := v.Get(section.key()).([]any)
+		merged[section.path] = entries
+		definitions[section.path] = make(map[string]string)
+		for idx, entry := range entries {
+			result.origins[section.path] = append(result.origins[section.path], includeOrigin{"", idx})
+			if name := section.identity(entry); name != "" {
+				if _, found := definitions[section.path][name]; !found {
+					definitions[section.path][name] = v.ConfigFileUsed()
+				}
+			}
+		}
+	}
+
+	for _, file := range files {
+		logger.Debugw("including configuration file", "path", file)
+
+		included := viper.NewWithOptions(viper.KeyDelimiter("\\"))
+		included.SetConfigFile(file)
+		if err := included.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		for _, key := range included.AllKeys() {
+			path := strings.ReplaceAll(key, "\\", ".")
+			if !slices.ContainsFunc(includeSections, func(section includeSection) bool { return section.path == path }) {
+				result.problems = append(result.problems, Problem{File: file, Path: path,
+					Message: "only zones, handlers, tsig.keys, sig0.keys and discovery.rules can be set in an included file"})
+			}
+		}
+
+		for _, section := range includeSections {
+			value := included.Get(section.key())
+			if value == nil {
+				continue
+			}
+			entries, ok := value.([]any)
+			if !ok {
+				result.problems = append(result.problems, Problem{File: file, Path: section.path, Message: "expected a list"})
+				continue
+			}
+
+			for idx, entry := range entries {
+				if name := section.identity(entry); name != "" {
+					if previous, found := definitions[section.path][name]; found {
+						result.problems = append(result.problems, Problem{
+							File:    file,
+							Path:    fmt.Sprintf("%s[%d].%s", section.path, idx, section.field),
+							Message: fmt.Sprintf("%s '%s' is already defined in %s", section.kind, name, previous),
+						})
+						continue
+					}
+					definitions[section.path][name] = file
+				}
+				merged[section.path] = append(merged[section.path], entry)
+				result.origins[section.path] = append(result.origins[section.path], includeOrigin{file, idx})
+			}
+		}
+	}
+
+	for _, section := range includeSections {
+		if len(merged[section.path]) > 0 {
+			v.Set(section.key(), merged[section.path])
+		}
+	}
+	return result, nil
+}
+
+// Files matching the include patterns, relative to the directory of the main file. Directories include
+// their configuration files, in lexical order. The main file is never included again.
+func includedFiles(main string, patterns []string) ([]string, error) {
+	var files []string
+
+	base := filepath.Dir(main)
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(base, pattern)
+		}
+
+		var matches []string
+		if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+			entries, err := os.ReadDir(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("include '%s': %w", pattern, err)
+			}
+			for _, entry := range entries {
+				if slices.Contains(includeExtensions, strings.ToLower(filepath.Ext(entry.Name()))) {
+					matches = append(matches, filepath.Join(pattern, entry.Name()))
+				}
+			}
+		} else if strings.ContainsAny(pattern, "*?[") {
+			// an empty include directory is not an error
+			if matches, err = filepath.Glob(pattern); err != nil {
+				return nil, fmt.Errorf("include '%s': %w", pattern, err)
+			}
+		} else if err != nil {
+			return nil, err
+		} else {
+			matches = []string{pattern}
+		}
+
+		slices.Sort(matches)
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() || sameFile(match, main) || slices.Contains(files, match) {
+				continue
+			}
+			files = append(files, match)
+		}
+	}
+	return files, nil
+}
+
+func sameFile(a string, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// Rewrites the paths of problems found in the merged configuration to the file and index the entry comes from
+func (i *includes) locate(problems []Problem) {
+	for idx := range problems {
+		problem := &problems[idx]
+		if problem.File != "" {
+			continue
+		}
+		for _, section := range includeSections {
+			prefix := section.path + "["
+			if !strings.HasPrefix(problem.Path, prefix) {
+				continue
+			}
+			end := strings.Index(problem.Path, "]")
+			index, err := strconv.Atoi(problem.Path[len(prefix):max(end, len(prefix))])
+			origins := i.origins[section.path]
+			if end < 0 || err != nil || index < 0 || index >= len(origins) || origins[index].file == "" {
+				break
+			}
+			problem.File = origins[index].file
+			problem.Path = fmt.Sprintf("%s[%d]%s", section.path, origins[index].index, problem.Path[end+1:])
+			break
+		}
+	}
+}
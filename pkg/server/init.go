@@ -2,15 +2,35 @@ package server
 
 import (
 	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
 
 	"github.com/enix/tsigoat/pkg/adapters"
 	"github.com/enix/tsigoat/pkg/adapters/common"
 	"github.com/enix/tsigoat/pkg/dns"
+	"github.com/enix/tsigoat/pkg/dns/identity"
+	miekgdns "github.com/miekg/dns"
 )
 
 func (s *Server) init() (err error) {
 	Logger.Debug("initializing server state")
 
+	s.Configuration.setDefaults()
+
+	s.updateTimeout = s.Configuration.Server.UpdateTimeout
+	Logger.Debugw("update processing deadline", "timeout", s.updateTimeout)
+
+	s.hideZones = s.Configuration.Server.HideZones
+	if s.hideZones {
+		Logger.Infow("zone existence is hidden from unauthenticated clients")
+	}
+
+	s.dryRun = s.Configuration.Server.DryRun
+	if s.dryRun {
+		Logger.Warnw("dry run mode enabled, updates are never applied")
+	}
+
 	// process TSIG keys from configuration
 	Logger.Debugw("initializing keyring", "count", len(s.Configuration.Tsig.Keys))
 	for _, config := range s.Configuration.Tsig.Keys {
@@ -20,6 +40,32 @@ func (s *Server) init() (err error) {
 	}
 	Logger.Debug("finished initializing keyring")
 
+	// keys and zone changes made through the admin API
+	if err = s.initAdmin(&s.Configuration.Admin); err != nil {
+		return
+	}
+
+	// records of every update received
+	if err = s.initAudit(&s.Configuration.Audit); err != nil {
+		return
+	}
+
+	// session keys negotiation
+	if err = s.initTkey(&s.Configuration.Tsig.Tkey); err != nil {
+		return
+	}
+
+	// process SIG(0) keys from configuration
+	if len(s.Configuration.Sig0.Keys) > 0 {
+		Logger.Debugw("initializing SIG(0) keyring", "count", len(s.Configuration.Sig0.Keys))
+		for _, key := range s.Configuration.Sig0.Keys {
+			if err = s.sig0Keyring.AddKey(key); err != nil {
+				return fmt.Errorf("failed to add SIG(0) key to keyring: %w", err)
+			}
+		}
+		s.rawMessages = newRawMessages()
+	}
+
 	// process handlers from configuration
 	Logger.Debugw("initializing handler", "count", len(s.Configuration.Handlers))
 	for _, config := range s.Configuration.Handlers {
@@ -29,6 +75,16 @@ func (s *Server) init() (err error) {
 	}
 	Logger.Debug("finished initializing handler")
 
+	// resolve references between handlers
+	for _, adapter := range s.adapters {
+		if linker, ok := adapter.(common.IAdapterLinker); ok {
+			Logger.Debugw("linking handler", "name", adapter.Name())
+			if err = linker.Link(s.lookupAdapter); err != nil {
+				return fmt.Errorf("failed to link handler '%s': %w", adapter.Name(), err)
+			}
+		}
+	}
+
 	// process zones from configuration
 	Logger.Debugw("initializing zones", "count", len(s.Configuration.Zones))
 	for _, config := range s.Configuration.Zones {
@@ -38,6 +94,11 @@ func (s *Server) init() (err error) {
 	}
 	Logger.Debug("finished initializing zones")
 
+	// check zones against backends and discover new ones
+	if err = s.initDiscovery(); err != nil {
+		return
+	}
+
 	Logger.Debug("finished initializing server state")
 	return
 }
@@ -86,6 +147,73 @@ func (s *Server) newHandler(config *HandlerConfiguration) error {
 	return nil
 }
 
+func zonePolicy(config *ZonePolicyConfiguration) (dns.Policy, error) {
+	policy := dns.Policy{
+		MinTtl:            config.MinTtl,
+		MaxTtl:            config.MaxTtl,
+		ClampTtl:          config.ClampTtl,
+		MaxRRsetSize:      config.MaxRRsetSize,
+		MaxRecordsPerName: config.MaxRecordsPerName,
+	}
+	for _, name := range config.Types {
+		rrType, found := miekgdns.StringToType[strings.ToUpper(name)]
+		if !found {
+			return policy, fmt.Errorf("unknown record type '%s'", name)
+		}
+		policy.Types = append(policy.Types, rrType)
+	}
+	for _, value := range config.Networks {
+		network, err := netip.ParsePrefix(value)
+		if err != nil {
+			return policy, err
+		}
+		policy.Networks = append(policy.Networks, network.Masked())
+	}
+	return policy, nil
+}
+
+func checkZoneRequirements(requires *ZoneRequirements, capabilities common.Capabilities) error {
+	for _, name := range requires.Types {
+		rrType, found := miekgdns.StringToType[strings.ToUpper(name)]
+		if !found {
+			return fmt.Errorf("unknown RR type '%s'", name)
+		}
+		if !capabilities.SupportsType(rrType) {
+			return fmt.Errorf("RR type %s is not supported", miekgdns.TypeToString[rrType])
+		}
+	}
+	if requires.Transactional && !capabilities.Transactional {
+		return fmt.Errorf("updates are not transactional")
+	}
+	if requires.Comments && !capabilities.Comments {
+		return fmt.Errorf("comments are not supported")
+	}
+	if requires.Dnssec && !capabilities.DNSSEC {
+		return fmt.Errorf("DNSSEC is not supported")
+	}
+	return nil
+}
+
+func (s *Server) lookupAdapter(name string) (common.IAdapter, bool) {
+	adapter, found := s.adaptersByName[name]
+	return adapter, found
+}
+
+// Keys securing a zone with authentication enabled, falling back to the default key
+func zoneKeys(config *ZoneConfiguration, defaultKeyName string) []string {
+	keys := make([]string, 0)
+	if len(config.Keys) > 0 {
+		// add keys from zone config
+		keys = append(keys, config.Keys...)
+	} else if len(config.Certificates) == 0 && len(config.Allow) == 0 {
+		// or try adding the default key, unless other identities are used instead
+		if len(defaultKeyName) > 0 {
+			keys = append(keys, defaultKeyName)
+		}
+	}
+	return keys
+}
+
 func (s *Server) newZone(config *ZoneConfiguration) error {
 	Logger.Debugw("adding new zone", "name", config.Zone)
 
@@ -98,18 +226,24 @@ func (s *Server) newZone(config *ZoneConfiguration) error {
 		// auth enabled, processing keys
 		Logger.Debugw("zone has authentication enabled", "name", config.Zone)
 
-		addKeys := make([]string, 0)
-		if len(config.Keys) > 0 {
-			// add keys from zone config
-			addKeys = append(addKeys, config.Keys...)
-		} else {
-			// or try adding the default key
-			if len(s.defaultKeyName) > 0 {
-				addKeys = append(addKeys, s.defaultKeyName)
+		addKeys := zoneKeys(config, s.defaultKeyName)
+
+		for _, name := range config.Certificates {
+			rule, err := identity.NewCertificateMatcher(name, "")
+			if err != nil {
+				Logger.Fatalw("zone with an invalid certificate name", "name", config.Zone, "error", err.Error())
+			}
+			zone.AddRule(rule)
+		}
+		for _, value := range config.Allow {
+			rule, err := identity.ParseMatcher(value)
+			if err != nil {
+				Logger.Fatalw("zone with an invalid identity rule", "name", config.Zone, "error", err.Error())
 			}
+			zone.AddRule(rule)
 		}
 
-		if len(addKeys) == 0 {
+		if len(addKeys) == 0 && len(config.Certificates) == 0 && len(config.Allow) == 0 {
 			Logger.Fatalw("zone with authentication enabled but no key", "name", config.Zone)
 		}
 
@@ -143,7 +277,57 @@ func (s *Server) newZone(config *ZoneConfiguration) error {
 	Logger.Debugw("affecting handler to zone", "name", config.Zone, "object", fmt.Sprintf("%p", adapter))
 	zone.SetHandler(adapter)
 
-	s.zones = append(s.zones, zone)
-	s.zonesByFqdn[zone.Fqdn()] = zone
+	if err := checkZoneRequirements(&config.Requires, adapter.Capabilities()); err != nil {
+		Logger.Fatalw("zone handler does not meet the zone requirements", "name", config.Zone, "handler", adapter.Name(),
+			"error", err.Error())
+	}
+	policy, err := zonePolicy(&config.Policy)
+	if err != nil {
+		Logger.Fatalw("zone with an invalid policy", "name", config.Zone, "error", err.Error())
+	}
+	zone.SetPolicy(policy)
+	zone.SetDryRun(config.DryRun)
+
+	if !adapter.Capabilities().Transactional {
+		Logger.Infow("zone handler is not transactional, a failing update may be partially applied", "name", config.Zone,
+			"handler", adapter.Name())
+	}
+
+	s.addZone(zone)
 	return nil
 }
+
+func (s *Server) addZone(zone *dns.Zone) {
+	s.applyZoneState(zone)
+
+	s.zonesLock.Lock()
+	defer s.zonesLock.Unlock()
+
+	s.zones = append(s.zones, zone)
+	s.zoneTree.Insert(zone)
+}
+
+func (s *Server) removeZone(fqdn string) {
+	s.zonesLock.Lock()
+	defer s.zonesLock.Unlock()
+
+	s.zoneTree.Remove(fqdn)
+	s.zones = slices.DeleteFunc(s.zones, func(zone *dns.Zone) bool {
+		return zone.Fqdn() == fqdn
+	})
+}
+
+func (s *Server) lookupZone(fqdn string) (*dns.Zone, bool) {
+	s.zonesLock.RLock()
+	defer s.zonesLock.RUnlock()
+
+	return s.zoneTree.Get(fqdn)
+}
+
+// Returns the deepest zone a name belongs to
+func (s *Server) matchZone(name string) (*dns.Zone, bool) {
+	s.zonesLock.RLock()
+	defer s.zonesLock.RUnlock()
+
+	return s.zoneTree.Match(name)
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Handlers failing to start are reported by name instead of crashing the server
+func TestInitHandlerError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tsigoat.yaml")
+	if err := os.WriteFile(path, []byte(`tsig:
+  keys:
+    - {name: main., key: `+testMainSecret+`, default: true}
+handlers:
+  - name: broken
+    default: true
+    adapter: memory
+    memory:
+      records:
+        - "not a record"
+zones:
+  - zone: example.test
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file := NewConfigurationFile(YamlConfiguration)
+	file.FullPath = path
+	config, _, err := LoadConfiguration(file, Logger)
+	if err != nil {
+		t.Fatalf("LoadConfiguration: %v", err)
+	}
+
+	err = NewServer(config).init()
+	if err == nil || !strings.Contains(err.Error(), "'broken'") {
+		t.Errorf("expected an error naming the handler, got %v", err)
+	}
+}
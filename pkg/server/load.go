@@ -0,0 +1,70 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/enix/tsigoat/internal/product"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Failures to find or read the file, as opposed to decoding and validation errors
+type LoadError struct {
+	Err error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("failed to load configuration file: %s", e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// Locates, reads and decodes the configuration file as set from the command line, along with the files
+// it includes. The path of the file is returned once it was found, even when decoding fails.
+func LoadConfiguration(file *ConfigurationFile, logger *zap.SugaredLogger) (*Configuration, string, error) {
+	v := viper.NewWithOptions(viper.KeyDelimiter("\\"))
+	v.SetEnvPrefix(product.Name)
+	v.SetConfigType(file.Type.String())
+
+	configFileName := fmt.Sprintf("%s.%s", file.Name, file.Type.String())
+	logger.Debugw("configuration file search parameters",
+		"directories", file.SearchPaths,
+		"filename", configFileName)
+	v.SetConfigName(configFileName)
+	for _, path := range file.SearchPaths {
+		v.AddConfigPath(path)
+	}
+
+	if file.FullPath != "" {
+		logger.Debugw("using a configuration full path",
+			"path", file.FullPath)
+		v.SetConfigFile(file.FullPath)
+	}
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, "", &LoadError{err}
+	}
+
+	includes, err := includeFiles(v, logger)
+	if err != nil {
+		return nil, v.ConfigFileUsed(), &LoadError{err}
+	}
+
+	logger.Debugw("parsing configuration file", "path", v.ConfigFileUsed())
+	config := &Configuration{}
+	if err := config.Unmarshal(v); err != nil {
+		var problemsErr *ProblemsError
+		if errors.As(err, &problemsErr) {
+			includes.locate(problemsErr.Problems)
+			problemsErr.Problems = append(includes.problems, problemsErr.Problems...)
+		}
+		return nil, v.ConfigFileUsed(), err
+	}
+	if len(includes.problems) > 0 {
+		return nil, v.ConfigFileUsed(), fmt.Errorf("validation error: %w", &ProblemsError{includes.problems})
+	}
+	return config, v.ConfigFileUsed(), nil
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/enix/tsigoat/pkg/adapters"
+	"github.com/enix/tsigoat/pkg/dns/identity"
+	"github.com/go-playground/validator/v10"
+	miekgdns "github.com/miekg/dns"
+	"github.com/mitchellh/mapstructure"
+)
+
+// A configuration problem, located by its path in the configuration file such as "zones[2].keys[0]"
+type Problem struct {
+	Path    string
+	Message string
+	// Included file the setting comes from, empty for the main file
+	File string
+}
+
+func (p Problem) String() string {
+	location := p.Path
+	if p.File != "" && p.Path != "" {
+		location = fmt.Sprintf("%s: %s", p.File, p.Path)
+	} else if p.File != "" {
+		location = p.File
+	}
+	if location == "" {
+		return p.Message
+	}
+	return fmt.Sprintf("%s: %s", location, p.Message)
+}
+
+// Every problem found in a configuration, instead of the first one
+type ProblemsError struct {
+	Problems []Problem
+}
+
+func (e *ProblemsError) Error() string {
+	messages := make([]string, 0, len(e.Problems))
+	for _, problem := range e.Problems {
+		messages = append(messages, problem.String())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Decoding errors are prefixed with the quoted path of the faulty setting
+var decodeErrorPath = regexp.MustCompile(`^'([^']*)' (.*)$`)
+
+func decodeProblems(err error) []Problem {
+	var decodeErr *mapstructure.Error
+	if !errors.As(err, &decodeErr) {
+		return []Problem{{Message: err.Error()}}
+	}
+
+	problems := make([]Problem, 0, len(decodeErr.Errors))
+	for _, message := range decodeErr.Errors {
+		if match := decodeErrorPath.FindStringSubmatch(message); match != nil {
+			problems = append(problems, Problem{Path: strings.ToLower(match[1]), Message: match[2]})
+		} else {
+			problems = append(problems, Problem{Message: message})
+		}
+	}
+	return problems
+}
+
+// Validates a decoded configuration, including references between sections
+func (c *Configuration) Check() []Problem {
+	var problems []Problem
+
+	problems = append(problems, c.validationProblems(validate.Struct(c), "")...)
+
+	if len(c.Zones) == 0 && len(c.Discovery.Rules) == 0 {
+		problems = append(problems, Problem{Message: "no zone configured nor discovery rule"})
+	}
+
+	for idx, name := range c.Tsig.Tkey.BootstrapKeys {
+		if !c.hasKey(name) {
+			problems = append(problems, Problem{Path: fmt.Sprintf("tsig.tkey.bootstrapkeys[%d]", idx),
+				Message: fmt.Sprintf("unknown key '%s'", name)})
+		}
+	}
+
+	for idx, sink := range c.Audit.Sinks {
+		if sink.Url != "" && validate.Var(sink.Url, "http_url") != nil {
+			problems = append(problems, Problem{Path: fmt.Sprintf("audit.sinks[%d].url", idx),
+				Message: fmt.Sprintf("'%s' is not an HTTP URL", sink.Url)})
+		}
+	}
+
+	for idx, rule := range c.Discovery.Rules {
+		path := fmt.Sprintf("discovery.rules[%d]", idx)
+		if rule.Handler != "" && !c.hasHandler(rule.Handler) {
+			problems = append(problems, Problem{Path: path + ".handler", Message: fmt.Sprintf("unknown handler '%s'", rule.Handler)})
+		} else if rule.Handler == "" && !c.hasDefaultHandler() {
+			problems = append(problems, Problem{Path: path, Message: "no handler set and no default handler configured"})
+		}
+	}
+
+	return problems
+}
+
+func (c *Configuration) validationProblems(err error, base string) []Problem {
+	var (
+		problems         []Problem
+		validationErrors validator.ValidationErrors
+	)
+	if err == nil {
+		return nil
+	}
+	if !errors.As(err, &validationErrors) {
+		return []Problem{{Path: base, Message: err.Error()}}
+	}
+
+	for _, fieldErr := range validationErrors {
+		path := joinPath(base, c.pathOf(fieldErr.Namespace()))
+		if fieldErr.Tag() == "zoneconfig" {
+			// explained by the same checks as the validator
+			zone := fieldErr.Value().(ZoneConfiguration)
+			for _, problem := range zoneProblems(c, &zone) {
+				problems = append(problems, Problem{Path: joinPath(path, problem.Path), Message: problem.Message})
+			}
+			// the zone fields are not validated once the zone failed
+			problems = append(problems, c.validationProblems(validate.Struct(&zone), path)...)
+			continue
+		}
+		problems = append(problems, Problem{Path: path, Message: describeFieldError(fieldErr)})
+	}
+	return problems
+}
+
+// Problems of a zone, with paths relative to the zone
+func zoneProblems(top *Configuration, zone *ZoneConfiguration) []Problem {
+	var problems []Problem
+
+	if zone.Handler != "" {
+		if !top.hasHandler(zone.Handler) {
+			problems = append(problems, Problem{Path: "handler", Message: fmt.Sprintf("unknown handler '%s'", zone.Handler)})
+		}
+	} else if !top.hasDefaultHandler() {
+		problems = append(problems, Problem{Message: "no handler set and no default handler configured"})
+	}
+
+	if zone.Unsecure {
+		// want no key when auth disabled
+		// enforced to make it more difficult to craft unsafe config by accident
+		if len(zone.Keys) > 0 || len(zone.Certificates) > 0 || len(zone.Allow) > 0 {
+			problems = append(problems, Problem{Path: "unsecure",
+				Message: "authentication is disabled but keys, certificates or identity rules are set"})
+		}
+		return problems
+	}
+
+	for idx, key := range zone.Keys {
+		// check all key references resolve
+		if !top.hasKey(key) {
+			problems = append(problems, Problem{Path: fmt.Sprintf("keys[%d]", idx), Message: fmt.Sprintf("unknown key '%s'", key)})
+		}
+	}
+
+	// authenticated by other identities only, or by the default key
+	if len(zone.Keys) == 0 && len(zone.Certificates) == 0 && len(zone.Allow) == 0 &&
+		!slices.ContainsFunc(top.Tsig.Keys, func(key TsigKeyConfiguration) bool { return key.Default }) {
+		problems = append(problems, Problem{Message: "authentication is enabled but no key is set and no default key configured"})
+	}
+
+	return problems
+}
+
+// Key names are compared in canonical form, like the keyring does
+func (c *Configuration) hasKey(name string) bool {
+	name = miekgdns.CanonicalName(miekgdns.Fqdn(name))
+	return slices.ContainsFunc(c.Tsig.Keys, func(key TsigKeyConfiguration) bool {
+		return miekgdns.CanonicalName(miekgdns.Fqdn(key.Name)) == name
+	})
+}
+
+func (c *Configuration) hasHandler(name string) bool {
+	return slices.ContainsFunc(c.Handlers, func(handler HandlerConfiguration) bool { return handler.Name == name })
+}
+
+func (c *Configuration) hasDefaultHandler() bool {
+	return slices.ContainsFunc(c.Handlers, func(handler HandlerConfiguration) bool { return handler.Default })
+}
+
+var namespaceIndex = regexp.MustCompile(`^(.*)\[(\d+)\]$`)
+
+// Converts a validator namespace such as "Configuration.Handlers[0].Settings.Url" to the path
+// of the setting in the file, "handlers[0].powerdns.url", as keys are case insensitive
+func (c *Configuration) pathOf(namespace string) string {
+	var (
+		segments []string
+		handler  = -1
+	)
+	for idx, segment := range strings.Split(namespace, ".") {
+		switch {
+		case idx == 0 || segment == "EmbeddedHandlerConfiguration":
+			continue
+		case segment == "Settings" && handler >= 0 && handler < len(c.Handlers):
+			segment = string(c.Handlers[handler].Adapter)
+		case strings.HasPrefix(segment, "Handlers["):
+			fmt.Sscanf(namespaceIndex.FindStringSubmatch(segment)[2], "%d", &handler)
+		}
+		segments = append(segments, strings.ToLower(segment))
+	}
+	return strings.Join(segments, ".")
+}
+
+func joinPath(base string, path string) string {
+	if path == "" {
+		return base
+	}
+	if base == "" {
+		return path
+	}
+	return base + "." + path
+}
+
+func describeFieldError(fieldErr validator.FieldError) string {
+	param := fieldErr.Param()
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "required_if", "required_with", "required_without":
+		return fmt.Sprintf("is required (%s %s)", strings.TrimPrefix(fieldErr.Tag(), "required_"), param)
+	case "excluded_with", "excluded_unless", "excluded_without":
+		return fmt.Sprintf("must not be set (%s %s)", strings.TrimPrefix(fieldErr.Tag(), "excluded_"), param)
+	case "fqdn":
+		return fmt.Sprintf("'%v' is not a fully qualified domain name", fieldErr.Value())
+	case "hostname":
+		return fmt.Sprintf("'%v' is not a valid hostname", fieldErr.Value())
+	case "hostname_port":
+		return fmt.Sprintf("'%v' is not a host:port address", fieldErr.Value())
+	case "file":
+		return fmt.Sprintf("'%v' is not an existing file", fieldErr.Value())
+	case "base64":
+		return "is not valid base64"
+	case "printascii":
+		return "must only contain printable ASCII characters"
+	case "oneof":
+		return fmt.Sprintf("'%v' is not one of: %s", fieldErr.Value(), strings.Join(strings.Fields(param), ", "))
+	case "unique":
+		if param != "" {
+			return fmt.Sprintf("has entries with the same %s", strings.ToLower(param))
+		}
+		return "has duplicate entries"
+	case "uniquedefault":
+		return "has more than one default entry"
+	case "adapterslug":
+		return fmt.Sprintf("unknown adapter '%v', expecting one of: %s", fieldErr.Value(),
+			strings.Join(adapters.Slugs(), ", "))
+	case "identityrule":
+		_, err := identity.ParseMatcher(fmt.Sprint(fieldErr.Value()))
+		return err.Error()
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", param)
+	case "gte":
+		return fmt.Sprintf("must be at least %s", param)
+	case "gtefield":
+		return fmt.Sprintf("must be at least %s", strings.ToLower(param))
+	case "rrtype":
+		return fmt.Sprintf("'%v' is not a record type", fieldErr.Value())
+	case "admintls":
+		return "is required to keep tokens from being sent in clear text, unless allowPlainHttp is set"
+	case "cidr":
+		return fmt.Sprintf("'%v' is not a network in CIDR notation", fieldErr.Value())
+	default:
+		return fmt.Sprintf("failed the '%s' check", fieldErr.Tag())
+	}
+}
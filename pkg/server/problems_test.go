@@ -0,0 +1,51 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/enix/tsigoat/pkg/dns/identity"
+	miekgdns "github.com/miekg/dns"
+)
+
+// Key references resolve like in the keyring, whatever their case and trailing dot
+func TestCheckKeyNames(t *testing.T) {
+	config := loadTestConfiguration(t, `tsig:
+  keys:
+    - {name: key., key: `+testMainSecret+`}
+  tkey:
+    bootstrapKeys: [Key., KEY]
+handlers:
+  - name: mem
+    default: true
+    adapter: memory
+    memory: {}
+zones:
+  - {zone: example.test, keys: [Key.]}
+  - {zone: other.test, keys: [key]}
+`)
+	if problems := config.Check(); len(problems) > 0 {
+		t.Errorf("unexpected problems %v", problems)
+	}
+
+	// and the server accepts them
+	s := NewServer(config)
+	if err := s.init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	for _, name := range []string{"example.test.", "other.test."} {
+		zone, _ := s.lookupZone(name)
+		if !zone.Authorizes(identity.NewTsigIdentity("KEY.", miekgdns.HmacSHA256)) {
+			t.Errorf("%s: key not authorized", name)
+		}
+	}
+	if !s.isBootstrapKey("Key.") {
+		t.Error("bootstrap key not recognized")
+	}
+
+	config.Zones[0].Keys = []string{"ghost."}
+	problems := config.Check()
+	if len(problems) != 1 || !strings.Contains(problems[0].Message, "unknown key 'ghost.'") {
+		t.Errorf("expected the unknown key to be reported, got %v", problems)
+	}
+}
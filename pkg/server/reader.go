@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	miekgdns "github.com/miekg/dns"
+)
+
+// Upper bound of messages kept while waiting for the handler, older ones are dropped first
+const rawMessagesCapacity = 256
+
+type rawMessageKey struct {
+	remote string
+	id     uint16
+}
+
+// SIG(0) signatures cover the message as received, which the handler does not get from the library.
+// Messages which may carry such a signature are kept here by the reader, until the handler takes them.
+type rawMessages struct {
+	lock     sync.Mutex
+	messages map[rawMessageKey][]byte
+	order    []rawMessageKey
+}
+
+func newRawMessages() *rawMessages {
+	return &rawMessages{messages: make(map[rawMessageKey][]byte)}
+}
+
+func (r *rawMessages) put(remote net.Addr, raw []byte) {
+	// messages without additional RRs cannot carry a signature
+	if remote == nil || len(raw) < 12 || binary.BigEndian.Uint16(raw[10:]) == 0 {
+		return
+	}
+
+	key := rawMessageKey{remote.String(), binary.BigEndian.Uint16(raw)}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, found := r.messages[key]; !found {
+		if len(r.order) >= rawMessagesCapacity {
+			delete(r.messages, r.order[0])
+			r.order = r.order[1:]
+		}
+		r.order = append(r.order, key)
+	}
+	// the buffer is reused by the library once the message is handled
+	r.messages[key] = bytes.Clone(raw)
+}
+
+func (r *rawMessages) take(remote net.Addr, id uint16) []byte {
+	key := rawMessageKey{remote.String(), id}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	raw, found := r.messages[key]
+	if !found {
+		return nil
+	}
+	delete(r.messages, key)
+	for idx, value := range r.order {
+		if value == key {
+			r.order = append(r.order[:idx], r.order[idx+1:]...)
+			break
+		}
+	}
+	return raw
+}
+
+func (r *rawMessages) decorate(reader miekgdns.Reader) miekgdns.Reader {
+	return &rawMessagesReader{reader, r}
+}
+
+type rawMessagesReader struct {
+	next     miekgdns.Reader
+	messages *rawMessages
+}
+
+func (r *rawMessagesReader) ReadTCP(conn net.Conn, timeout time.Duration) ([]byte, error) {
+	raw, err := r.next.ReadTCP(conn, timeout)
+	if err == nil {
+		r.messages.put(conn.RemoteAddr(), raw)
+	}
+	return raw, err
+}
+
+func (r *rawMessagesReader) ReadUDP(conn *net.UDPConn, timeout time.Duration) ([]byte, *miekgdns.SessionUDP, error) {
+	raw, session, err := r.next.ReadUDP(conn, timeout)
+	if err == nil {
+		r.messages.put(session.RemoteAddr(), raw)
+	}
+	return raw, session, err
+}
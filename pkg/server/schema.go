@@ -0,0 +1,312 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/enix/tsigoat/internal/product"
+	"github.com/enix/tsigoat/pkg/adapters"
+	"github.com/enix/tsigoat/pkg/adapters/common"
+	"github.com/enix/tsigoat/pkg/dns/identity"
+)
+
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Go durations as parsed by time.ParseDuration
+const durationPattern = `^[-+]?(0|([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+)$`
+
+type schema = map[string]any
+
+type validatorTag struct {
+	name  string
+	param string
+}
+
+// JSON Schema of the configuration file, generated from the configuration types and their validator tags.
+// Keys are matched whatever their case, like viper loads the file. Cross references, such as keys
+// referenced by zones, are left to the config check command.
+func Schema() map[string]any {
+	root := typeSchema(reflect.TypeFor[Configuration](), nil, nil)
+	root["$schema"] = schemaDialect
+	root["title"] = fmt.Sprintf("%s configuration", product.Name)
+	return root
+}
+
+// Validator tags before "dive" apply to the field, the following ones to its items
+func parseValidatorTags(tag string) (field []validatorTag, items []validatorTag) {
+	if tag == "" {
+		return nil, nil
+	}
+	current := &field
+	for _, value := range strings.Split(tag, ",") {
+		if value == "dive" {
+			current = &items
+			continue
+		}
+		name, param, _ := strings.Cut(value, "=")
+		*current = append(*current, validatorTag{name, param})
+	}
+	return field, items
+}
+
+// Keys are matched by patterns ignoring case, JSON Schema having no case-insensitive property names
+func keyPattern(name string) string {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, r := range strings.ToLower(name) {
+		if upper := unicode.ToUpper(r); upper != r {
+			pattern.WriteString("[" + string(r) + string(upper) + "]")
+		} else {
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	pattern.WriteString("$")
+	return pattern.String()
+}
+
+// Object having the key, whatever its case
+func hasKey(name string) schema {
+	return schema{"not": schema{"propertyNames": schema{"not": schema{"pattern": keyPattern(name)}}}}
+}
+
+// Object having the key set to the value, whatever the case of the key
+func keyEquals(name string, value any) schema {
+	return schema{"allOf": []any{
+		hasKey(name),
+		schema{"patternProperties": schema{keyPattern(name): schema{"const": value}}},
+	}}
+}
+
+func hasTag(tags []validatorTag, name string) bool {
+	return slices.ContainsFunc(tags, func(tag validatorTag) bool { return tag.name == name })
+}
+
+func typeSchema(t reflect.Type, tags []validatorTag, itemTags []validatorTag) schema {
+	var result schema
+
+	switch {
+	case t == reflect.TypeFor[time.Duration]():
+		result = schema{"type": "string", "pattern": durationPattern}
+	case t == reflect.TypeFor[HandlerConfiguration]():
+		return handlerSchema()
+	case t.Kind() == reflect.Pointer:
+		return typeSchema(t.Elem(), tags, itemTags)
+	case t.Kind() == reflect.Struct:
+		result = structSchema(t)
+	case t.Kind() == reflect.Map:
+		result = schema{"type": "object", "additionalProperties": typeSchema(t.Elem(), itemTags, nil)}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		result = schema{"type": "array", "items": typeSchema(t.Elem(), itemTags, nil)}
+	case t.Kind() == reflect.String:
+		result = schema{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		result = schema{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		result = schema{"type": "integer"}
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		result = schema{"type": "integer", "minimum": 0}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		result = schema{"type": "number"}
+	default:
+		result = schema{}
+	}
+
+	applyTags(result, tags)
+	return result
+}
+
+func structSchema(t reflect.Type) schema {
+	var (
+		properties   = schema{}
+		conditionals []any
+	)
+
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		name := strings.ToLower(field.Name)
+		tags, itemTags := parseValidatorTags(field.Tag.Get("validate"))
+
+		properties[keyPattern(name)] = typeSchema(field.Type, tags, itemTags)
+		if isRequired(field.Type, tags) {
+			conditionals = append(conditionals, hasKey(name))
+		}
+		conditionals = append(conditionals, conditionalSchemas(name, tags)...)
+	}
+
+	result := schema{"type": "object", "patternProperties": properties, "additionalProperties": false}
+	if len(conditionals) > 0 {
+		result["allOf"] = conditionals
+	}
+	return result
+}
+
+// Adapter settings are nested under the adapter slug, as decoded by decodeHandlerConfiguration
+func handlerSchema() schema {
+	result := structSchema(reflect.TypeFor[EmbeddedHandlerConfiguration]())
+	properties := result["patternProperties"].(schema)
+
+	var (
+		conditionals, _ = result["allOf"].([]any)
+		configTypes     = adapters.ConfigTypes()
+	)
+	for _, slug := range adapters.Slugs() {
+		properties[keyPattern(slug)] = typeSchema(configTypes[common.AdapterSlug(slug)], nil, nil)
+		conditionals = append(conditionals, schema{"if": keyEquals("adapter", slug), "then": hasKey(slug)})
+	}
+	result["allOf"] = conditionals
+	return result
+}
+
+// Whether a zero value fails validation, a missing key decoding to the zero value
+func isRequired(t reflect.Type, tags []validatorTag) bool {
+	if hasTag(tags, "required") {
+		return true
+	}
+	if hasTag(tags, "omitempty") || t.Kind() != reflect.String {
+		return false
+	}
+	return slices.ContainsFunc(tags, func(tag validatorTag) bool { return rejectsEmptyString(tag.name) })
+}
+
+func rejectsEmptyString(tag string) bool {
+	switch tag {
+	case "hostname", "fqdn", "hostname_port", "http_url", "base64", "file", "adapterslug", "identityrule":
+		return true
+	}
+	return false
+}
+
+// Trailing dots are accepted, unlike the hostname format of JSON Schema
+const (
+	hostnamePattern = `^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?\.?$`
+	fqdnPattern     = `^([A-Za-z0-9_]([A-Za-z0-9_-]*[A-Za-z0-9])?\.)+[A-Za-z]([A-Za-z0-9-]*[A-Za-z0-9])?\.?$`
+)
+
+const base64Pattern = `^(?:[A-Za-z0-9+/]{4})*(?:[A-Za-z0-9+/]{2}==|[A-Za-z0-9+/]{3}=|[A-Za-z0-9+/]{4})$`
+
+// Constraints of the tags on values, empty strings being allowed by omitempty
+func applyTags(result schema, tags []validatorTag) {
+	constraints := schema{}
+	isString := result["type"] == "string"
+	isArray := result["type"] == "array"
+	isNumber := result["type"] == "integer" || result["type"] == "number"
+
+	for _, tag := range tags {
+		switch tag.name {
+		case "required":
+			if isString {
+				result["minLength"] = 1
+			} else if isArray {
+				result["minItems"] = 1
+			}
+		case "oneof":
+			values := make([]any, 0)
+			for _, value := range strings.Fields(tag.param) {
+				values = append(values, value)
+			}
+			constraints["enum"] = values
+		case "gt", "gte":
+			bound, err := strconv.Atoi(tag.param)
+			if err != nil {
+				continue
+			}
+			switch {
+			case isArray && tag.name == "gt":
+				result["minItems"] = bound + 1
+			case isArray:
+				result["minItems"] = bound
+			case isNumber && tag.name == "gt":
+				result["exclusiveMinimum"] = bound
+			case isNumber:
+				result["minimum"] = bound
+			}
+		case "unique":
+			// uniqueness of a struct field cannot be expressed
+			if tag.param == "" {
+				result["uniqueItems"] = true
+			}
+		case "uniquedefault":
+			result["contains"] = keyEquals("default", true)
+			result["minContains"] = 0
+			result["maxContains"] = 1
+		case "hostname":
+			constraints["pattern"] = hostnamePattern
+		case "fqdn":
+			constraints["pattern"] = fqdnPattern
+		case "hostname_port":
+			constraints["pattern"] = `^.+:[0-9]{1,5}$`
+		case "http_url":
+			constraints["format"] = "uri"
+			constraints["pattern"] = `^https?://`
+		case "base64":
+			constraints["pattern"] = base64Pattern
+			constraints["contentEncoding"] = "base64"
+		case "printascii":
+			constraints["pattern"] = `^[\x20-\x7e]*$`
+		case "contains":
+			constraints["pattern"] = regexp.QuoteMeta(tag.param)
+		case "adapterslug":
+			values := make([]any, 0)
+			for _, slug := range adapters.Slugs() {
+				values = append(values, slug)
+			}
+			constraints["enum"] = values
+		case "rrtype":
+			constraints["pattern"] = `^[A-Za-z][A-Za-z0-9-]*$`
+		case "cidr":
+			constraints["pattern"] = `^[0-9A-Fa-f:.]+/[0-9]{1,3}$`
+		case "identityrule":
+			constraints["pattern"] = fmt.Sprintf("^(%s|%s|%s|%s):.+$", identity.KindTsig, identity.KindSig0,
+				identity.KindCertificate, identity.KindAddress)
+		}
+	}
+
+	if len(constraints) == 0 {
+		return
+	}
+	if isString && hasTag(tags, "omitempty") {
+		result["anyOf"] = []any{schema{"const": ""}, constraints}
+		return
+	}
+	for key, value := range constraints {
+		result[key] = value
+	}
+}
+
+// Constraints between sibling fields, a zero value being the same as a missing key
+func conditionalSchemas(name string, tags []validatorTag) []any {
+	var (
+		conditionals []any
+		present      = hasKey
+		absent       = func(field string) schema { return schema{"not": hasKey(field)} }
+	)
+
+	for _, tag := range tags {
+		field, value, _ := strings.Cut(tag.param, " ")
+		equals := keyEquals(field, value)
+
+		switch tag.name {
+		case "required_with":
+			conditionals = append(conditionals, schema{"if": present(field), "then": present(name)})
+		case "required_without":
+			conditionals = append(conditionals, schema{"if": absent(field), "then": present(name)})
+		case "required_if":
+			conditionals = append(conditionals, schema{"if": equals, "then": present(name)})
+		case "excluded_with":
+			conditionals = append(conditionals, schema{"if": present(field), "then": absent(name)})
+		case "excluded_without":
+			conditionals = append(conditionals, schema{"if": absent(field), "then": absent(name)})
+		case "excluded_unless":
+			conditionals = append(conditionals, schema{"if": schema{"not": equals}, "then": absent(name)})
+		}
+	}
+	return conditionals
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Keys of a decoded configuration not allowed by the schema of their object
+func rejectedKeys(path string, s schema, value any) []string {
+	var rejected []string
+
+	switch value := value.(type) {
+	case map[string]any:
+		for key, item := range value {
+			var matched schema
+			patterns, _ := s["patternProperties"].(schema)
+			for pattern, property := range patterns {
+				if regexp.MustCompile(pattern).MatchString(key) {
+					matched = property.(schema)
+					break
+				}
+			}
+			if matched == nil {
+				if additional, ok := s["additionalProperties"].(schema); ok {
+					matched = additional
+				} else if s["additionalProperties"] == false {
+					rejected = append(rejected, path+"."+key)
+					continue
+				}
+			}
+			rejected = append(rejected, rejectedKeys(path+"."+key, matched, item)...)
+		}
+	case []any:
+		items, _ := s["items"].(schema)
+		for _, item := range value {
+			rejected = append(rejected, rejectedKeys(path+"[]", items, item)...)
+		}
+	}
+	return rejected
+}
+
+func TestSchemaKeysIgnoreCase(t *testing.T) {
+	configurations := []string{
+		adminConfiguration("  allowPlainHttp: true\n"),
+		hideZonesConfiguration(true, true),
+		`server: {UpdateTimeout: 5s, DRYRUN: true}` + "\n",
+	}
+	for _, configuration := range configurations {
+		var decoded map[string]any
+		if err := yaml.Unmarshal([]byte(configuration), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if rejected := rejectedKeys("", Schema(), decoded); len(rejected) > 0 {
+			t.Errorf("valid keys rejected by the schema: %v", rejected)
+		}
+	}
+
+	unknown := map[string]any{"server": map[string]any{"hideZone": true}}
+	if rejected := rejectedKeys("", Schema(), unknown); len(rejected) != 1 {
+		t.Errorf("expected the unknown key to be rejected, got %v", rejected)
+	}
+}
+
+// Bounds only constrain numbers in JSON Schema
+func TestSchemaBounds(t *testing.T) {
+	var walk func(path string, value any)
+	walk = func(path string, value any) {
+		switch value := value.(type) {
+		case schema:
+			if value["type"] != "integer" && value["type"] != "number" {
+				for _, keyword := range []string{"minimum", "exclusiveMinimum"} {
+					if _, found := value[keyword]; found {
+						t.Errorf("%s: %s set on a %v", path, keyword, value["type"])
+					}
+				}
+			}
+			for key, item := range value {
+				walk(path+"/"+strings.ToLower(key), item)
+			}
+		case []any:
+			for _, item := range value {
+				walk(path, item)
+			}
+		}
+	}
+	walk("", Schema())
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/client"
+	"github.com/enix/tsigoat/pkg/selftest"
+	miekgdns "github.com/miekg/dns"
+)
+
+// The conformance suite against a server backed by the memory adapter
+func TestSelftest(t *testing.T) {
+	address, _ := startTestServer(t, `tsig:
+  keys:
+    - {name: main., key: `+testMainSecret+`, default: true}
+handlers:
+  - name: mem
+    default: true
+    adapter: memory
+    memory:
+      records:
+        - "example.test. 3600 IN SOA ns1.example.test. hostmaster.example.test. 1 3600 600 86400 300"
+        - "example.test. 3600 IN NS ns1.example.test."
+        - "ns1.example.test. 3600 IN A 192.0.2.53"
+zones:
+  - zone: example.test
+`)
+
+	report := selftest.Run(selftest.Target{
+		Server:  address,
+		Zone:    "example.test.",
+		Key:     &client.Key{Name: "main.", Algorithm: miekgdns.HmacSHA256, Secret: testMainSecret},
+		Options: client.SendOptions{Net: "udp", Timeout: 5 * time.Second},
+	})
+	for _, outcome := range report.Outcomes {
+		if outcome.Status != selftest.Passed {
+			t.Errorf("%s/%s: %s: %s", outcome.Category, outcome.Name, outcome.Status, outcome.Detail)
+		}
+	}
+	if len(report.Outcomes) == 0 {
+		t.Error("no test case was run")
+	}
+}
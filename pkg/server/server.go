@@ -1,12 +1,17 @@
 package server
 
 import (
+	"context"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/enix/tsigoat/pkg/adapters/common"
+	"github.com/enix/tsigoat/pkg/audit"
 	"github.com/enix/tsigoat/pkg/dns"
+	"github.com/enix/tsigoat/pkg/dns/sig0"
 	"github.com/enix/tsigoat/pkg/dns/tsig"
 	miekgdns "github.com/miekg/dns"
 	"go.uber.org/zap"
@@ -14,24 +19,48 @@ import (
 
 var Logger *zap.SugaredLogger // TODO move to Server struct
 
+const (
+	defaultUpdateTimeout = 10 * time.Second
+	defaultListenAddress = "[::]:5353"
+	defaultTkeyLifetime  = time.Hour
+	defaultTkeyMaxKeys   = 1024
+)
+
 // FIXME refactor server state
 type Server struct {
 	Configuration  *Configuration
-	keyring        tsig.TsigKeyring
+	updateTimeout  time.Duration
+	hideZones      bool
+	dryRun         bool
+	keyring        *tsig.TsigKeyring
+	tkeyBootstrap  []string
+	tkeyLifetime   time.Duration
+	tkeyMaxKeys    int
+	sig0Keyring    sig0.Keyring
+	rawMessages    *rawMessages
 	defaultKeyName string
 	adapters       []common.IAdapter
 	adaptersByName map[string]common.IAdapter
 	defaultAdapter common.IAdapter
+	zonesLock      sync.RWMutex
 	zones          []*dns.Zone
-	zonesByFqdn    map[string]*dns.Zone
+	zoneTree       *dns.ZoneTree
+	discovered     map[string]bool
+	discoveryRules []*discoveryRule
+	history        *updateHistory
+	auditSinks     []audit.Sink
+	stateLock      sync.Mutex
+	state          *adminState
 }
 
 func NewServer(configuration *Configuration) *Server {
 	return &Server{
 		Configuration:  configuration,
 		keyring:        tsig.NewTsigKeyring(),
+		sig0Keyring:    sig0.NewKeyring(),
 		adaptersByName: make(map[string]common.IAdapter),
-		zonesByFqdn:    make(map[string]*dns.Zone),
+		zoneTree:       dns.NewZoneTree(),
+		discovered:     make(map[string]bool),
 	}
 }
 
@@ -40,40 +69,106 @@ func (s *Server) Run() error {
 		Logger.Fatalw("failed to init server", "error", err)
 	}
 
+	if interval := s.Configuration.Discovery.Interval; interval > 0 {
+		go s.discoveryLoop(interval)
+	}
+
+	if config := &s.Configuration.Admin; config.Address != "" {
+		server, err := s.newAdminServer(config)
+		if err != nil {
+			Logger.Fatalw("failed to configure admin API", "address", config.Address, "error", err)
+		}
+		go s.serveAdmin(server)
+	}
+
 	// FIXME add logging here
-	tsigProvider := tsig.NewTsigProvider(&s.keyring, Logger)
+	tsigProvider := tsig.NewTsigProvider(s.keyring, Logger)
 
 	// FIXME add logging here
 	miekgdns.HandleFunc(".", s.Handle)
 
-	// FIXME add logging here
-	go s.serve("udp", tsigProvider, true)
-	go s.serve("tcp", tsigProvider, true)
+	listeners := s.Configuration.Server.Listeners
+	if len(listeners) == 0 {
+		listeners = []ListenerConfiguration{
+			{Net: ListenerUdp, Address: defaultListenAddress},
+			{Net: ListenerTcp, Address: defaultListenAddress},
+		}
+	}
+	servers := make([]*miekgdns.Server, 0, len(listeners))
+	for _, listener := range listeners {
+		server, err := s.newNetServer(&listener, tsigProvider)
+		if err != nil {
+			Logger.Fatalw("failed to configure listener", "protocol", listener.Net, "address", listener.Address,
+				"error", err)
+		}
+		servers = append(servers, server)
+		go s.serve(server)
+	}
 
-	sig := make(chan os.Signal)
-	// FIXME sigchanyzer: misuse of unbuffered os.Signal channel as argument to signal.Notify
+	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
 	signal := <-sig
 	Logger.Warnw("received stop signal while running server", "signal", signal)
 
+	// updates still running are audited before the sinks are closed
+	s.shutdown(servers)
+	s.closeAudit()
+
 	return nil
 }
 
-func (s *Server) serve(net string, provider *tsig.TsigProvider, soreuseport bool) {
+// Stops the listeners, giving updates in flight the time of an update to finish
+func (s *Server) shutdown(servers []*miekgdns.Server) {
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), s.updateTimeout)
+			defer cancel()
+			if err := server.ShutdownContext(ctx); err != nil {
+				Logger.Errorw("failed to stop network server", "protocol", server.Net, "address", server.Addr,
+					"error", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Server) newNetServer(config *ListenerConfiguration, provider *tsig.TsigProvider) (*miekgdns.Server, error) {
 	server := &miekgdns.Server{
-		Addr:          "[::]:5353", // FIXME config from cobra and ServerSettings
-		Net:           net,
-		ReusePort:     soreuseport,
+		Addr:          config.Address,
+		Net:           config.Net,
+		ReusePort:     true,
 		TsigProvider:  provider,
 		MsgAcceptFunc: s.msgAcceptAction,
 		MsgInvalidFunc: func(m []byte, err error) {
-			Logger.Debugw("observed an invalid message", "protocol", net, "length", len(m), "error", err.Error())
+			Logger.Debugw("observed an invalid message", "protocol", config.Net, "length", len(m), "error", err.Error())
 		},
 	}
 
-	// FIXME add logging here
+	// SIG(0) signatures are verified over the received message
+	if s.rawMessages != nil {
+		server.DecorateReader = s.rawMessages.decorate
+	}
+
+	if config.Net == ListenerTls {
+		reloader, err := newTlsReloader(config.Tls)
+		if err != nil {
+			return nil, err
+		}
+		server.Net = "tcp-tls"
+		server.TLSConfig = reloader.tlsConfig("dot")
+		Logger.Debugw("TLS listener configured", "address", config.Address, "certificate", config.Tls.CertFile,
+			"client_ca", config.Tls.ClientCaFile, "require_client_cert", config.Tls.RequireClientCert)
+	}
+	return server, nil
+}
+
+func (s *Server) serve(server *miekgdns.Server) {
+	Logger.Infow("starting network server", "protocol", server.Net, "address", server.Addr)
 	if err := server.ListenAndServe(); err != nil {
-		Logger.Fatalw("failed to start network server", "protocol", net, "error", err)
+		Logger.Fatalw("failed to start network server", "protocol", server.Net, "address", server.Addr, "error", err)
 	}
 }
 
@@ -94,5 +189,10 @@ func (s *Server) msgAcceptAction(dh miekgdns.Header) miekgdns.MsgAcceptAction {
 		return miekgdns.MsgAccept
 	}
 
+	// and key negotiations when enabled
+	if opcode == miekgdns.OpcodeQuery && len(s.tkeyBootstrap) > 0 {
+		return miekgdns.MsgAccept
+	}
+
 	return miekgdns.MsgReject
 }
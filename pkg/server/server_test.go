@@ -0,0 +1,89 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/dns/tsig"
+	miekgdns "github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	Logger = zap.NewNop().Sugar()
+	os.Exit(m.Run())
+}
+
+// Loads a YAML configuration like the configuration file
+func loadTestConfiguration(t *testing.T, configuration string) *Configuration {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "tsigoat.yaml")
+	if err := os.WriteFile(path, []byte(configuration), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file := NewConfigurationFile(YamlConfiguration)
+	file.FullPath = path
+	config, _, err := LoadConfiguration(file, Logger)
+	if err != nil {
+		t.Fatalf("LoadConfiguration: %v", err)
+	}
+	return config
+}
+
+// Starts a server from a YAML configuration, answering over UDP on a random local port
+func startTestServer(t *testing.T, configuration string) (string, *Server) {
+	t.Helper()
+
+	s := NewServer(loadTestConfiguration(t, configuration))
+	if err := s.init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := s.newNetServer(&ListenerConfiguration{Net: ListenerUdp, Address: conn.LocalAddr().String()},
+		tsig.NewTsigProvider(s.keyring, Logger))
+	if err != nil {
+		t.Fatalf("newNetServer: %v", err)
+	}
+	server.PacketConn = conn
+	server.Handler = miekgdns.HandlerFunc(s.Handle)
+
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(started) }
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() {
+		server.Shutdown()
+		s.closeAudit()
+	})
+	return conn.LocalAddr().String(), s
+}
+
+// Sends a packed message over UDP, returning the packed response
+func exchangeRaw(t *testing.T, address string, request []byte) []byte {
+	t.Helper()
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write(request); err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, miekgdns.MaxMsgSize)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		t.Fatalf("no response from %s: %v", address, err)
+	}
+	return buffer[:n]
+}
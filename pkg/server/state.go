@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/dns"
+)
+
+// Changes made through the admin API, on top of the configuration.
+// It holds key secrets, hence the file is only readable by its owner.
+type adminState struct {
+	Keys     []stateKey            `json:"keys"`
+	Disabled []string              `json:"disabled"`
+	Zones    map[string]*stateZone `json:"zones"`
+}
+
+type stateKey struct {
+	Name      string    `json:"name"`
+	Algorithm string    `json:"algorithm"`
+	Secret    string    `json:"secret"`
+	Created   time.Time `json:"created"`
+}
+
+// Keys attached to or detached from a zone, by zone FQDN
+type stateZone struct {
+	Attached []string `json:"attached,omitempty"`
+	Detached []string `json:"detached,omitempty"`
+}
+
+func newAdminState() *adminState {
+	return &adminState{Zones: make(map[string]*stateZone)}
+}
+
+func loadAdminState(path string) (*adminState, error) {
+	state := newAdminState()
+	if path == "" {
+		return state, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file '%s': %w", path, err)
+	}
+	if state.Zones == nil {
+		state.Zones = make(map[string]*stateZone)
+	}
+	return state, nil
+}
+
+// Written to a temporary file first, so a crash never leaves a truncated state
+func (state *adminState) save(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	temporary, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name())
+
+	if _, err := temporary.Write(data); err != nil {
+		temporary.Close()
+		return err
+	}
+	if err := temporary.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), path)
+}
+
+func (state *adminState) zone(fqdn string) *stateZone {
+	zone, found := state.Zones[fqdn]
+	if !found {
+		zone = &stateZone{}
+		state.Zones[fqdn] = zone
+	}
+	return zone
+}
+
+func (state *adminState) attach(fqdn string, key string) {
+	zone := state.zone(fqdn)
+	zone.Detached = slices.DeleteFunc(zone.Detached, func(name string) bool { return name == key })
+	if !slices.Contains(zone.Attached, key) {
+		zone.Attached = append(zone.Attached, key)
+	}
+}
+
+func (state *adminState) detach(fqdn string, key string) {
+	zone := state.zone(fqdn)
+	zone.Attached = slices.DeleteFunc(zone.Attached, func(name string) bool { return name == key })
+	if !slices.Contains(zone.Detached, key) {
+		zone.Detached = append(zone.Detached, key)
+	}
+}
+
+// Applies attachments to a zone being added, either from the configuration or discovered
+func (s *Server) applyZoneState(zone *dns.Zone) {
+	if s.state == nil {
+		return
+	}
+
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	changes, found := s.state.Zones[zone.Fqdn()]
+	if !found {
+		return
+	}
+	for _, key := range changes.Detached {
+		zone.RemoveValidKey(key)
+	}
+	for _, key := range changes.Attached {
+		if zone.HasAuthenticationDisabled() {
+			Logger.Warnw("ignoring key attached to a zone with authentication disabled", "name", zone.Fqdn(),
+				"keyname", key)
+			continue
+		}
+		if !s.keyring.HasKey(key) {
+			Logger.Warnw("ignoring unknown key attached to zone", "name", zone.Fqdn(), "keyname", key)
+			continue
+		}
+		if !zone.HasValidKey(key) {
+			zone.AddValidKey(key)
+		}
+	}
+}
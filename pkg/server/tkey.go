@@ -0,0 +1,247 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/dns/tkey"
+	"github.com/enix/tsigoat/pkg/dns/tsig"
+	"github.com/enix/tsigoat/pkg/dns/update"
+	miekgdns "github.com/miekg/dns"
+)
+
+// Size of server assigned keys and of the server nonce in Diffie-Hellman exchanges
+const tkeyRandomSize = 32
+
+func (s *Server) initTkey(config *TkeyConfiguration) error {
+	if len(config.BootstrapKeys) == 0 {
+		return nil
+	}
+
+	for _, name := range config.BootstrapKeys {
+		if !s.keyring.HasKey(name) {
+			return fmt.Errorf("unknown TKEY bootstrap key '%s'", name)
+		}
+		s.tkeyBootstrap = append(s.tkeyBootstrap, miekgdns.CanonicalName(name))
+	}
+
+	s.tkeyLifetime = config.MaxLifetime
+	s.tkeyMaxKeys = config.MaxKeys
+
+	Logger.Infow("session key negotiation enabled", "bootstrap_keys", s.tkeyBootstrap,
+		"max_lifetime", s.tkeyLifetime, "max_keys", s.tkeyMaxKeys)
+	return nil
+}
+
+// Answers RFC 2930 key negotiations. Requests must be signed with a bootstrap key,
+// except deletions which may also be signed with the session key being deleted.
+// Responses are signed with the request key.
+func (s *Server) handleTkey(writer miekgdns.ResponseWriter, received *miekgdns.Msg, identityErr error) {
+	response := new(miekgdns.Msg)
+	response.SetReply(received)
+
+	signature := received.IsTsig()
+	if signature == nil || identityErr != nil {
+		Logger.Debugw("refusing key negotiation without a valid TSIG signature")
+		response.Rcode = miekgdns.RcodeRefused
+		writer.WriteMsg(response)
+		return
+	}
+
+	request := tkey.RequestOf(received)
+	if request == nil {
+		Logger.Debug("key negotiation without TKEY record")
+		response.SetRcodeFormatError(received)
+		response.SetTsig(signature.Hdr.Name, signature.Algorithm, signature.Fudge, time.Now().Unix())
+		writer.WriteMsg(response)
+		return
+	}
+
+	reply := &miekgdns.TKEY{
+		Hdr:       miekgdns.RR_Header{Name: request.Hdr.Name, Rrtype: miekgdns.TypeTKEY, Class: miekgdns.ClassANY},
+		Algorithm: request.Algorithm,
+		Mode:      request.Mode,
+	}
+
+	var (
+		answers []miekgdns.RR
+		deleted bool
+		err     error
+	)
+	switch request.Mode {
+	case tkey.ModeDiffieHellman:
+		answers, err = s.tkeyDiffieHellman(received, request, reply, signature.Hdr.Name)
+	case tkey.ModeServerAssignment:
+		err = s.tkeyServerAssignment(writer, request, reply, signature.Hdr.Name)
+	case tkey.ModeDeletion:
+		deleted, err = s.tkeyDeletion(request, reply, signature.Hdr.Name)
+	default:
+		Logger.Debugw("key negotiation with unsupported mode", "mode", tkey.ModeToString(request.Mode))
+		reply.Error = miekgdns.RcodeBadMode
+	}
+
+	if err != nil {
+		if rcode, found := update.RcodeOf(err); found {
+			Logger.Infow("key negotiation rejected", "key", request.Hdr.Name, "mode", tkey.ModeToString(request.Mode),
+				"rcode", miekgdns.RcodeToString[rcode], "error", err.Error())
+			response.Rcode = rcode
+		} else {
+			Logger.Errorw("key negotiation failed", "key", request.Hdr.Name, "mode", tkey.ModeToString(request.Mode),
+				"error", err.Error())
+			response.Rcode = miekgdns.RcodeServerFailure
+		}
+	} else {
+		response.Answer = append([]miekgdns.RR{reply}, answers...)
+	}
+
+	response.SetTsig(signature.Hdr.Name, signature.Algorithm, signature.Fudge, time.Now().Unix())
+	writer.WriteMsg(response)
+
+	// after the response, which may be signed with the deleted key
+	if deleted {
+		s.keyring.RemoveDynamicKey(request.Hdr.Name)
+		Logger.Infow("deleted session key", "key", request.Hdr.Name, "signer", signature.Hdr.Name)
+	}
+}
+
+func (s *Server) isBootstrapKey(name string) bool {
+	return slices.Contains(s.tkeyBootstrap, miekgdns.CanonicalName(name)) && s.keyring.HasKey(name)
+}
+
+// RFC 2930 section 4.1, the server public key is returned in a KEY record along the TKEY one
+func (s *Server) tkeyDiffieHellman(received *miekgdns.Msg, request *miekgdns.TKEY, reply *miekgdns.TKEY,
+	signer string) ([]miekgdns.RR, error) {
+	if !s.isBootstrapKey(signer) {
+		return nil, update.NewRcodeError(miekgdns.RcodeRefused, "key '%s' is not a bootstrap key", signer)
+	}
+
+	record := tkey.DhKeyOf(received)
+	if record == nil {
+		return nil, update.NewRcodeError(miekgdns.RcodeFormatError, "no Diffie-Hellman KEY record in request")
+	}
+	queryData, err := hex.DecodeString(request.Key)
+	if err != nil || len(queryData) == 0 {
+		return nil, update.NewRcodeError(miekgdns.RcodeFormatError, "missing or invalid requester nonce")
+	}
+
+	peer, err := tkey.ParseDhKey(record)
+	if err != nil {
+		Logger.Debugw("key negotiation with an unusable Diffie-Hellman key", "error", err.Error())
+		reply.Error = miekgdns.RcodeBadKey
+		return nil, nil
+	}
+
+	private, public, err := tkey.GenerateDhKey(peer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate Diffie-Hellman key: %w", err)
+	}
+	serverData := make([]byte, tkeyRandomSize)
+	if _, err := rand.Read(serverData); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	material := tkey.KeyingMaterial(tkey.SharedSecret(private, peer), queryData, serverData)
+	if !s.addSessionKey(request, reply, signer, material) {
+		return nil, nil
+	}
+
+	reply.Key = hex.EncodeToString(serverData)
+	reply.KeySize = uint16(len(serverData))
+
+	key := &miekgdns.KEY{DNSKEY: miekgdns.DNSKEY{
+		Hdr:       miekgdns.RR_Header{Name: request.Hdr.Name, Rrtype: miekgdns.TypeKEY, Class: miekgdns.ClassINET},
+		Flags:     record.Flags,
+		Protocol:  record.Protocol,
+		Algorithm: tkey.AlgorithmDH,
+		PublicKey: public.Encode(),
+	}}
+	return []miekgdns.RR{key}, nil
+}
+
+// The key is sent in clear in the TKEY record, which is only done over TLS.
+// Encryption with a requester KEY record (RFC 2930 section 4.4) is not supported.
+func (s *Server) tkeyServerAssignment(writer miekgdns.ResponseWriter, request *miekgdns.TKEY,
+	reply *miekgdns.TKEY, signer string) error {
+	if !s.isBootstrapKey(signer) {
+		return update.NewRcodeError(miekgdns.RcodeRefused, "key '%s' is not a bootstrap key", signer)
+	}
+
+	if stater, ok := writer.(miekgdns.ConnectionStater); !ok || stater.ConnectionState() == nil {
+		Logger.Debug("server assigned keys are only sent over TLS")
+		reply.Error = miekgdns.RcodeBadMode
+		return nil
+	}
+
+	material := make([]byte, tkeyRandomSize)
+	if _, err := rand.Read(material); err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	if !s.addSessionKey(request, reply, signer, material) {
+		return nil
+	}
+
+	reply.Key = hex.EncodeToString(material)
+	reply.KeySize = uint16(len(material))
+	return nil
+}
+
+// RFC 2930 section 4.2, the deletion happens once the response is sent
+func (s *Server) tkeyDeletion(request *miekgdns.TKEY, reply *miekgdns.TKEY, signer string) (bool, error) {
+	dynamic, found := s.keyring.DynamicKey(request.Hdr.Name)
+	if !found {
+		reply.Error = miekgdns.RcodeBadName
+		return false, nil
+	}
+
+	if !sameName(signer, request.Hdr.Name) && !sameName(signer, dynamic.Owner) {
+		return false, update.NewRcodeError(miekgdns.RcodeRefused, "key '%s' may not delete session key '%s'",
+			signer, request.Hdr.Name)
+	}
+	return true, nil
+}
+
+// Sets the TKEY error when the key cannot be added, the lifetime being bounded by the configuration
+func (s *Server) addSessionKey(request *miekgdns.TKEY, reply *miekgdns.TKEY, owner string, material []byte) bool {
+	algorithm := miekgdns.CanonicalName(request.Algorithm)
+	if _, err := tsig.NewHmac(algorithm); err != nil {
+		reply.Error = miekgdns.RcodeBadAlg
+		return false
+	}
+
+	if s.keyring.Key(request.Hdr.Name) != nil {
+		Logger.Debugw("key negotiation for a name already in use", "key", request.Hdr.Name)
+		reply.Error = miekgdns.RcodeBadName
+		return false
+	}
+
+	now := time.Now()
+	expiration := now.Add(s.tkeyLifetime)
+	if requested := time.Unix(int64(request.Expiration), 0); requested.After(now) && requested.Before(expiration) {
+		expiration = requested
+	}
+
+	err := s.keyring.AddDynamicKey(request.Hdr.Name, &tsig.DynamicKey{
+		Key:        material,
+		Algorithm:  algorithm,
+		Owner:      owner,
+		Expiration: expiration,
+	}, s.tkeyMaxKeys)
+	if err != nil {
+		Logger.Warnw("failed to add session key", "key", request.Hdr.Name, "error", err.Error())
+		reply.Error = miekgdns.RcodeBadName
+		return false
+	}
+
+	reply.Inception = uint32(now.Unix())
+	reply.Expiration = uint32(expiration.Unix())
+	Logger.Infow("negotiated session key", "key", request.Hdr.Name, "owner", owner, "algorithm", algorithm,
+		"mode", tkey.ModeToString(request.Mode), "expiration", expiration)
+	return true
+}
+
+func sameName(a string, b string) bool {
+	return miekgdns.CanonicalName(a) == miekgdns.CanonicalName(b)
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/enix/tsigoat/pkg/dns/tkey"
+	"github.com/enix/tsigoat/pkg/dns/tsig"
+	miekgdns "github.com/miekg/dns"
+)
+
+// Keeps the response written by a handler, over TLS when a connection state is set
+type recordingWriter struct {
+	miekgdns.ResponseWriter
+	state    *tls.ConnectionState
+	response *miekgdns.Msg
+}
+
+func (w *recordingWriter) WriteMsg(msg *miekgdns.Msg) error {
+	w.response = msg
+	return nil
+}
+
+type tlsRecordingWriter struct {
+	recordingWriter
+}
+
+func (w *tlsRecordingWriter) ConnectionState() *tls.ConnectionState {
+	return w.state
+}
+
+const tkeyConfiguration = `tsig:
+  keys:
+    - {name: boot., key: ` + testMainSecret + `}
+    - {name: other., key: ` + testOtherSecret + `}
+  tkey:
+    bootstrapKeys: [boot.]
+handlers:
+  - name: mem
+    default: true
+    adapter: memory
+    memory:
+      records:
+        - "example.test. 3600 IN SOA ns1.example.test. hostmaster.example.test. 1 3600 600 86400 300"
+zones:
+  - {zone: example.test, keys: [boot.]}
+`
+
+func newTkeyServer(t *testing.T) *Server {
+	t.Helper()
+
+	s := NewServer(loadTestConfiguration(t, tkeyConfiguration))
+	if err := s.init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	return s
+}
+
+// A key negotiation signed by the given key, the signature being checked by the caller of handleTkey
+func tkeyRequest(keyName string, mode uint16, sessionKey string) *miekgdns.Msg {
+	request := new(miekgdns.Msg)
+	request.SetQuestion(sessionKey, miekgdns.TypeTKEY)
+	request.Extra = append(request.Extra, &miekgdns.TKEY{
+		Hdr:       miekgdns.RR_Header{Name: sessionKey, Rrtype: miekgdns.TypeTKEY, Class: miekgdns.ClassANY},
+		Algorithm: miekgdns.HmacSHA256,
+		Mode:      mode,
+	})
+	request.SetTsig(keyName, miekgdns.HmacSHA256, 300, time.Now().Unix())
+	return request
+}
+
+func tkeyReplyOf(t *testing.T, response *miekgdns.Msg) *miekgdns.TKEY {
+	t.Helper()
+
+	if response == nil || len(response.Answer) == 0 {
+		t.Fatalf("no TKEY record in response %v", response)
+	}
+	reply, ok := response.Answer[0].(*miekgdns.TKEY)
+	if !ok {
+		t.Fatalf("unexpected answer %v", response.Answer[0])
+	}
+	return reply
+}
+
+func TestTkeyServerAssignment(t *testing.T) {
+	tests := []struct {
+		name   string
+		signer string
+		tls    bool
+		rcode  int
+		error  uint16
+	}{
+		{"over TLS", "boot.", true, miekgdns.RcodeSuccess, miekgdns.RcodeSuccess},
+		{"without TLS", "boot.", false, miekgdns.RcodeSuccess, miekgdns.RcodeBadMode},
+		{"not a bootstrap key", "other.", true, miekgdns.RcodeRefused, miekgdns.RcodeSuccess},
+	}
+	for _, test := range tests {
+		s := newTkeyServer(t)
+
+		var writer miekgdns.ResponseWriter
+		recorder := &recordingWriter{}
+		if test.tls {
+			tlsRecorder := &tlsRecordingWriter{recordingWriter{state: &tls.ConnectionState{}}}
+			writer, recorder = tlsRecorder, &tlsRecorder.recordingWriter
+		} else {
+			writer = recorder
+		}
+		s.handleTkey(writer, tkeyRequest(test.signer, tkey.ModeServerAssignment, "session."), nil)
+
+		response := recorder.response
+		if response.Rcode != test.rcode {
+			t.Errorf("%s: got %s, expected %s", test.name, miekgdns.RcodeToString[response.Rcode],
+				miekgdns.RcodeToString[test.rcode])
+			continue
+		}
+		if response.IsTsig() == nil || response.IsTsig().Hdr.Name != test.signer {
+			t.Errorf("%s: response not signed with the request key", test.name)
+		}
+		if test.rcode != miekgdns.RcodeSuccess {
+			continue
+		}
+		if reply := tkeyReplyOf(t, response); uint16(reply.Error) != test.error {
+			t.Errorf("%s: got TKEY error %d, expected %d", test.name, reply.Error, test.error)
+		}
+		_, added := s.keyring.DynamicKey("session.")
+		if added != (test.error == miekgdns.RcodeSuccess) {
+			t.Errorf("%s: session key added: %t", test.name, added)
+		}
+	}
+}
+
+func TestTkeyDiffieHellmanRefused(t *testing.T) {
+	s := newTkeyServer(t)
+	recorder := &recordingWriter{}
+	s.handleTkey(recorder, tkeyRequest("other.", tkey.ModeDiffieHellman, "session."), nil)
+	if recorder.response.Rcode != miekgdns.RcodeRefused {
+		t.Errorf("got %s, expected REFUSED", miekgdns.RcodeToString[recorder.response.Rcode])
+	}
+}
+
+func TestTkeyDeletion(t *testing.T) {
+	tests := []struct {
+		signer  string
+		deleted bool
+	}{
+		{"boot.", true},
+		{"Session.", true},
+		{"other.", false},
+	}
+	for _, test := range tests {
+		s := newTkeyServer(t)
+		err := s.keyring.AddDynamicKey("session.", &tsig.DynamicKey{
+			Key:        []byte("0123456789abcdef0123456789abcdef"),
+			Algorithm:  miekgdns.HmacSHA256,
+			Owner:      "boot.",
+			Expiration: time.Now().Add(time.Hour),
+		}, 10)
+		if err != nil {
+			t.Fatalf("AddDynamicKey: %v", err)
+		}
+
+		recorder := &recordingWriter{}
+		s.handleTkey(recorder, tkeyRequest(test.signer, tkey.ModeDeletion, "session."), nil)
+
+		expected := miekgdns.RcodeRefused
+		if test.deleted {
+			expected = miekgdns.RcodeSuccess
+		}
+		if recorder.response.Rcode != expected {
+			t.Errorf("%s: got %s, expected %s", test.signer, miekgdns.RcodeToString[recorder.response.Rcode],
+				miekgdns.RcodeToString[expected])
+		}
+		if _, found := s.keyring.DynamicKey("session."); found == test.deleted {
+			t.Errorf("%s: session key still present: %t", test.signer, found)
+		}
+	}
+}
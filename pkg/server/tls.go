@@ -0,0 +1,135 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// How often handshakes check whether the TLS files changed on disk
+const tlsReloadInterval = 10 * time.Second
+
+// Certificate and client CA files are loaded again when they change on disk.
+// A failed reload is logged and the previous files are kept in use.
+type tlsReloader struct {
+	config   *TlsListenerConfiguration
+	interval time.Duration
+
+	lock        sync.Mutex
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+	modTimes    map[string]time.Time
+	checked     time.Time
+}
+
+func newTlsReloader(config *TlsListenerConfiguration) (*tlsReloader, error) {
+	reloader := &tlsReloader{config: config, interval: tlsReloadInterval}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (r *tlsReloader) files() []string {
+	files := []string{r.config.CertFile, r.config.KeyFile}
+	if r.config.ClientCaFile != "" {
+		files = append(files, r.config.ClientCaFile)
+	}
+	return files
+}
+
+func (r *tlsReloader) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	certificate, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.config.ClientCaFile != "" {
+		pem, err := os.ReadFile(r.config.ClientCaFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA bundle: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in client CA bundle '%s'", r.config.ClientCaFile)
+		}
+	}
+
+	r.certificate = &certificate
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	r.checked = time.Now()
+	return nil
+}
+
+func (r *tlsReloader) changed() bool {
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Files are checked once per interval, handshakes in between get the cached ones
+func (r *tlsReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if time.Since(r.checked) < r.interval {
+		return r.certificate, r.clientCAs
+	}
+	r.checked = time.Now()
+	if r.changed() {
+		if err := r.load(); err != nil {
+			Logger.Errorw("failed to reload TLS files, keeping the previous ones", "certificate", r.config.CertFile,
+				"error", err.Error())
+		} else {
+			Logger.Infow("reloaded TLS files", "certificate", r.config.CertFile)
+		}
+	}
+	return r.certificate, r.clientCAs
+}
+
+func (r *tlsReloader) tlsConfig(protocols ...string) *tls.Config {
+	clientAuth := tls.NoClientCert
+	if r.config.ClientCaFile != "" {
+		clientAuth = tls.VerifyClientCertIfGiven
+		if r.config.RequireClientCert {
+			clientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: clientAuth,
+		NextProtos: protocols,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			certificate, _ := r.current()
+			return certificate, nil
+		},
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		certificate, clientCAs := r.current()
+		config := base.Clone()
+		config.GetConfigForClient = nil
+		config.Certificates = []tls.Certificate{*certificate}
+		config.ClientCAs = clientCAs
+		return config, nil
+	}
+	return base
+}
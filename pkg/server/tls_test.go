@@ -0,0 +1,98 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes a self-signed certificate and its key, modified at the given time
+func writeTestCertificate(t *testing.T, config *TlsListenerConfiguration, name string, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(config.CertFile, certificate, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+		0o600); err != nil {
+		t.Fatal(err)
+	}
+	// file systems with a coarse time resolution would not tell versions written in a row apart
+	os.Chtimes(config.CertFile, modTime, modTime)
+	os.Chtimes(config.KeyFile, modTime, modTime)
+}
+
+func commonNameOf(t *testing.T, r *tlsReloader) string {
+	t.Helper()
+
+	certificate, _ := r.current()
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestTlsReloader(t *testing.T) {
+	dir := t.TempDir()
+	config := &TlsListenerConfiguration{
+		CertFile: filepath.Join(dir, "tls.crt"),
+		KeyFile:  filepath.Join(dir, "tls.key"),
+	}
+	now := time.Now()
+	writeTestCertificate(t, config, "first.test", now.Add(-time.Minute))
+
+	reloader, err := newTlsReloader(config)
+	if err != nil {
+		t.Fatalf("newTlsReloader: %v", err)
+	}
+	writeTestCertificate(t, config, "second.test", now)
+
+	// handshakes within the interval don't look at the files
+	if name := commonNameOf(t, reloader); name != "first.test" {
+		t.Errorf("files checked before the interval elapsed, got %s", name)
+	}
+
+	reloader.checked = time.Time{}
+	if name := commonNameOf(t, reloader); name != "second.test" {
+		t.Errorf("changed files not reloaded, got %s", name)
+	}
+
+	// broken files are ignored
+	if err := os.WriteFile(config.KeyFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	reloader.checked = time.Time{}
+	if name := commonNameOf(t, reloader); name != "second.test" {
+		t.Errorf("previous files not kept after a failed reload, got %s", name)
+	}
+}